@@ -13,4 +13,5 @@ var AWSCommand = &cobra.Command{
 func init() {
 	AWSCommand.AddCommand(authCommand)
 	AWSCommand.AddCommand(consumersCommand)
+	AWSCommand.AddCommand(secretsCommand)
 }
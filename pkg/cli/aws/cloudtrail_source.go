@@ -0,0 +1,210 @@
+package aws
+
+import (
+	"errors"
+	"fmt"
+	"os"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/samber/lo"
+	"github.com/spf13/cobra"
+	"github.com/torchsecurity/torch-secret-analyzer/pkg/clients"
+	"github.com/torchsecurity/torch-secret-analyzer/pkg/collectors/aws_cloudtrail"
+	"github.com/torchsecurity/torch-secret-analyzer/pkg/collectors/aws_ec2"
+	"github.com/torchsecurity/torch-secret-analyzer/pkg/collectors/aws_iam"
+	"github.com/torchsecurity/torch-secret-analyzer/pkg/collectors/aws_organizations"
+	"github.com/torchsecurity/torch-secret-analyzer/pkg/collectors/aws_secretsmanager"
+	"github.com/torchsecurity/torch-secret-analyzer/pkg/collectors/aws_sts"
+	"github.com/torchsecurity/torch-secret-analyzer/pkg/utils/colors"
+)
+
+const (
+	apiSource    = "api"
+	lakeSource   = "lake"
+	athenaSource = "athena"
+)
+
+var cloudtrailSources = []string{apiSource, lakeSource, athenaSource}
+
+// CloudTrail source flags, shared between the commands that analyze CloudTrail events
+var (
+	cloudtrailFiles  []string
+	cloudtrailSource string
+	eventDataStore   string
+	athenaTable      clients.AthenaTable
+	queryTimeout     time.Duration
+	regions          []string
+	allRegions       bool
+	accountIds       []string
+	allAccounts      bool
+	auditRole        string
+)
+
+// The aliases of the accounts analyzed in multi-account mode, resolved when collecting their events
+var accountAliases = map[string]string{}
+
+// How many account aliases are resolved at a time, so that large organizations aren't throttled by STS
+const maxConcurrentAliases = 8
+
+func addCloudTrailSourceFlags(cmd *cobra.Command) {
+	cmd.Flags().StringSliceVar(&regions, "regions", nil, "The AWS regions to query CloudTrail events in concurrently (with --source api).")
+	cmd.Flags().BoolVar(&allRegions, "all-regions", false, "Query CloudTrail events in all the regions the secret is replicated to, or all enabled regions when analyzing all secrets (with --source api).")
+	cmd.Flags().StringSliceVar(&accountIds, "accounts", nil, "The AWS accounts to query CloudTrail events in, by assuming the audit role in each of them (with --source api).")
+	cmd.Flags().BoolVar(&allAccounts, "org", false, "Query CloudTrail events in all the active accounts of the AWS organization, by assuming the audit role in each of them (with --source api).")
+	cmd.Flags().StringVar(&auditRole, "audit-role", "OrganizationAccountAccessRole", "The name of the role to assume in each account with --accounts or --org.")
+	cmd.Flags().StringSliceVar(&cloudtrailFiles, "from-files", nil, "Read the events from exported CloudTrail log files (.json or .json.gz) or directories instead of the CloudTrail API. Use - to read from stdin.")
+	cmd.Flags().StringVar(&cloudtrailSource, "source", apiSource, "Where to query CloudTrail events from: api (LookupEvents, the last 90 days), lake (a CloudTrail Lake event data store) or athena (an Athena table over CloudTrail log files).")
+	cmd.Flags().StringVar(&eventDataStore, "event-data-store", "", "The ARN or ID of the CloudTrail Lake event data store to query (required with --source lake).")
+	cmd.Flags().StringVar(&athenaTable.Database, "athena-database", "default", "The Athena database of the CloudTrail table.")
+	cmd.Flags().StringVar(&athenaTable.Table, "athena-table", "", "The Athena CloudTrail table to query (required with --source athena).")
+	cmd.Flags().StringVar(&athenaTable.Workgroup, "athena-workgroup", "primary", "The Athena workgroup to run the query in.")
+	cmd.Flags().StringVar(&athenaTable.OutputLocation, "athena-output-location", "", "The S3 location of the query results (will use the workgroup's by default).")
+	cmd.Flags().StringVar(&athenaTable.TimestampPartition, "athena-timestamp-partition", "timestamp", "The yyyy/MM/dd partition column of the table, used to prune partitions outside the timeframe (empty to disable).")
+	cmd.Flags().DurationVar(&queryTimeout, "query-timeout", 30*time.Minute, "How long to wait for a CloudTrail Lake or Athena query before cancelling it (0 to wait indefinitely).")
+}
+
+// collectCloudTrail collects the CloudTrail events from the source selected by the command's flags.
+// Sources that filter on the server side only return the events of the given secret, unless it's empty.
+func collectCloudTrail(cmd *cobra.Command, secretId string, eventNames []string) (aws_cloudtrail.EventsByName, error) {
+	if len(cloudtrailFiles) > 0 {
+		// Log files are not limited to the last 90 days, so we only filter their events when asked to
+		return aws_cloudtrail.CollectCloudTrailFiles(cloudtrailFiles, lo.Ternary(cmd.Flags().Changed("days-back"), daysBack, 0), eventNames)
+	}
+
+	switch cloudtrailSource {
+	case apiSource:
+		cloudtrailRegions, err := resolveRegions(secretId)
+		if err != nil {
+			return nil, err
+		}
+		accounts, err := resolveAccounts()
+		if err != nil {
+			return nil, err
+		}
+		if len(accounts.ids) > 0 {
+			fmt.Fprintf(os.Stderr, "Collecting AWS CloudTrail Events in %d accounts as %s\n", len(accounts.ids), auditRole)
+			events, accountErrs := aws_cloudtrail.CollectCloudTrailAccounts(accounts.ids, accounts.callerAccountId, accounts.partition, auditRole, lo.Ternary(len(cloudtrailRegions) > 0, cloudtrailRegions, []string{region}), daysBack, eventNames, profileToUse)
+			// An account whose audit role can't be assumed shouldn't hide the events of the others
+			if len(accountErrs) == len(accounts.ids) {
+				return nil, errors.Join(accountErrs...)
+			}
+			for _, err := range accountErrs {
+				fmt.Fprintf(os.Stderr, colors.Yellow("Skipping account: %v\n"), err)
+			}
+			return events, nil
+		}
+		if len(cloudtrailRegions) == 0 {
+			return aws_cloudtrail.CollectCloudTrail(region, daysBack, eventNames, profileToUse)
+		}
+		fmt.Fprintf(os.Stderr, "Collecting AWS CloudTrail Events in %s\n", strings.Join(cloudtrailRegions, ", "))
+		return aws_cloudtrail.CollectCloudTrailRegions(cloudtrailRegions, daysBack, eventNames, profileToUse)
+	case lakeSource:
+		if eventDataStore == "" {
+			return nil, fmt.Errorf("--event-data-store is required with --source %s", lakeSource)
+		}
+		return aws_cloudtrail.CollectCloudTrailLake(region, daysBack, eventNames, profileToUse, eventDataStore, queryTimeout, secretId)
+	case athenaSource:
+		if athenaTable.Table == "" {
+			return nil, fmt.Errorf("--athena-table is required with --source %s", athenaSource)
+		}
+		return aws_cloudtrail.CollectCloudTrailAthena(region, daysBack, eventNames, profileToUse, athenaTable, queryTimeout, secretId)
+	}
+	return nil, fmt.Errorf("unsupported source '%s', expected one of %v", cloudtrailSource, cloudtrailSources)
+}
+
+// resolveRegions returns the regions to collect events in, or nothing to only collect events in the default region.
+// LookupEvents only returns the events of the region it's called in, and readers of a replicated secret call the replica nearest to them.
+func resolveRegions(secretId string) ([]string, error) {
+	if !allRegions {
+		return regions, nil
+	}
+	if secretId != "" {
+		secretRegions, err := aws_secretsmanager.CollectSecretRegions(region, profileToUse, secretId)
+		if err != nil {
+			return nil, fmt.Errorf("could not discover the regions of secret %s: %v", secretId, err)
+		}
+		return secretRegions, nil
+	}
+	enabledRegions, err := aws_ec2.CollectRegions(region, profileToUse)
+	if err != nil {
+		return nil, fmt.Errorf("could not discover the enabled regions: %v", err)
+	}
+	return enabledRegions, nil
+}
+
+// auditedAccounts are the accounts to collect events in, and the partition of their audit roles.
+type auditedAccounts struct {
+	ids             []string
+	callerAccountId string // The profile's own account, whose events are collected without assuming the audit role
+	partition       string
+}
+
+// resolveAccounts returns the accounts to collect events in (and resolves their aliases), or nothing to only collect events in the
+// profile's account. They're resolved once, as commands collect several kinds of events.
+var resolveAccounts = sync.OnceValues(func() (auditedAccounts, error) {
+	collectedAccountIds := accountIds
+	if allAccounts {
+		accounts, err := aws_organizations.CollectAccounts(region, profileToUse)
+		if err != nil {
+			return auditedAccounts{}, fmt.Errorf("could not list the accounts of the organization: %v", err)
+		}
+		collectedAccountIds = lo.Map(accounts, func(account clients.Account, _ int) string { return account.Id })
+	}
+	if len(collectedAccountIds) == 0 {
+		return auditedAccounts{}, nil
+	}
+
+	// The audit roles are in the partition of the profile's account (e.g. aws-us-gov in GovCloud)
+	callerIdentity, err := aws_sts.CollectCallerIdentity(region, profileToUse)
+	if err != nil {
+		return auditedAccounts{}, fmt.Errorf("could not get the caller identity: %v", err)
+	}
+	accounts := auditedAccounts{ids: collectedAccountIds, callerAccountId: callerIdentity.AccountId, partition: callerIdentity.Partition}
+	resolveAccountAliases(accounts)
+	return accounts, nil
+})
+
+// resolveAccountAliases resolves the IAM aliases of the accounts concurrently, through their audit roles.
+func resolveAccountAliases(accounts auditedAccounts) {
+	var wg sync.WaitGroup
+	var mutex sync.Mutex
+	semaphore := make(chan struct{}, maxConcurrentAliases)
+	for _, accountId := range accounts.ids {
+		wg.Add(1)
+		go func(accountId string) {
+			defer wg.Done()
+			semaphore <- struct{}{}
+			alias, err := aws_iam.CollectAccountAlias(region, profileToUse, clients.WithAccountRole(accounts.partition, accountId, accounts.callerAccountId, auditRole))
+			<-semaphore
+
+			mutex.Lock()
+			defer mutex.Unlock()
+			if err != nil {
+				fmt.Fprintf(os.Stderr, colors.Yellow("Could not get the alias of account %s: %v\n"), accountId, err)
+				return
+			}
+			accountAliases[accountId] = alias
+		}(accountId)
+	}
+	wg.Wait()
+}
+
+func describeCloudTrailSource(cmd *cobra.Command, eventsKind string) string {
+	if len(cloudtrailFiles) > 0 {
+		if !cmd.Flags().Changed("days-back") {
+			return "AWS CloudTrail log files"
+		}
+		return fmt.Sprintf("AWS CloudTrail log files, filtering for %s events in the last %d days", eventsKind, daysBack)
+	}
+
+	source := "AWS CloudTrail Events"
+	switch cloudtrailSource {
+	case lakeSource:
+		source = "AWS CloudTrail Lake events"
+	case athenaSource:
+		source = "AWS CloudTrail events in Athena"
+	}
+	return fmt.Sprintf("%s, filtering for %s events in the last %d days", source, eventsKind, daysBack)
+}
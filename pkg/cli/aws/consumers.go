@@ -2,9 +2,18 @@ package aws
 
 import (
 	"fmt"
+	"os"
+	"sort"
+	"strings"
+	"time"
 
+	"github.com/samber/lo"
 	"github.com/spf13/cobra"
+	"github.com/torchsecurity/torch-secret-analyzer/pkg/clients"
 	"github.com/torchsecurity/torch-secret-analyzer/pkg/collectors/aws_cloudtrail"
+	"github.com/torchsecurity/torch-secret-analyzer/pkg/collectors/aws_iam"
+	"github.com/torchsecurity/torch-secret-analyzer/pkg/collectors/aws_organizations"
+	"github.com/torchsecurity/torch-secret-analyzer/pkg/collectors/aws_secretsmanager"
 	"github.com/torchsecurity/torch-secret-analyzer/pkg/engines"
 	"github.com/torchsecurity/torch-secret-analyzer/pkg/utils/colors"
 	timeutil "github.com/torchsecurity/torch-secret-analyzer/pkg/utils/time"
@@ -28,58 +37,524 @@ var listActualCommand = &cobra.Command{
 	Short: "List AWS secret's actual consumers",
 	Long:  `Torch analyzes AWS Cloudtrail events and crosses information with AWS Secrets Manager to identify who are the "consumers" of a given secrets in a given timeframe`,
 	Run: func(cmd *cobra.Command, args []string) {
+		if err := validateOutputFormat(outputFormat); err != nil {
+			fmt.Fprintf(os.Stderr, colors.Red("Could not list AWS actual consumers: %v\n"), err)
+			return
+		}
+		if allSecrets {
+			listAllActualConsumers(cmd)
+			return
+		}
 		if secretId == "" {
 			fmt.Println(cmd.UsageString())
 			return
 		}
-		fmt.Printf("Listing all actual consumers of the secret '%s' based on AWS CloudTrail Events, filtering for read events in the last %d days:\n", secretId, daysBack)
-		cloudtrailEvents, err := aws_cloudtrail.CollectCloudTrail(region, daysBack, profileToUse)
+		// Progress is printed to stderr, so that stdout only holds the consumers in the requested output format
+		fmt.Fprintf(os.Stderr, "Listing all actual consumers of the secret '%s' based on %s:\n", secretId, describeCloudTrailSource(cmd, "read"))
+		cloudtrailEvents, err := collectCloudTrail(cmd, secretId, aws_cloudtrail.ReadEvents)
 		if err != nil {
-			fmt.Printf(colors.Red("Could not list AWS actual consumers: %w"), err)
+			fmt.Fprintf(os.Stderr, colors.Red("Could not list AWS actual consumers: %v\n"), err)
 			return
 		}
 
-		actualConsumers := engines.GetAWSActualConsumers(cloudtrailEvents, secretId)
-		var humanConsumers []engines.Consumer
-		var machineConsumers []engines.Consumer
-		for _, consumer := range actualConsumers {
-			if consumer.Category == engines.HumanConsumer {
-				humanConsumers = append(humanConsumers, consumer)
-			} else {
-				machineConsumers = append(machineConsumers, consumer)
-			}
+		resolvers, err := consumerResolvers(cmd)
+		if err != nil {
+			fmt.Fprintf(os.Stderr, colors.Red("Could not list AWS actual consumers: %v\n"), err)
+			return
 		}
-
-		if len(humanConsumers) > 0 {
-			fmt.Print("\nHuman:\n")
-			for _, consumer := range humanConsumers {
-				fmt.Printf("* %s (last read on %s) (%s)\n", consumer.Name, timeutil.FormatTime(consumer.AccessedResourceAt), consumer.Type)
-			}
+		actualConsumers := engines.GetAWSActualConsumers(cloudtrailEvents, secretId, resolvers...)
+		engines.SetAccountAliases(actualConsumers, accountAliases)
+		unattributed := engines.CountUnattributedConsumers(actualConsumers)
+		exitOnUnattributed(unattributed, "list AWS actual consumers")
+		defer printUnattributedSummary(unattributed)
+		if outputFormat == tableOutput {
+			printConsumersByCategory(actualConsumers, describeActualConsumer)
+			return
 		}
-
-		if len(machineConsumers) > 0 {
-			fmt.Print("\nMachine:\n")
-			for _, consumer := range machineConsumers {
-				fmt.Printf("* %s (last read on %s) (%s)\n", consumer.Name, timeutil.FormatTime(consumer.AccessedResourceAt), consumer.Type)
+		// Serialize no consumers as an empty list rather than null
+		actualConsumers = lo.Ternary(actualConsumers == nil, []engines.Consumer{}, actualConsumers)
+		err = writeOutput(os.Stdout, outputFormat, actualConsumers, func() [][]string {
+			rows := [][]string{consumerCSVHeader}
+			for _, consumer := range actualConsumers {
+				rows = append(rows, consumerCSVRow(consumer))
 			}
+			return rows
+		})
+		if err != nil {
+			fmt.Fprintf(os.Stderr, colors.Red("Could not write AWS actual consumers: %v\n"), err)
 		}
 	},
 }
 
-// list-actual flags
+// list-actual and diff flags
 var (
-	daysBack int
+	daysBack          int
+	allSecrets        bool
+	outputFormat      string
+	strictAttribution bool
 )
 
+func listAllActualConsumers(cmd *cobra.Command) {
+	fmt.Fprintf(os.Stderr, "Listing all actual consumers of all secrets based on %s:\n", describeCloudTrailSource(cmd, "read"))
+	cloudtrailEvents, err := collectCloudTrail(cmd, "", aws_cloudtrail.ReadEvents)
+	if err != nil {
+		fmt.Fprintf(os.Stderr, colors.Red("Could not list AWS actual consumers: %v\n"), err)
+		return
+	}
+
+	resolvers, err := consumerResolvers(cmd)
+	if err != nil {
+		fmt.Fprintf(os.Stderr, colors.Red("Could not list AWS actual consumers: %v\n"), err)
+		return
+	}
+	consumersBySecret := engines.GetAWSActualConsumersBySecret(cloudtrailEvents, resolvers...)
+	var unattributed int
+	for _, consumers := range consumersBySecret {
+		engines.SetAccountAliases(consumers, accountAliases)
+		unattributed += engines.CountUnattributedConsumers(consumers)
+	}
+	exitOnUnattributed(unattributed, "list AWS actual consumers")
+	defer printUnattributedSummary(unattributed)
+	secrets := lo.Keys(consumersBySecret)
+	sort.Strings(secrets)
+	if outputFormat == tableOutput {
+		for _, secret := range secrets {
+			fmt.Printf("\nSecret '%s':\n", secret)
+			printConsumersByCategory(consumersBySecret[secret], describeActualConsumer)
+		}
+		return
+	}
+	err = writeOutput(os.Stdout, outputFormat, consumersBySecret, func() [][]string {
+		rows := [][]string{append([]string{"secret"}, consumerCSVHeader...)}
+		for _, secret := range secrets {
+			for _, consumer := range consumersBySecret[secret] {
+				rows = append(rows, append([]string{secret}, consumerCSVRow(consumer)...))
+			}
+		}
+		return rows
+	})
+	if err != nil {
+		fmt.Fprintf(os.Stderr, colors.Red("Could not write AWS actual consumers: %v\n"), err)
+	}
+}
+
 var listPotentialCommand = &cobra.Command{
 	Use:   "list-potential",
 	Short: "List AWS secret's potential consumers",
 	Long:  "Torch analyzes and correlates data across AWS IAM and AWS Secrets Manager to identify users and services with permission to access a certain secret",
 	Run: func(cmd *cobra.Command, args []string) {
-		fmt.Println(colors.Yellow("Coming soon!"))
+		if err := validateOutputFormat(outputFormat); err != nil {
+			fmt.Fprintf(os.Stderr, colors.Red("Could not list AWS potential consumers: %v\n"), err)
+			return
+		}
+		if secretId == "" {
+			fmt.Println(cmd.UsageString())
+			return
+		}
+		fmt.Fprintf(os.Stderr, "Listing all potential consumers of the secret '%s' based on AWS IAM policies:\n", secretId)
+		potentialConsumers, err := listPotentialConsumers()
+		if err != nil {
+			fmt.Fprintf(os.Stderr, colors.Red("Could not list AWS potential consumers: %v\n"), err)
+			return
+		}
+
+		if outputFormat == tableOutput {
+			printConsumersByCategory(potentialConsumers, describePotentialConsumer)
+			return
+		}
+		potentialConsumers = lo.Ternary(potentialConsumers == nil, []engines.Consumer{}, potentialConsumers)
+		err = writeOutput(os.Stdout, outputFormat, potentialConsumers, func() [][]string {
+			rows := [][]string{append(append([]string{}, consumerCSVHeader...), "access", "access_reason")}
+			for _, consumer := range potentialConsumers {
+				rows = append(rows, append(consumerCSVRow(consumer), string(consumer.Access), consumer.AccessReason))
+			}
+			return rows
+		})
+		if err != nil {
+			fmt.Fprintf(os.Stderr, colors.Red("Could not write AWS potential consumers: %v\n"), err)
+		}
+	},
+}
+
+var diffCommand = &cobra.Command{
+	Use:   "diff",
+	Short: "Compare AWS secret's potential and actual consumers",
+	Long:  "Torch compares the consumers allowed to access a certain secret by AWS IAM policies with the consumers that actually read it in a given timeframe, to find unused and unexpected access",
+	Run: func(cmd *cobra.Command, args []string) {
+		if secretId == "" {
+			fmt.Println(cmd.UsageString())
+			return
+		}
+		fmt.Printf("Comparing the potential consumers of the secret '%s' with its actual consumers based on %s:\n", secretId, describeCloudTrailSource(cmd, "read"))
+		potentialConsumers, err := listPotentialConsumers()
+		if err != nil {
+			fmt.Printf(colors.Red("Could not list AWS potential consumers: %v\n"), err)
+			return
+		}
+		cloudtrailEvents, err := collectCloudTrail(cmd, secretId, aws_cloudtrail.ReadEvents)
+		if err != nil {
+			fmt.Printf(colors.Red("Could not list AWS actual consumers: %v\n"), err)
+			return
+		}
+
+		resolvers, err := consumerResolvers(cmd)
+		if err != nil {
+			fmt.Printf(colors.Red("Could not list AWS actual consumers: %v\n"), err)
+			return
+		}
+		actualConsumers := engines.GetAWSActualConsumers(cloudtrailEvents, secretId, resolvers...)
+		engines.SetAccountAliases(actualConsumers, accountAliases)
+		diff := engines.DiffAWSConsumers(actualConsumers, potentialConsumers)
+		exitOnUnattributed(len(diff.Unattributed), "compare AWS consumers")
+
+		fmt.Printf("\nAllowed, but did not read the secret (%d):\n", len(diff.Unused))
+		for _, consumer := range diff.Unused {
+			fmt.Printf("* %s\n", describePotentialConsumer(consumer))
+		}
+		fmt.Printf("\nRead the secret and allowed (%d):\n", len(diff.Expected))
+		for _, consumer := range diff.Expected {
+			fmt.Printf("* %s\n", describeActualConsumer(consumer))
+		}
+		fmt.Printf("\nRead the secret, but not allowed according to the policies (%d):\n", len(diff.Unexplained))
+		for _, consumer := range diff.Unexplained {
+			fmt.Printf("* %s\n", colors.Red(describeActualConsumer(consumer)))
+		}
+		fmt.Printf("\nRead the secret, but could not be attributed to a consumer (%d):\n", len(diff.Unattributed))
+		for _, consumer := range diff.Unattributed {
+			fmt.Printf("* %s\n", colors.Yellow(describeUnattributedRead(consumer)))
+		}
+	},
+}
+
+var listWritersCommand = &cobra.Command{
+	Use:   "list-writers",
+	Short: "List AWS secret's writers",
+	Long:  "Torch analyzes AWS Cloudtrail events to identify who created, modified, rotated, deleted or re-permissioned a given secret in a given timeframe",
+	Run: func(cmd *cobra.Command, args []string) {
+		if err := validateOutputFormat(outputFormat); err != nil {
+			fmt.Fprintf(os.Stderr, colors.Red("Could not list AWS secret writers: %v\n"), err)
+			return
+		}
+		if secretId == "" {
+			fmt.Println(cmd.UsageString())
+			return
+		}
+		fmt.Fprintf(os.Stderr, "Listing all writers of the secret '%s' based on %s:\n", secretId, describeCloudTrailSource(cmd, "write"))
+		cloudtrailEvents, err := collectCloudTrail(cmd, secretId, aws_cloudtrail.WriteEvents)
+		if err != nil {
+			fmt.Fprintf(os.Stderr, colors.Red("Could not list AWS secret writers: %v\n"), err)
+			return
+		}
+
+		resolvers, err := consumerResolvers(cmd)
+		if err != nil {
+			fmt.Fprintf(os.Stderr, colors.Red("Could not list AWS secret writers: %v\n"), err)
+			return
+		}
+		writes := engines.GetAWSSecretWriters(cloudtrailEvents, secretId, resolvers...)
+		var unattributed int
+		for i := range writes {
+			writes[i].Writer.AccountAlias = accountAliases[writes[i].Writer.AccountId]
+			if writes[i].Writer.Category == engines.UnattributedConsumer {
+				unattributed++
+			}
+		}
+		exitOnUnattributed(unattributed, "list AWS secret writers")
+		defer printUnattributedSummary(unattributed)
+		if outputFormat == tableOutput {
+			fmt.Println()
+			for _, write := range writes {
+				if write.Failed() {
+					fmt.Printf("* %s\n", colors.Yellow(fmt.Sprintf("%s failed to be %s by %s [error: %s]", timeutil.FormatTime(write.EventTime), write.Action, describePrincipal(write.Writer), write.ErrorCode)))
+					continue
+				}
+				fmt.Printf("* %s %s by %s\n", timeutil.FormatTime(write.EventTime), write.Action, describePrincipal(write.Writer))
+			}
+			return
+		}
+		writes = lo.Ternary(writes == nil, []engines.SecretWrite{}, writes)
+		err = writeOutput(os.Stdout, outputFormat, writes, func() [][]string {
+			rows := [][]string{append([]string{"event_name", "action", "event_time", "error_code"}, consumerCSVHeader...)}
+			for _, write := range writes {
+				rows = append(rows, append([]string{write.EventName, string(write.Action), timeutil.FormatTime(write.EventTime), write.ErrorCode}, consumerCSVRow(write.Writer)...))
+			}
+			return rows
+		})
+		if err != nil {
+			fmt.Fprintf(os.Stderr, colors.Red("Could not write AWS secret writers: %v\n"), err)
+		}
+	},
+}
+
+var anomaliesCommand = &cobra.Command{
+	Use:   "anomalies",
+	Short: "Detect anomalies in the access to an AWS secret",
+	Long:  "Torch compares the reads of a given secret in the last days (the detection period) with the days before them (the baseline period), to flag new consumers, humans reading machine-only secrets, reads from new source IPs or ASNs, reads outside of a consumer's usual hours and read volume spikes",
+	Run: func(cmd *cobra.Command, args []string) {
+		if err := validateOutputFormat(outputFormat); err != nil {
+			fmt.Fprintf(os.Stderr, colors.Red("Could not detect AWS access anomalies: %v\n"), err)
+			return
+		}
+		if secretId == "" {
+			fmt.Println(cmd.UsageString())
+			return
+		}
+		if detectionDays <= 0 || detectionDays >= daysBack {
+			fmt.Fprintf(os.Stderr, colors.Red("Could not detect AWS access anomalies: the detection period (%d days) must be shorter than --days-back (%d days)\n"), detectionDays, daysBack)
+			return
+		}
+		fmt.Fprintf(os.Stderr, "Detecting anomalies in the access to the secret '%s' in the last %d days, compared with the %d days before, based on %s:\n",
+			secretId, detectionDays, daysBack-detectionDays, describeCloudTrailSource(cmd, "read"))
+		cloudtrailEvents, err := collectCloudTrail(cmd, secretId, aws_cloudtrail.ReadEvents)
+		if err != nil {
+			fmt.Fprintf(os.Stderr, colors.Red("Could not detect AWS access anomalies: %v\n"), err)
+			return
+		}
+		resolvers, err := consumerResolvers(cmd)
+		if err != nil {
+			fmt.Fprintf(os.Stderr, colors.Red("Could not detect AWS access anomalies: %v\n"), err)
+			return
+		}
+
+		periods := anomalyPeriods(cloudtrailEvents)
+		unattributed := engines.CountUnattributedReads(cloudtrailEvents, secretId, periods)
+		exitOnUnattributed(unattributed, "detect AWS access anomalies")
+		defer printUnattributedSummary(unattributed)
+		anomalies, err := engines.DetectAWSAccessAnomalies(cloudtrailEvents, secretId, periods, resolvers...)
+		if err != nil {
+			fmt.Fprintf(os.Stderr, colors.Yellow("Could not detect AWS access anomalies: %v\n"), err)
+			return
+		}
+		for i := range anomalies {
+			anomalies[i].Consumer.AccountAlias = accountAliases[anomalies[i].Consumer.AccountId]
+		}
+		if outputFormat == tableOutput {
+			fmt.Printf("\nAnomalies (%d):\n", len(anomalies))
+			for _, anomaly := range anomalies {
+				fmt.Printf("* %s [%s] %s: %s\n", timeutil.FormatTime(anomaly.DetectedAt), anomaly.Kind, describePrincipal(anomaly.Consumer), colors.Yellow(anomaly.Reason))
+			}
+			return
+		}
+		anomalies = lo.Ternary(anomalies == nil, []engines.AccessAnomaly{}, anomalies)
+		err = writeOutput(os.Stdout, outputFormat, anomalies, func() [][]string {
+			rows := [][]string{append([]string{"detected_at", "kind", "reason"}, consumerCSVHeader...)}
+			for _, anomaly := range anomalies {
+				rows = append(rows, append([]string{timeutil.FormatTime(anomaly.DetectedAt), string(anomaly.Kind), anomaly.Reason}, consumerCSVRow(anomaly.Consumer)...))
+			}
+			return rows
+		})
+		if err != nil {
+			fmt.Fprintf(os.Stderr, colors.Red("Could not write AWS access anomalies: %v\n"), err)
+		}
 	},
 }
 
+// anomalies flags
+var detectionDays int
+
+// anomalyPeriods splits the collection window into the baseline and detection periods.
+// Log files are analyzed offline, so their window ends with their last read rather than now.
+func anomalyPeriods(cloudtrailEvents aws_cloudtrail.EventsByName) engines.AnomalyPeriods {
+	end := time.Now()
+	if len(cloudtrailFiles) > 0 {
+		if reads := cloudtrailEvents[aws_cloudtrail.GetSecretValueEvent]; len(reads) > 0 {
+			end = lo.MaxBy(reads, func(a clients.CloudtrailEvent, b clients.CloudtrailEvent) bool {
+				return a.EventTime.After(b.EventTime)
+			}).EventTime
+		}
+	}
+	return engines.AnomalyPeriods{
+		BaselineStart:  end.AddDate(0, 0, -daysBack),
+		DetectionStart: end.AddDate(0, 0, -detectionDays),
+		DetectionEnd:   end,
+	}
+}
+
+func listPotentialConsumers() ([]engines.Consumer, error) {
+	secretDetails, err := aws_secretsmanager.CollectSecret(region, profileToUse, secretId)
+	if err != nil {
+		return nil, err
+	}
+	authorizationDetails, err := aws_iam.CollectIAM(region, profileToUse)
+	if err != nil {
+		return nil, err
+	}
+	// The organization is only used to resolve aws:PrincipalOrgID conditions, so we can do without it
+	organization, err := aws_organizations.CollectOrganization(region, profileToUse)
+	if err != nil {
+		fmt.Printf(colors.Yellow("Could not describe the AWS organization, aws:PrincipalOrgID conditions will not be resolved: %v\n"), err)
+	}
+
+	return engines.GetAWSPotentialConsumers(authorizationDetails, secretDetails, organization), nil
+}
+
+func describeActualConsumer(consumer engines.Consumer) string {
+	lastRead := timeutil.FormatTime(consumer.AccessedResourceAt)
+	if consumer.Region != "" {
+		lastRead += " in " + consumer.Region
+	}
+	line := fmt.Sprintf("%s (last read on %s) (%s)", consumer.Name, lastRead, consumer.Type)
+	if consumer.ReadCount > 0 {
+		line += fmt.Sprintf(" [reads: %d, first read on %s, source IPs: %d, user agents: %d, access keys: %d]",
+			consumer.ReadCount, timeutil.FormatTime(consumer.FirstAccessedAt), len(consumer.SourceIpAddresses), len(consumer.UserAgents), len(consumer.AccessKeyIds))
+	}
+	if len(consumer.Clients) > 0 {
+		line += fmt.Sprintf(" [clients: %s]", strings.Join(consumer.Clients, ", "))
+	}
+	if consumer.AccountAlias != "" {
+		line += fmt.Sprintf(" [account: %s (%s)]", consumer.AccountAlias, consumer.AccountId)
+	}
+	line += describeSSOUser(consumer)
+	if len(consumer.IdentityChain) > 0 {
+		line += fmt.Sprintf(" [via: %s]", describeIdentityChain(consumer.IdentityChain))
+	}
+	if len(consumer.NetworkOrigins) > 0 {
+		// Reads from the public internet are the ones to look into, so they are highlighted
+		networks := lo.Map(consumer.NetworkOrigins, func(origin engines.NetworkOrigin, _ int) string {
+			return lo.Ternary(origin.Kind == engines.PublicInternetNetwork, colors.Red(describeNetworkOrigin(origin)), describeNetworkOrigin(origin))
+		})
+		line += fmt.Sprintf(" [networks: %s]", strings.Join(networks, ", "))
+	}
+	return line
+}
+
+// describeNetworkOrigin describes a network a consumer read from (e.g. "203.0.113.7 (Public Internet, US, AS64496 Example, reads: 3)").
+func describeNetworkOrigin(origin engines.NetworkOrigin) string {
+	details := []string{string(origin.Kind)}
+	if origin.Country != "" {
+		details = append(details, origin.Country)
+	}
+	if origin.ASN != 0 {
+		details = append(details, strings.TrimSpace(fmt.Sprintf("AS%d %s", origin.ASN, origin.ASOrganization)))
+	}
+	return fmt.Sprintf("%s (%s, reads: %d)", origin.Source, strings.Join(details, ", "), origin.Reads)
+}
+
+func describeSSOUser(consumer engines.Consumer) string {
+	if len(consumer.PermissionSets) == 0 {
+		return ""
+	}
+	line := fmt.Sprintf(" [permission sets: %s]", strings.Join(consumer.PermissionSets, ", "))
+	if consumer.DisplayName != "" {
+		line += fmt.Sprintf(" [user: %s, groups: %s]", consumer.DisplayName, strings.Join(consumer.Groups, ", "))
+	}
+	return line
+}
+
+// describeIdentityChain describes a role chain from the originating identity to the consumer's role.
+func describeIdentityChain(chain []engines.IdentityLink) string {
+	if len(chain) == 0 {
+		return ""
+	}
+	identities := []string{chain[0].Arn}
+	for _, link := range chain {
+		identities = append(identities, link.AssumedRole)
+	}
+	return strings.Join(identities, " -> ")
+}
+
+// describePrincipal describes a consumer by its identity, without read stats (e.g. the writer of a secret).
+func describePrincipal(principal engines.Consumer) string {
+	if principal.Category == engines.UnattributedConsumer {
+		return describeUnattributedConsumer(principal)
+	}
+	line := fmt.Sprintf("%s (%s)", principal.Name, principal.Type)
+	if principal.Region != "" {
+		line += " in " + principal.Region
+	}
+	if principal.AccountAlias != "" {
+		line += fmt.Sprintf(" [account: %s (%s)]", principal.AccountAlias, principal.AccountId)
+	}
+	line += describeSSOUser(principal)
+	if len(principal.IdentityChain) > 0 {
+		line += fmt.Sprintf(" [via: %s]", describeIdentityChain(principal.IdentityChain))
+	}
+	return line
+}
+
+// describeUnattributedConsumer describes the raw identity of an event that could not be attributed to a consumer.
+func describeUnattributedConsumer(consumer engines.Consumer) string {
+	return fmt.Sprintf("%s (%s) [arn: %s, event id: %s]",
+		consumer.Name, lo.CoalesceOrEmpty(consumer.Type, "unknown type"), lo.CoalesceOrEmpty(consumer.ExternalResourceName, "none"), consumer.EventId)
+}
+
+func describeUnattributedRead(consumer engines.Consumer) string {
+	line := fmt.Sprintf("%s (read on %s", describeUnattributedConsumer(consumer), timeutil.FormatTime(consumer.AccessedResourceAt))
+	if consumer.Region != "" {
+		line += " in " + consumer.Region
+	}
+	return line + ")"
+}
+
+func describePotentialConsumer(consumer engines.Consumer) string {
+	line := fmt.Sprintf("%s (%s)", consumer.Name, consumer.Type)
+	switch consumer.Access {
+	case engines.ConditionalAccess:
+		line += colors.Yellow(fmt.Sprintf(" [conditional: %s]", consumer.AccessReason))
+	case engines.BlockedByKMSAccess:
+		line += colors.Red(fmt.Sprintf(" [blocked by KMS: %s]", consumer.AccessReason))
+	}
+	return line
+}
+
+func printConsumersByCategory(consumers []engines.Consumer, describeConsumer func(consumer engines.Consumer) string) {
+	var humanConsumers []engines.Consumer
+	var machineConsumers []engines.Consumer
+	var unattributedConsumers []engines.Consumer
+	for _, consumer := range consumers {
+		switch consumer.Category {
+		case engines.HumanConsumer:
+			humanConsumers = append(humanConsumers, consumer)
+		case engines.UnattributedConsumer:
+			unattributedConsumers = append(unattributedConsumers, consumer)
+		default:
+			machineConsumers = append(machineConsumers, consumer)
+		}
+	}
+
+	if len(humanConsumers) > 0 {
+		fmt.Print("\nHuman:\n")
+		for _, consumer := range humanConsumers {
+			fmt.Printf("* %s\n", describeConsumer(consumer))
+		}
+	}
+
+	if len(machineConsumers) > 0 {
+		fmt.Print("\nMachine:\n")
+		for _, consumer := range machineConsumers {
+			fmt.Printf("* %s\n", describeConsumer(consumer))
+		}
+	}
+
+	// Unattributed events are listed with their raw identity, so that the readers they hide can be investigated
+	if len(unattributedConsumers) > 0 {
+		fmt.Print("\nUnattributed:\n")
+		for _, consumer := range unattributedConsumers {
+			fmt.Printf("* %s\n", colors.Yellow(describeUnattributedRead(consumer)))
+		}
+	}
+}
+
+func addStrictFlag(cmd *cobra.Command) {
+	cmd.Flags().BoolVar(&strictAttribution, "strict", false, "Fail when some of the events could not be attributed to a consumer, instead of listing them as unattributed.")
+}
+
+// exitOnUnattributed fails the run in strict mode, when some of the events could not be attributed to a consumer.
+func exitOnUnattributed(unattributed int, action string) {
+	if !strictAttribution || unattributed == 0 {
+		return
+	}
+	fmt.Fprintf(os.Stderr, colors.Red("Could not %s: %d events could not be attributed to a consumer (--strict)\n"), action, unattributed)
+	os.Exit(1)
+}
+
+// printUnattributedSummary prints the number of events that could not be attributed to a consumer.
+// It's printed to stderr in machine readable formats, so that stdout only holds the requested output.
+func printUnattributedSummary(unattributed int) {
+	w := lo.Ternary(outputFormat == tableOutput, os.Stdout, os.Stderr)
+	fmt.Fprintf(w, "\nUnattributed events: %d\n", unattributed)
+}
+
 func init() {
 	consumersCommand.PersistentFlags().StringVarP(&secretId, "secret-id", "s", "", "AWS secret ID (required).")
 	consumersCommand.MarkFlagRequired("secret-id")
@@ -87,7 +562,31 @@ func init() {
 	consumersCommand.PersistentFlags().StringVarP(&profileToUse, "profile", "p", "", "The AWS profile the CLI tool should use (will use the active aws profile by default).")
 
 	listActualCommand.Flags().IntVarP(&daysBack, "days-back", "d", 14, "The amount of days back to query AWS cloudtrail for its events (14 by default).")
+	listActualCommand.Flags().StringVarP(&outputFormat, "output", "o", tableOutput, "The output format: table, json, yaml or csv (table by default).")
+	listActualCommand.Flags().BoolVar(&allSecrets, "all", false, "List the actual consumers of all secrets in the region instead of a single secret.")
+	listPotentialCommand.Flags().StringVarP(&outputFormat, "output", "o", tableOutput, "The output format: table, json, yaml or csv (table by default).")
+	diffCommand.Flags().IntVarP(&daysBack, "days-back", "d", 14, "The amount of days back to query AWS cloudtrail for its events (14 by default).")
+	listWritersCommand.Flags().IntVarP(&daysBack, "days-back", "d", 14, "The amount of days back to query AWS cloudtrail for its events (14 by default).")
+	listWritersCommand.Flags().StringVarP(&outputFormat, "output", "o", tableOutput, "The output format: table, json, yaml or csv (table by default).")
+	anomaliesCommand.Flags().IntVarP(&daysBack, "days-back", "d", 14, "The amount of days back to query AWS cloudtrail for its events (14 by default).")
+	anomaliesCommand.Flags().IntVar(&detectionDays, "detection-days", 1, "The amount of last days to detect anomalies in, compared with the rest of the days back (1 by default).")
+	anomaliesCommand.Flags().StringVarP(&outputFormat, "output", "o", tableOutput, "The output format: table, json, yaml or csv (table by default).")
+	addCloudTrailSourceFlags(listActualCommand)
+	addCloudTrailSourceFlags(diffCommand)
+	addCloudTrailSourceFlags(listWritersCommand)
+	addCloudTrailSourceFlags(anomaliesCommand)
+	addResolverFlags(listActualCommand)
+	addResolverFlags(diffCommand)
+	addResolverFlags(listWritersCommand)
+	addResolverFlags(anomaliesCommand)
+	addStrictFlag(listActualCommand)
+	addStrictFlag(diffCommand)
+	addStrictFlag(listWritersCommand)
+	addStrictFlag(anomaliesCommand)
 
 	consumersCommand.AddCommand(listActualCommand)
 	consumersCommand.AddCommand(listPotentialCommand)
+	consumersCommand.AddCommand(diffCommand)
+	consumersCommand.AddCommand(listWritersCommand)
+	consumersCommand.AddCommand(anomaliesCommand)
 }
@@ -0,0 +1,81 @@
+package aws
+
+import (
+	"encoding/csv"
+	"encoding/json"
+	"fmt"
+	"io"
+	"strconv"
+	"strings"
+
+	"github.com/samber/lo"
+	"github.com/torchsecurity/torch-secret-analyzer/pkg/engines"
+	timeutil "github.com/torchsecurity/torch-secret-analyzer/pkg/utils/time"
+	"gopkg.in/yaml.v3"
+)
+
+const (
+	tableOutput = "table"
+	jsonOutput  = "json"
+	yamlOutput  = "yaml"
+	csvOutput   = "csv"
+)
+
+var outputFormats = []string{tableOutput, jsonOutput, yamlOutput, csvOutput}
+
+func validateOutputFormat(format string) error {
+	if !lo.Contains(outputFormats, format) {
+		return fmt.Errorf("unsupported output format '%s', expected one of %v", format, outputFormats)
+	}
+	return nil
+}
+
+// writeOutput serializes a value in a machine readable format.
+// As CSV is flat, the caller provides the rows (including the header) to write in that format.
+func writeOutput(w io.Writer, format string, value any, csvRows func() [][]string) error {
+	switch format {
+	case jsonOutput:
+		encoder := json.NewEncoder(w)
+		encoder.SetIndent("", "  ")
+		return encoder.Encode(value)
+	case yamlOutput:
+		encoder := yaml.NewEncoder(w)
+		defer encoder.Close()
+		return encoder.Encode(value)
+	case csvOutput:
+		writer := csv.NewWriter(w)
+		return writer.WriteAll(csvRows())
+	}
+	return fmt.Errorf("output format '%s' is not machine readable", format)
+}
+
+var consumerCSVHeader = []string{"category", "type", "name", "external_id", "arn", "access_key_id", "last_accessed_at", "region", "account_id", "account_alias", "first_accessed_at", "read_count", "source_ip_addresses", "user_agents", "access_key_ids", "identity_chain", "permission_sets", "email", "display_name", "groups", "unattributed_event_id", "network_origins", "clients"}
+
+func consumerCSVRow(consumer engines.Consumer) []string {
+	return []string{
+		string(consumer.Category),
+		consumer.Type,
+		consumer.Name,
+		consumer.ExternalId,
+		consumer.ExternalResourceName,
+		consumer.AccessKeyId,
+		timeutil.FormatTime(consumer.AccessedResourceAt),
+		consumer.Region,
+		consumer.AccountId,
+		consumer.AccountAlias,
+		lo.Ternary(consumer.FirstAccessedAt.IsZero(), "", timeutil.FormatTime(consumer.FirstAccessedAt)),
+		strconv.Itoa(consumer.ReadCount),
+		// Multiple values are separated by semicolons, as user agents might contain commas
+		strings.Join(consumer.SourceIpAddresses, ";"),
+		strings.Join(consumer.UserAgents, ";"),
+		strings.Join(consumer.AccessKeyIds, ";"),
+		describeIdentityChain(consumer.IdentityChain),
+		strings.Join(consumer.PermissionSets, ";"),
+		consumer.Email,
+		consumer.DisplayName,
+		strings.Join(consumer.Groups, ";"),
+		consumer.EventId,
+		strings.Join(lo.Map(consumer.NetworkOrigins, func(origin engines.NetworkOrigin, _ int) string { return describeNetworkOrigin(origin) }), ";"),
+		strings.Join(consumer.Clients, ";"),
+	}
+}
@@ -0,0 +1,101 @@
+package aws
+
+import (
+	"bytes"
+	"testing"
+	"time"
+
+	"github.com/torchsecurity/torch-secret-analyzer/pkg/engines"
+)
+
+func TestWriteOutput(t *testing.T) {
+	consumers := []engines.Consumer{{
+		Category:             engines.MachineConsumer,
+		Type:                 "AWS IAM Role",
+		Name:                 "app",
+		ExternalId:           "AROAAPP",
+		ExternalResourceName: "arn:aws:iam::111111111111:role/app",
+		AccessedResourceAt:   time.Date(2024, 10, 1, 10, 0, 0, 0, time.UTC),
+		UserAgents:           []string{"aws-sdk-go-v2/1.30.0, extra", "aws-cli/2.17.0"},
+	}}
+	csvRows := func() [][]string {
+		rows := [][]string{consumerCSVHeader}
+		for _, consumer := range consumers {
+			rows = append(rows, consumerCSVRow(consumer))
+		}
+		return rows
+	}
+
+	tests := []struct {
+		format string
+		output string
+	}{
+		{
+			format: jsonOutput,
+			output: `[
+  {
+    "category": "Machine",
+    "type": "AWS IAM Role",
+    "name": "app",
+    "externalId": "AROAAPP",
+    "arn": "arn:aws:iam::111111111111:role/app",
+    "lastAccessedAt": "2024-10-01T10:00:00Z",
+    "userAgents": [
+      "aws-sdk-go-v2/1.30.0, extra",
+      "aws-cli/2.17.0"
+    ]
+  }
+]
+`,
+		},
+		{
+			format: yamlOutput,
+			output: `- category: Machine
+  type: AWS IAM Role
+  name: app
+  externalId: AROAAPP
+  arn: arn:aws:iam::111111111111:role/app
+  lastAccessedAt: 2024-10-01T10:00:00Z
+  userAgents:
+    - aws-sdk-go-v2/1.30.0, extra
+    - aws-cli/2.17.0
+`,
+		},
+		{
+			format: csvOutput,
+			output: `category,type,name,external_id,arn,access_key_id,last_accessed_at,region,account_id,account_alias,first_accessed_at,read_count,source_ip_addresses,user_agents,access_key_ids,identity_chain,permission_sets,email,display_name,groups,unattributed_event_id,network_origins,clients
+Machine,AWS IAM Role,app,AROAAPP,arn:aws:iam::111111111111:role/app,,2024-10-01T10:00:00Z,,,,,0,,"aws-sdk-go-v2/1.30.0, extra;aws-cli/2.17.0",,,,,,,,,
+`,
+		},
+	}
+
+	for _, test := range tests {
+		t.Run(test.format, func(t *testing.T) {
+			var output bytes.Buffer
+			if err := writeOutput(&output, test.format, consumers, csvRows); err != nil {
+				t.Fatal(err)
+			}
+			if output.String() != test.output {
+				t.Errorf("expected the output:\n%s\ngot:\n%s", test.output, output.String())
+			}
+		})
+	}
+}
+
+func TestValidateOutputFormat(t *testing.T) {
+	for format, valid := range map[string]bool{
+		tableOutput: true,
+		jsonOutput:  true,
+		yamlOutput:  true,
+		csvOutput:   true,
+		"xml":       false,
+		"":          false,
+	} {
+		if err := validateOutputFormat(format); (err == nil) != valid {
+			t.Errorf("validateOutputFormat(%q) = %v, expected valid: %v", format, err, valid)
+		}
+	}
+	if err := writeOutput(&bytes.Buffer{}, tableOutput, nil, nil); err == nil {
+		t.Error("expected an error writing the table format, which isn't machine readable")
+	}
+}
@@ -0,0 +1,132 @@
+package aws
+
+import (
+	"fmt"
+	"os"
+
+	"github.com/spf13/cobra"
+	"github.com/torchsecurity/torch-secret-analyzer/pkg/clients"
+	"github.com/torchsecurity/torch-secret-analyzer/pkg/collectors/aws_cloudtrail"
+	"github.com/torchsecurity/torch-secret-analyzer/pkg/collectors/aws_ec2"
+	"github.com/torchsecurity/torch-secret-analyzer/pkg/collectors/aws_ecs"
+	"github.com/torchsecurity/torch-secret-analyzer/pkg/collectors/aws_eks"
+	"github.com/torchsecurity/torch-secret-analyzer/pkg/collectors/aws_iam"
+	"github.com/torchsecurity/torch-secret-analyzer/pkg/collectors/aws_identitystore"
+	"github.com/torchsecurity/torch-secret-analyzer/pkg/collectors/aws_lambda"
+	"github.com/torchsecurity/torch-secret-analyzer/pkg/engines"
+	"github.com/torchsecurity/torch-secret-analyzer/pkg/utils/colors"
+)
+
+// Resolver flags, shared between the commands that list actual consumers
+var (
+	resolveWorkloads bool
+	resolveChains    bool
+	identityStoreId  string
+
+	classificationRulesFile string
+	networksFile            string
+	geoIPDatabaseFiles      []string
+)
+
+func addResolverFlags(cmd *cobra.Command) {
+	cmd.Flags().BoolVar(&resolveWorkloads, "resolve-workloads", false, "Name the workloads behind role sessions (EKS service accounts, Lambda functions, ECS tasks and EC2 instances), which requires read access to AWS IAM, EKS, Lambda, ECS and EC2.")
+	cmd.Flags().BoolVar(&resolveChains, "resolve-chains", false, "Follow role sessions back to the identity that originally assumed a role, through the AssumeRole events of the same CloudTrail source.")
+	cmd.Flags().StringVar(&identityStoreId, "identity-store-id", "", "The IAM Identity Center identity store to enrich SSO users with their display name and groups from (e.g. d-1234567890).")
+	cmd.Flags().StringVar(&classificationRulesFile, "classification-rules", "", "A YAML file of rules that classify consumers, evaluated before the built-in rules.")
+	cmd.Flags().StringVar(&networksFile, "networks", "", "A YAML file of our own networks by their CIDR ranges, to tell reads from them apart from reads from the public internet.")
+	cmd.Flags().StringSliceVar(&geoIPDatabaseFiles, "geoip-db", nil, "MaxMind-format databases (e.g. GeoLite2 Country and ASN) to look up the country and ASN of public IP addresses in.")
+}
+
+// consumerResolvers collects what the resolvers selected by the command's flags need.
+// Resolving consumers is best effort, so a resolver that can't be built is skipped with a warning.
+// Only invalid files (e.g. classification rules) fail, since the consumers would be resolved differently than requested.
+func consumerResolvers(cmd *cobra.Command) ([]engines.ConsumerResolver, error) {
+	var resolvers []engines.ConsumerResolver
+	if classificationRulesFile != "" {
+		data, err := os.ReadFile(classificationRulesFile)
+		if err != nil {
+			return nil, fmt.Errorf("could not read classification rules: %v", err)
+		}
+		rules, err := engines.ParseClassificationRules(data)
+		if err != nil {
+			return nil, err
+		}
+		// The classifier runs first, so that the resolvers of specific workloads refine its classification
+		resolvers = append(resolvers, engines.NewRulesClassifier(rules))
+	}
+	networkResolver, err := newNetworkResolver()
+	if err != nil {
+		return nil, err
+	}
+	resolvers = append(resolvers, networkResolver)
+	if resolveWorkloads {
+		resolvers = append(resolvers, workloadResolvers()...)
+	}
+	if resolveChains {
+		// The sessions of a role chain are issued in any of the accounts, so the AssumeRole events of all secrets are collected
+		assumeRoleEvents, err := collectCloudTrail(cmd, "", aws_cloudtrail.AssumeRoleEvents)
+		if err != nil {
+			fmt.Fprintf(os.Stderr, colors.Yellow("Could not collect AWS CloudTrail AssumeRole events, role chains will not be resolved: %v\n"), err)
+		} else {
+			resolvers = append(resolvers, engines.NewIdentityChainResolver(assumeRoleEvents))
+		}
+	}
+	if identityStoreId != "" {
+		users, groups, err := aws_identitystore.CollectUsersAndGroups(region, profileToUse, identityStoreId)
+		if err != nil {
+			fmt.Fprintf(os.Stderr, colors.Yellow("Could not collect AWS IAM Identity Center users, SSO users will not be enriched: %v\n"), err)
+		} else {
+			resolvers = append(resolvers, engines.NewIdentityStoreResolver(users, groups))
+		}
+	}
+	return resolvers, nil
+}
+
+func newNetworkResolver() (*engines.NetworkResolver, error) {
+	var networks []engines.NamedNetwork
+	if networksFile != "" {
+		data, err := os.ReadFile(networksFile)
+		if err != nil {
+			return nil, fmt.Errorf("could not read networks: %v", err)
+		}
+		if networks, err = engines.ParseNetworks(data); err != nil {
+			return nil, err
+		}
+	}
+	var geoIP *clients.GeoIPClient
+	if len(geoIPDatabaseFiles) > 0 {
+		var err error
+		if geoIP, err = clients.NewGeoIPClient(geoIPDatabaseFiles); err != nil {
+			return nil, err
+		}
+	}
+	return engines.NewNetworkResolver(networks, geoIP), nil
+}
+
+func workloadResolvers() []engines.ConsumerResolver {
+	var resolvers []engines.ConsumerResolver
+	authorizationDetails, err := aws_iam.CollectIAM(region, profileToUse)
+	if err != nil {
+		fmt.Fprintf(os.Stderr, colors.Yellow("Could not collect AWS IAM roles, EKS service accounts will not be resolved: %v\n"), err)
+	} else {
+		clusters, err := aws_eks.CollectClusters(region, profileToUse)
+		if err != nil {
+			fmt.Fprintf(os.Stderr, colors.Yellow("Could not collect AWS EKS clusters, only IRSA service accounts will be resolved: %v\n"), err)
+		}
+		resolvers = append(resolvers, engines.NewEKSResolver(clusters, authorizationDetails))
+	}
+
+	functions, err := aws_lambda.CollectFunctions(region, profileToUse)
+	if err != nil {
+		fmt.Fprintf(os.Stderr, colors.Yellow("Could not collect AWS Lambda functions, they will not be resolved: %v\n"), err)
+	}
+	taskDefinitions, err := aws_ecs.CollectTaskDefinitions(region, profileToUse)
+	if err != nil {
+		fmt.Fprintf(os.Stderr, colors.Yellow("Could not collect AWS ECS task definitions, they will not be resolved: %v\n"), err)
+	}
+	instances, err := aws_ec2.CollectInstances(region, profileToUse)
+	if err != nil {
+		fmt.Fprintf(os.Stderr, colors.Yellow("Could not collect AWS EC2 instances, their names will not be resolved: %v\n"), err)
+	}
+	return append(resolvers, engines.NewWorkloadResolver(functions, taskDefinitions, instances))
+}
@@ -0,0 +1,309 @@
+package aws
+
+import (
+	"fmt"
+	"os"
+	"sort"
+	"strconv"
+	"strings"
+	"text/tabwriter"
+	"time"
+
+	"github.com/samber/lo"
+	"github.com/spf13/cobra"
+	"github.com/torchsecurity/torch-secret-analyzer/pkg/collectors/aws_cloudtrail"
+	"github.com/torchsecurity/torch-secret-analyzer/pkg/collectors/aws_secretsmanager"
+	"github.com/torchsecurity/torch-secret-analyzer/pkg/engines"
+	"github.com/torchsecurity/torch-secret-analyzer/pkg/utils/colors"
+	timeutil "github.com/torchsecurity/torch-secret-analyzer/pkg/utils/time"
+)
+
+var secretsCommand = &cobra.Command{
+	Use:   "secrets",
+	Short: "Analyze AWS secrets",
+	Long:  "Analyze the secrets stored in AWS Secrets Manager",
+}
+
+var listSecretsCommand = &cobra.Command{
+	Use:   "list",
+	Short: "List AWS secrets and their usage",
+	Long:  "Torch lists the secrets stored in AWS Secrets Manager and crosses information with AWS CloudTrail events to count how many times each secret was read in a given timeframe",
+	Run: func(cmd *cobra.Command, args []string) {
+		fmt.Printf("Listing all secrets and their read events based on %s:\n\n", describeCloudTrailSource(cmd, "read"))
+		secrets, err := aws_secretsmanager.CollectSecrets(region, profileToUse)
+		if err != nil {
+			fmt.Printf(colors.Red("Could not list AWS secrets: %v\n"), err)
+			return
+		}
+		cloudtrailEvents, err := collectCloudTrail(cmd, "", aws_cloudtrail.ReadEvents)
+		if err != nil {
+			fmt.Printf(colors.Red("Could not list AWS secrets: %v\n"), err)
+			return
+		}
+
+		inventory := engines.GetAWSSecretsInventory(secrets, cloudtrailEvents)
+		writer := tabwriter.NewWriter(os.Stdout, 0, 0, 2, ' ', 0)
+		fmt.Fprintln(writer, "NAME\tARN\tKMS KEY\tROTATION\tLAST ROTATED\tLAST ACCESSED\tREADS\tLAST READ\tTAGS")
+		for _, usage := range inventory {
+			secret := usage.Secret
+			fmt.Fprintf(writer, "%s\t%s\t%s\t%s\t%s\t%s\t%d\t%s\t%s\n",
+				secret.Name,
+				secret.Arn,
+				describeKmsKey(secret.KmsKeyId),
+				describeRotation(secret.RotationEnabled),
+				formatOptionalTime(secret.LastRotatedDate),
+				formatOptionalTime(secret.LastAccessedDate),
+				usage.ReadCount,
+				formatOptionalTime(usage.LastReadAt),
+				describeTags(secret.Tags),
+			)
+		}
+		writer.Flush()
+	},
+}
+
+var secretTimelineCommand = &cobra.Command{
+	Use:   "timeline",
+	Short: "List AWS secret's access timeline",
+	Long:  "Torch lists every read and write event of a given secret in AWS CloudTrail in chronological order, or counts them per hour or day",
+	Run: func(cmd *cobra.Command, args []string) {
+		if err := validateOutputFormat(outputFormat); err != nil {
+			fmt.Fprintf(os.Stderr, colors.Red("Could not list AWS secret timeline: %v\n"), err)
+			return
+		}
+		if secretId == "" {
+			fmt.Println(cmd.UsageString())
+			return
+		}
+		bucketSize, supported := timelineBuckets[timelineBucket]
+		if timelineBucket != "" && !supported {
+			fmt.Fprintf(os.Stderr, colors.Red("Could not list AWS secret timeline: unsupported bucket '%s', expected hour or day\n"), timelineBucket)
+			return
+		}
+		fmt.Fprintf(os.Stderr, "Listing the timeline of the secret '%s' based on %s:\n\n", secretId, describeCloudTrailSource(cmd, "read and write"))
+		cloudtrailEvents, err := collectCloudTrail(cmd, secretId, aws_cloudtrail.SupportedEvents)
+		if err != nil {
+			fmt.Fprintf(os.Stderr, colors.Red("Could not list AWS secret timeline: %v\n"), err)
+			return
+		}
+
+		resolvers, err := consumerResolvers(cmd)
+		if err != nil {
+			fmt.Fprintf(os.Stderr, colors.Red("Could not list AWS secret timeline: %v\n"), err)
+			return
+		}
+		timeline := engines.GetAWSSecretTimeline(cloudtrailEvents, secretId, resolvers...)
+		unattributed := lo.CountBy(timeline, func(event engines.TimelineEvent) bool {
+			return event.Principal.Category == engines.UnattributedConsumer
+		})
+		exitOnUnattributed(unattributed, "list AWS secret timeline")
+		defer printUnattributedSummary(unattributed)
+		if timelineBucket != "" {
+			printTimelineBuckets(engines.BucketAWSSecretTimeline(timeline, bucketSize), unattributed)
+		} else {
+			printTimeline(timeline, unattributed)
+		}
+	},
+}
+
+var auditSecretsCommand = &cobra.Command{
+	Use:   "audit",
+	Short: "Audit the hygiene of AWS secrets",
+	Long:  "Torch checks the secrets stored in AWS Secrets Manager and their reads in AWS CloudTrail for hygiene issues: unused secrets, disabled or overdue rotation, the default encryption key, missing resource policies, too many human readers, reads of deprecated versions and reads of secrets scheduled for deletion",
+	Run: func(cmd *cobra.Command, args []string) {
+		if err := validateOutputFormat(outputFormat); err != nil {
+			fmt.Fprintf(os.Stderr, colors.Red("Could not audit AWS secrets: %v\n"), err)
+			return
+		}
+		for _, suppression := range auditSuppressions {
+			if err := engines.ValidateSuppression(suppression); err != nil {
+				fmt.Fprintf(os.Stderr, colors.Red("Could not audit AWS secrets: %v\n"), err)
+				return
+			}
+		}
+		fmt.Fprintf(os.Stderr, "Auditing all secrets based on %s:\n", describeCloudTrailSource(cmd, "read"))
+		secrets, err := aws_secretsmanager.CollectSecretsDetails(region, profileToUse)
+		if err != nil {
+			fmt.Fprintf(os.Stderr, colors.Red("Could not audit AWS secrets: %v\n"), err)
+			return
+		}
+		cloudtrailEvents, err := collectCloudTrail(cmd, "", aws_cloudtrail.ReadEvents)
+		if err != nil {
+			fmt.Fprintf(os.Stderr, colors.Red("Could not audit AWS secrets: %v\n"), err)
+			return
+		}
+		resolvers, err := consumerResolvers(cmd)
+		if err != nil {
+			fmt.Fprintf(os.Stderr, colors.Red("Could not audit AWS secrets: %v\n"), err)
+			return
+		}
+
+		findings := engines.AuditAWSSecrets(secrets, cloudtrailEvents, engines.AuditOptions{
+			Now:             time.Now(),
+			UnusedDays:      unusedDays,
+			MaxHumanReaders: maxHumanReaders,
+			Suppressions:    auditSuppressions,
+		}, resolvers...)
+		if outputFormat == tableOutput {
+			fmt.Printf("\nFindings (%d):\n", len(findings))
+			for _, finding := range findings {
+				fmt.Printf("* %s %s %s: %s\n", describeSeverity(finding.Severity), finding.SecretName, finding.RuleId, finding.Reason)
+			}
+			severities := lo.CountValuesBy(findings, func(finding engines.SecretFinding) engines.FindingSeverity { return finding.Severity })
+			fmt.Printf("\nHigh: %d, Medium: %d, Low: %d\n", severities[engines.HighSeverity], severities[engines.MediumSeverity], severities[engines.LowSeverity])
+			return
+		}
+		findings = lo.Ternary(findings == nil, []engines.SecretFinding{}, findings)
+		err = writeOutput(os.Stdout, outputFormat, findings, func() [][]string {
+			rows := [][]string{{"secret_name", "secret_arn", "rule_id", "severity", "reason"}}
+			for _, finding := range findings {
+				rows = append(rows, []string{finding.SecretName, finding.SecretArn, string(finding.RuleId), string(finding.Severity), finding.Reason})
+			}
+			return rows
+		})
+		if err != nil {
+			fmt.Fprintf(os.Stderr, colors.Red("Could not write AWS secrets audit: %v\n"), err)
+		}
+	},
+}
+
+// secrets audit flags
+var (
+	unusedDays        int
+	maxHumanReaders   int
+	auditSuppressions []string
+)
+
+func describeSeverity(severity engines.FindingSeverity) string {
+	switch severity {
+	case engines.HighSeverity:
+		return colors.Red("[high]")
+	case engines.MediumSeverity:
+		return colors.Yellow("[medium]")
+	}
+	return fmt.Sprintf("[%s]", severity)
+}
+
+// secrets timeline flags
+var timelineBucket string
+
+var timelineBuckets = map[string]time.Duration{
+	"hour": time.Hour,
+	"day":  24 * time.Hour,
+}
+
+func printTimeline(timeline []engines.TimelineEvent, unattributed int) {
+	if outputFormat != tableOutput {
+		timeline = lo.Ternary(timeline == nil, []engines.TimelineEvent{}, timeline)
+		err := writeOutput(os.Stdout, outputFormat, timeline, func() [][]string {
+			rows := [][]string{append([]string{"event_time", "event_name", "event_id", "source_ip_address", "user_agent", "client"}, consumerCSVHeader...)}
+			for _, event := range timeline {
+				rows = append(rows, append([]string{timeutil.FormatTime(event.EventTime), event.EventName, event.EventId, event.SourceIpAddress, event.UserAgent, event.Client}, consumerCSVRow(event.Principal)...))
+			}
+			return rows
+		})
+		if err != nil {
+			fmt.Fprintf(os.Stderr, colors.Red("Could not write AWS secret timeline: %v\n"), err)
+		}
+		return
+	}
+
+	writer := tabwriter.NewWriter(os.Stdout, 0, 0, 2, ' ', 0)
+	fmt.Fprintln(writer, "TIME\tEVENT\tPRINCIPAL\tTYPE\tSOURCE IP\tUSER AGENT\tCLIENT\tEVENT ID")
+	for _, event := range timeline {
+		fmt.Fprintf(writer, "%s\t%s\t%s\t%s\t%s\t%s\t%s\t%s\n",
+			timeutil.FormatTime(event.EventTime),
+			event.EventName,
+			event.Principal.Name,
+			event.Principal.Type,
+			event.SourceIpAddress,
+			event.UserAgent,
+			event.Client,
+			event.EventId,
+		)
+	}
+	writer.Flush()
+}
+
+func printTimelineBuckets(buckets []engines.TimelineBucket, unattributed int) {
+	if outputFormat != tableOutput {
+		buckets = lo.Ternary(buckets == nil, []engines.TimelineBucket{}, buckets)
+		err := writeOutput(os.Stdout, outputFormat, buckets, func() [][]string {
+			rows := [][]string{{"start", "reads", "writes"}}
+			for _, bucket := range buckets {
+				rows = append(rows, []string{timeutil.FormatTime(bucket.Start), strconv.Itoa(bucket.Reads), strconv.Itoa(bucket.Writes)})
+			}
+			return rows
+		})
+		if err != nil {
+			fmt.Fprintf(os.Stderr, colors.Red("Could not write AWS secret timeline: %v\n"), err)
+		}
+		return
+	}
+
+	writer := tabwriter.NewWriter(os.Stdout, 0, 0, 2, ' ', 0)
+	fmt.Fprintln(writer, "START\tREADS\tWRITES")
+	for _, bucket := range buckets {
+		fmt.Fprintf(writer, "%s\t%d\t%d\n", timeutil.FormatTime(bucket.Start), bucket.Reads, bucket.Writes)
+	}
+	writer.Flush()
+}
+
+func describeKmsKey(kmsKeyId string) string {
+	if kmsKeyId == "" {
+		return "aws/secretsmanager"
+	}
+	return kmsKeyId
+}
+
+func describeRotation(rotationEnabled bool) string {
+	if rotationEnabled {
+		return "enabled"
+	}
+	return "disabled"
+}
+
+func formatOptionalTime(t time.Time) string {
+	if t.IsZero() {
+		return "never"
+	}
+	return timeutil.FormatTime(t)
+}
+
+func describeTags(tags map[string]string) string {
+	var pairs []string
+	for key, value := range tags {
+		pairs = append(pairs, fmt.Sprintf("%s=%s", key, value))
+	}
+	sort.Strings(pairs)
+	return strings.Join(pairs, ",")
+}
+
+func init() {
+	secretsCommand.PersistentFlags().StringVarP(&region, "region", "r", "", "AWS region of the secrets (will use aws profile by default).")
+	secretsCommand.PersistentFlags().StringVarP(&profileToUse, "profile", "p", "", "The AWS profile the CLI tool should use (will use the active aws profile by default).")
+
+	listSecretsCommand.Flags().IntVarP(&daysBack, "days-back", "d", 14, "The amount of days back to query AWS cloudtrail for its events (14 by default).")
+	addCloudTrailSourceFlags(listSecretsCommand)
+
+	secretTimelineCommand.Flags().StringVarP(&secretId, "secret-id", "s", "", "AWS secret ID (required).")
+	secretTimelineCommand.MarkFlagRequired("secret-id")
+	secretTimelineCommand.Flags().IntVarP(&daysBack, "days-back", "d", 14, "The amount of days back to query AWS cloudtrail for its events (14 by default).")
+	secretTimelineCommand.Flags().StringVar(&timelineBucket, "bucket", "", "Count the events per hour or day instead of listing them.")
+	secretTimelineCommand.Flags().StringVarP(&outputFormat, "output", "o", tableOutput, "The output format: table, json, yaml or csv (table by default).")
+	addCloudTrailSourceFlags(secretTimelineCommand)
+	addResolverFlags(secretTimelineCommand)
+	addStrictFlag(secretTimelineCommand)
+
+	auditSecretsCommand.Flags().IntVarP(&daysBack, "days-back", "d", 14, "The amount of days back to query AWS cloudtrail for its events (14 by default).")
+	auditSecretsCommand.Flags().IntVar(&unusedDays, "unused-days", 90, "The amount of days without reads after which a secret is unused (90 by default).")
+	auditSecretsCommand.Flags().IntVar(&maxHumanReaders, "max-human-readers", 5, "The amount of humans that may read a secret in the timeframe (5 by default, 0 for any).")
+	auditSecretsCommand.Flags().StringSliceVar(&auditSuppressions, "suppress", nil, "Findings to suppress, by rule id (e.g. default-kms-key) or by rule id and secret name pattern (e.g. no-resource-policy:dev/*).")
+	auditSecretsCommand.Flags().StringVarP(&outputFormat, "output", "o", tableOutput, "The output format: table, json, yaml or csv (table by default).")
+	addCloudTrailSourceFlags(auditSecretsCommand)
+	addResolverFlags(auditSecretsCommand)
+
+	secretsCommand.AddCommand(listSecretsCommand)
+	secretsCommand.AddCommand(auditSecretsCommand)
+	secretsCommand.AddCommand(secretTimelineCommand)
+}
@@ -0,0 +1,46 @@
+package clients
+
+import (
+	"context"
+	"fmt"
+
+	"github.com/aws/aws-sdk-go-v2/aws"
+	"github.com/aws/aws-sdk-go-v2/config"
+	"github.com/aws/aws-sdk-go-v2/credentials/stscreds"
+	"github.com/aws/aws-sdk-go-v2/service/sts"
+)
+
+type ConfigOption func(cfg *aws.Config)
+
+// WithAssumedRole makes a client act as a role assumed with the profile's credentials, e.g. an audit role in another account.
+func WithAssumedRole(roleArn string) ConfigOption {
+	return func(cfg *aws.Config) {
+		cfg.Credentials = aws.NewCredentialsCache(stscreds.NewAssumeRoleProvider(sts.NewFromConfig(*cfg), roleArn))
+	}
+}
+
+// WithAccountRole makes a client act as a role in an account, unless it's the caller's own account (e.g. the management account of
+// an organization, which has no OrganizationAccountAccessRole) where the profile's credentials are used as is.
+func WithAccountRole(partition string, accountId string, callerAccountId string, roleName string) ConfigOption {
+	if accountId == callerAccountId {
+		return func(cfg *aws.Config) {}
+	}
+	return WithAssumedRole(RoleArn(partition, accountId, roleName))
+}
+
+// RoleArn builds the ARN of a role in an account, in the partition of the caller (e.g. aws-us-gov in GovCloud or aws-cn in China).
+func RoleArn(partition string, accountId string, roleName string) string {
+	return fmt.Sprintf("arn:%s:iam::%s:role/%s", partition, accountId, roleName)
+}
+
+func loadAWSConfig(region string, profile string, options ...ConfigOption) (aws.Config, error) {
+	// We pass region to the load default config. If region is empty, it uses the profile default region.
+	cfg, err := config.LoadDefaultConfig(context.TODO(), config.WithRegion(region), config.WithSharedConfigProfile(profile))
+	if err != nil {
+		return aws.Config{}, fmt.Errorf("could not load aws config %w", err)
+	}
+	for _, option := range options {
+		option(&cfg)
+	}
+	return cfg, nil
+}
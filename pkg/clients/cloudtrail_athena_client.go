@@ -0,0 +1,169 @@
+package clients
+
+import (
+	"context"
+	"fmt"
+	"strings"
+	"time"
+
+	"github.com/samber/lo"
+
+	"github.com/aws/aws-sdk-go-v2/aws"
+	"github.com/aws/aws-sdk-go-v2/service/athena"
+	"github.com/aws/aws-sdk-go-v2/service/athena/types"
+)
+
+// CloudTrail log files keep timestamps as ISO 8601 strings in UTC
+const athenaTimeLayout = "2006-01-02T15:04:05Z"
+
+// AthenaTable describes an Athena table over the S3 bucket a trail delivers its log files to.
+type AthenaTable struct {
+	Database           string
+	Table              string
+	Workgroup          string
+	OutputLocation     string // Optional when the workgroup has an output location
+	TimestampPartition string // The table's yyyy/MM/dd partition column, as created with partition projection (no pruning when empty)
+}
+
+// CloudtrailAthenaClient queries the events of an Athena CloudTrail table.
+type CloudtrailAthenaClient struct {
+	client       *athena.Client
+	region       string
+	table        AthenaTable
+	queryTimeout time.Duration // A query still running after that long is cancelled (no limit when zero)
+}
+
+func NewCloudtrailAthenaClient(region string, profile string, table AthenaTable, queryTimeout time.Duration) (client *CloudtrailAthenaClient, err error) {
+	cfg, err := loadAWSConfig(region, profile)
+	if err != nil {
+		return nil, err
+	}
+
+	cloudtrailAthenaClient := CloudtrailAthenaClient{
+		client:       athena.NewFromConfig(cfg),
+		region:       region,
+		table:        table,
+		queryTimeout: queryTimeout,
+	}
+	return &cloudtrailAthenaClient, nil
+}
+
+func (c *CloudtrailAthenaClient) GetEvents(startTime time.Time, eventsFilter *EventsFilter) ([]CloudtrailEvent, error) {
+	// CreateSecret refers to the secret by its name rather than its id
+	secretIdColumn := "coalesce(json_extract_scalar(requestParameters, '$.secretId'), json_extract_scalar(requestParameters, '$.name'))"
+	columns := append(append([]string{}, cloudtrailQueryColumns...),
+		secretIdColumn+" AS secretId",
+		"json_extract_scalar(requestParameters, '$.roleArn') AS roleArn",
+		"json_extract_scalar(requestParameters, '$.versionStage') AS versionStage",
+		"json_extract_scalar(responseElements, '$.credentials.accessKeyId') AS issuedAccessKeyId",
+	)
+	conditions := cloudtrailQueryConditions(startTime, eventsFilter, athenaTimeLayout, secretIdColumn)
+	// Prune the partitions outside the timeframe, so Athena doesn't scan the whole bucket
+	if c.table.TimestampPartition != "" && !startTime.IsZero() {
+		conditions = append(conditions, fmt.Sprintf(`"%s" >= '%s'`, c.table.TimestampPartition, startTime.UTC().Format("2006/01/02")))
+	}
+	statement := fmt.Sprintf(`SELECT %s FROM "%s" WHERE %s`, strings.Join(columns, ", "), c.table.Table, strings.Join(conditions, " AND "))
+
+	rows, err := c.query(statement)
+	if err != nil {
+		return nil, fmt.Errorf("could not query athena cloudtrail events: %v", err)
+	}
+
+	var cloudtrailEvents []CloudtrailEvent
+	for _, row := range rows {
+		if !isQueryRowOfSecret(row, eventsFilter) {
+			continue
+		}
+		cloudtrailEvent, err := parseCloudtrailQueryRow(row, athenaTimeLayout)
+		if err != nil {
+			return nil, fmt.Errorf("failed to process event: %v", err)
+		}
+		cloudtrailEvents = append(cloudtrailEvents, *cloudtrailEvent)
+	}
+	return cloudtrailEvents, nil
+}
+
+func (c *CloudtrailAthenaClient) query(statement string) ([]map[string]string, error) {
+	input := &athena.StartQueryExecutionInput{
+		QueryString:           aws.String(statement),
+		QueryExecutionContext: &types.QueryExecutionContext{Database: aws.String(c.table.Database)},
+	}
+	if c.table.Workgroup != "" {
+		input.WorkGroup = aws.String(c.table.Workgroup)
+	}
+	if c.table.OutputLocation != "" {
+		input.ResultConfiguration = &types.ResultConfiguration{OutputLocation: aws.String(c.table.OutputLocation)}
+	}
+	startResp, err := c.client.StartQueryExecution(context.Background(), input)
+	if err != nil {
+		return nil, fmt.Errorf("failed to start query: %v", err)
+	}
+
+	if err := c.waitForQuery(startResp.QueryExecutionId); err != nil {
+		return nil, err
+	}
+
+	var rows []map[string]string
+	var columns []string
+	paginator := athena.NewGetQueryResultsPaginator(c.client, &athena.GetQueryResultsInput{QueryExecutionId: startResp.QueryExecutionId})
+	for paginator.HasMorePages() {
+		resp, err := paginator.NextPage(context.Background())
+		if err != nil {
+			return nil, fmt.Errorf("failed to get query results: %v", err)
+		}
+
+		resultRows := resp.ResultSet.Rows
+		if columns == nil {
+			for _, column := range resp.ResultSet.ResultSetMetadata.ColumnInfo {
+				columns = append(columns, strings.ToLower(lo.FromPtr(column.Name)))
+			}
+			// The first row of the first page holds the column names
+			if len(resultRows) > 0 {
+				resultRows = resultRows[1:]
+			}
+		}
+
+		for _, resultRow := range resultRows {
+			row := map[string]string{}
+			for i, datum := range resultRow.Data {
+				if i < len(columns) {
+					row[columns[i]] = lo.FromPtr(datum.VarCharValue)
+				}
+			}
+			rows = append(rows, row)
+		}
+	}
+	return rows, nil
+}
+
+func (c *CloudtrailAthenaClient) waitForQuery(queryExecutionId *string) error {
+	ctx, cancel := queryDeadline(c.queryTimeout)
+	defer cancel()
+
+	for {
+		resp, err := c.client.GetQueryExecution(context.Background(), &athena.GetQueryExecutionInput{QueryExecutionId: queryExecutionId})
+		if err != nil {
+			return fmt.Errorf("failed to get query execution: %v", err)
+		}
+
+		status := resp.QueryExecution.Status
+		switch status.State {
+		case types.QueryExecutionStateSucceeded:
+			return nil
+		case types.QueryExecutionStateFailed, types.QueryExecutionStateCancelled:
+			return fmt.Errorf("query %s: %s", strings.ToLower(string(status.State)), lo.FromPtr(status.StateChangeReason))
+		}
+		if err := waitToPollQuery(ctx); err != nil {
+			return c.stopQuery(queryExecutionId)
+		}
+	}
+}
+
+// stopQuery stops a query that timed out, so that it doesn't keep scanning (and billing for) the bucket in the background.
+func (c *CloudtrailAthenaClient) stopQuery(queryExecutionId *string) error {
+	_, err := c.client.StopQueryExecution(context.Background(), &athena.StopQueryExecutionInput{QueryExecutionId: queryExecutionId})
+	if err != nil {
+		return fmt.Errorf("query timed out after %s, and failed to stop it: %v", c.queryTimeout, err)
+	}
+	return fmt.Errorf("query timed out after %s, and was stopped", c.queryTimeout)
+}
@@ -10,7 +10,6 @@ import (
 	jsonutil "github.com/torchsecurity/torch-secret-analyzer/pkg/utils/json"
 
 	"github.com/aws/aws-sdk-go-v2/aws"
-	"github.com/aws/aws-sdk-go-v2/config"
 	"github.com/aws/aws-sdk-go-v2/service/cloudtrail"
 	"github.com/aws/aws-sdk-go-v2/service/cloudtrail/types"
 )
@@ -63,6 +62,11 @@ type AWSUserIdentity struct {
 }
 
 type cloudtrailRawEvent struct {
+	EventID           string                    `json:"eventID"`
+	EventName         string                    `json:"eventName"`
+	EventSource       string                    `json:"eventSource"`
+	EventTime         time.Time                 `json:"eventTime"`
+	AwsRegion         string                    `json:"awsRegion"`
 	UserIdentity      AWSUserIdentity           `json:"userIdentity"`
 	Resources         []CloudTrailEventResource `json:"resources"`
 	RequestParameters map[string]interface{}    `json:"requestParameters"`
@@ -70,6 +74,8 @@ type cloudtrailRawEvent struct {
 	EventCategory     string                    `json:"eventCategory"`
 	SourceIpAddress   string                    `json:"sourceIpAddress"`
 	UserAgent         string                    `json:"userAgent"`
+	VpcEndpointId     string                    `json:"vpcEndpointId"`
+	ErrorCode         string                    `json:"errorCode"`
 }
 
 type CloudtrailEvent struct {
@@ -77,14 +83,17 @@ type CloudtrailEvent struct {
 	EventName         string
 	EventSource       string
 	EventTime         time.Time
+	Region            string
 	Username          string
 	Resources         []CloudTrailEventResource
 	UserIdentity      AWSUserIdentity
 	SourceIpAddress   string
 	UserAgent         string
+	VpcEndpointId     string // The VPC endpoint the request was sent through, if any
 	RequestParameters string
 	ResponseElements  string
 	EventCategory     string
+	ErrorCode         string // The error of a failed request (e.g. AccessDenied), empty when it succeeded
 }
 
 type CloudtrailClient struct {
@@ -92,11 +101,10 @@ type CloudtrailClient struct {
 	region string
 }
 
-func NewCloudtrailClient(region string, profile string) (client *CloudtrailClient, err error) {
-	// We pass region to the load default config. If region is empty, it uses the profile default region.
-	cfg, err := config.LoadDefaultConfig(context.TODO(), config.WithRegion(region), config.WithSharedConfigProfile(profile))
+func NewCloudtrailClient(region string, profile string, options ...ConfigOption) (client *CloudtrailClient, err error) {
+	cfg, err := loadAWSConfig(region, profile, options...)
 	if err != nil {
-		return nil, fmt.Errorf("could not load aws config %w", err)
+		return nil, err
 	}
 
 	cloudtrailClient := CloudtrailClient{
@@ -107,7 +115,9 @@ func NewCloudtrailClient(region string, profile string) (client *CloudtrailClien
 }
 
 type EventsFilter struct {
-	EventName *string
+	EventName   *string
+	EventSource *string // Only log files and sources that query events with SQL filter by the event source, defaults to Secrets Manager
+	SecretId    *string // Only sources that query events with SQL filter by the secret, others return the events of all secrets
 }
 
 func (c *CloudtrailClient) GetEvents(startTime time.Time, eventsFilter *EventsFilter) ([]CloudtrailEvent, error) {
@@ -135,6 +145,9 @@ func (c *CloudtrailClient) queryEvents(startTime time.Time, lookupAttributes []t
 		if err != nil {
 			return nil, fmt.Errorf("failed to process event: %v", err)
 		}
+		if cloudtrailEvent.Region == "" {
+			cloudtrailEvent.Region = c.region
+		}
 		cloudtrailEvents = append(cloudtrailEvents, *cloudtrailEvent)
 	}
 
@@ -192,11 +205,14 @@ func parseCloudtrailEvent(event types.Event) (cloudtrailEvent *CloudtrailEvent,
 		EventSource:       *event.EventSource,
 		EventCategory:     extracedEvent.EventCategory,
 		EventTime:         *event.EventTime,
+		Region:            extracedEvent.AwsRegion,
 		Username:          lo.FromPtr(event.Username),
 		Resources:         resources,
 		UserIdentity:      extracedEvent.UserIdentity,
 		SourceIpAddress:   extracedEvent.SourceIpAddress,
 		UserAgent:         extracedEvent.UserAgent,
+		VpcEndpointId:     extracedEvent.VpcEndpointId,
+		ErrorCode:         extracedEvent.ErrorCode,
 		RequestParameters: jsonutil.MustMarshalToString(extracedEvent.RequestParameters),
 		ResponseElements:  jsonutil.MustMarshalToString(extracedEvent.ResponseElements),
 	}, nil
@@ -0,0 +1,225 @@
+package clients
+
+import (
+	"bufio"
+	"compress/gzip"
+	"encoding/json"
+	"fmt"
+	"io"
+	"io/fs"
+	"os"
+	"path/filepath"
+	"strings"
+	"sync"
+	"time"
+
+	jsonutil "github.com/torchsecurity/torch-secret-analyzer/pkg/utils/json"
+)
+
+// StdinPath reads CloudTrail log files from the standard input instead of the file system.
+const StdinPath = "-"
+
+// Events are collected once per event name (and again to resolve role chains), while a trail's log files can add up to gigabytes
+// and the standard input can only be read once, so the events of each path are read on first use and cached by event name
+var (
+	pathEventsMutex sync.Mutex
+	pathEvents      = map[string]func() (map[string][]CloudtrailEvent, error){}
+)
+
+type cloudtrailLogFile struct {
+	Records []json.RawMessage `json:"Records"`
+}
+
+// Log file records describe their resources differently than the events LookupEvents returns
+type cloudtrailRecordResources struct {
+	Resources []struct {
+		ARN  string `json:"ARN"`
+		Type string `json:"type"`
+	} `json:"resources"`
+}
+
+// CloudtrailFilesClient reads events from CloudTrail log files, as delivered by a trail to S3 ({"Records":[...]}, optionally gzipped).
+type CloudtrailFilesClient struct {
+	paths []string
+}
+
+func NewCloudtrailFilesClient(paths []string) *CloudtrailFilesClient {
+	return &CloudtrailFilesClient{
+		paths: paths,
+	}
+}
+
+// GetEvents reads the events of every .json and .json.gz file under the client's paths.
+// Unlike LookupEvents, log files are not limited to the last 90 days, so a zero startTime reads all events.
+func (c *CloudtrailFilesClient) GetEvents(startTime time.Time, eventsFilter *EventsFilter) ([]CloudtrailEvent, error) {
+	var cloudtrailEvents []CloudtrailEvent
+	for _, path := range c.paths {
+		eventsByName, err := readPathEvents(path)
+		if err != nil {
+			return nil, err
+		}
+		if eventsFilter.EventName != nil {
+			cloudtrailEvents = append(cloudtrailEvents, filterCloudtrailEvents(eventsByName[*eventsFilter.EventName], startTime, eventsFilter)...)
+			continue
+		}
+		for _, events := range eventsByName {
+			cloudtrailEvents = append(cloudtrailEvents, filterCloudtrailEvents(events, startTime, eventsFilter)...)
+		}
+	}
+	return cloudtrailEvents, nil
+}
+
+// readPathEvents reads the events of a path (a log file, a directory of log files or the standard input) once, by event name.
+func readPathEvents(path string) (map[string][]CloudtrailEvent, error) {
+	pathEventsMutex.Lock()
+	readEvents, found := pathEvents[path]
+	if !found {
+		readEvents = sync.OnceValues(func() (map[string][]CloudtrailEvent, error) {
+			events, err := readPathLogFiles(path)
+			if err != nil {
+				return nil, err
+			}
+			eventsByName := map[string][]CloudtrailEvent{}
+			for _, event := range events {
+				eventsByName[event.EventName] = append(eventsByName[event.EventName], event)
+			}
+			return eventsByName, nil
+		})
+		pathEvents[path] = readEvents
+	}
+	pathEventsMutex.Unlock()
+	return readEvents()
+}
+
+func readPathLogFiles(path string) ([]CloudtrailEvent, error) {
+	if path == StdinPath {
+		events, err := readCloudtrailLogFile(os.Stdin)
+		if err != nil {
+			return nil, fmt.Errorf("failed to read cloudtrail events from stdin: %v", err)
+		}
+		return events, nil
+	}
+
+	var cloudtrailEvents []CloudtrailEvent
+	err := filepath.WalkDir(path, func(filePath string, entry fs.DirEntry, err error) error {
+		if err != nil {
+			return err
+		}
+		if entry.IsDir() || !isCloudtrailLogFile(filePath) {
+			return nil
+		}
+
+		events, err := readCloudtrailLogFilePath(filePath)
+		if err != nil {
+			return fmt.Errorf("failed to read cloudtrail events from %s: %v", filePath, err)
+		}
+		cloudtrailEvents = append(cloudtrailEvents, events...)
+		return nil
+	})
+	return cloudtrailEvents, err
+}
+
+func isCloudtrailLogFile(path string) bool {
+	return strings.HasSuffix(path, ".json") || strings.HasSuffix(path, ".json.gz")
+}
+
+func readCloudtrailLogFilePath(path string) ([]CloudtrailEvent, error) {
+	file, err := os.Open(path)
+	if err != nil {
+		return nil, err
+	}
+	defer file.Close()
+
+	return readCloudtrailLogFile(file)
+}
+
+func readCloudtrailLogFile(reader io.Reader) ([]CloudtrailEvent, error) {
+	// Detect gzipped content by its magic bytes rather than the file extension, as stdin has none
+	bufferedReader := bufio.NewReader(reader)
+	if header, err := bufferedReader.Peek(2); err == nil && header[0] == 0x1f && header[1] == 0x8b {
+		gzipReader, err := gzip.NewReader(bufferedReader)
+		if err != nil {
+			return nil, err
+		}
+		defer gzipReader.Close()
+		reader = gzipReader
+	} else {
+		reader = bufferedReader
+	}
+
+	var logFile cloudtrailLogFile
+	if err := json.NewDecoder(reader).Decode(&logFile); err != nil {
+		return nil, fmt.Errorf("failed to deserialize log file: %v", err)
+	}
+
+	var cloudtrailEvents []CloudtrailEvent
+	for _, record := range logFile.Records {
+		var rawEvent cloudtrailRawEvent
+		if err := json.Unmarshal(record, &rawEvent); err != nil {
+			return nil, fmt.Errorf("failed to deserialize raw event: %v", err)
+		}
+		var recordResources cloudtrailRecordResources
+		if err := json.Unmarshal(record, &recordResources); err != nil {
+			return nil, fmt.Errorf("failed to deserialize raw event resources: %v", err)
+		}
+		cloudtrailEvents = append(cloudtrailEvents, parseCloudtrailRecord(rawEvent, recordResources))
+	}
+	return cloudtrailEvents, nil
+}
+
+func filterCloudtrailEvents(events []CloudtrailEvent, startTime time.Time, eventsFilter *EventsFilter) []CloudtrailEvent {
+	var filteredEvents []CloudtrailEvent
+	for _, event := range events {
+		if event.EventTime.Before(startTime) {
+			continue
+		}
+		if eventsFilter.EventName != nil && event.EventName != *eventsFilter.EventName {
+			continue
+		}
+		if eventsFilter.EventSource != nil && event.EventSource != *eventsFilter.EventSource {
+			continue
+		}
+		filteredEvents = append(filteredEvents, event)
+	}
+	return filteredEvents
+}
+
+func parseCloudtrailRecord(rawEvent cloudtrailRawEvent, recordResources cloudtrailRecordResources) CloudtrailEvent {
+	resources := make([]CloudTrailEventResource, 0)
+	for _, resource := range recordResources.Resources {
+		resources = append(resources, CloudTrailEventResource{ResourceType: resource.Type, ResourceName: resource.ARN})
+	}
+	// Secrets Manager records usually don't list their resources, LookupEvents derives them from the request's secret id
+	// (or the secret's name, for CreateSecret)
+	for _, parameter := range []string{"secretId", "name"} {
+		if secretId, ok := rawEvent.RequestParameters[parameter].(string); ok && len(resources) == 0 {
+			resources = append(resources, CloudTrailEventResource{ResourceType: "AWS::SecretsManager::Secret", ResourceName: secretId})
+		}
+	}
+
+	return CloudtrailEvent{
+		ExternalId:        rawEvent.EventID,
+		EventName:         rawEvent.EventName,
+		EventSource:       rawEvent.EventSource,
+		EventCategory:     rawEvent.EventCategory,
+		EventTime:         rawEvent.EventTime,
+		Region:            rawEvent.AwsRegion,
+		Username:          usernameOfIdentity(rawEvent.UserIdentity),
+		Resources:         resources,
+		UserIdentity:      rawEvent.UserIdentity,
+		SourceIpAddress:   rawEvent.SourceIpAddress,
+		UserAgent:         rawEvent.UserAgent,
+		VpcEndpointId:     rawEvent.VpcEndpointId,
+		ErrorCode:         rawEvent.ErrorCode,
+		RequestParameters: jsonutil.MustMarshalToString(rawEvent.RequestParameters),
+		ResponseElements:  jsonutil.MustMarshalToString(rawEvent.ResponseElements),
+	}
+}
+
+// usernameOfIdentity mimics the username LookupEvents returns: the IAM user's name, or the session name of an assumed role.
+func usernameOfIdentity(userIdentity AWSUserIdentity) string {
+	if userIdentity.UserName != "" {
+		return userIdentity.UserName
+	}
+	return userIdentity.Arn[strings.LastIndex(userIdentity.Arn, "/")+1:]
+}
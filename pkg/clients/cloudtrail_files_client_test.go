@@ -0,0 +1,135 @@
+package clients
+
+import (
+	"bytes"
+	"compress/gzip"
+	"os"
+	"path/filepath"
+	"reflect"
+	"testing"
+	"time"
+)
+
+const stdinLogFile = `{"Records": [
+	{"eventID": "1", "eventName": "GetSecretValue", "eventTime": "2024-10-01T10:00:00Z", "userIdentity": {"type": "IAMUser", "arn": "arn:aws:iam::123456789012:user/alice", "userName": "alice"}, "requestParameters": {"secretId": "db"}},
+	{"eventID": "2", "eventName": "PutSecretValue", "eventTime": "2024-10-02T10:00:00Z", "userIdentity": {"type": "IAMUser", "arn": "arn:aws:iam::123456789012:user/bob", "userName": "bob"}, "requestParameters": {"secretId": "db"}},
+	{"eventID": "3", "eventName": "GetSecretValue", "eventTime": "2024-10-03T10:00:00Z", "userIdentity": {"type": "IAMUser", "arn": "arn:aws:iam::123456789012:user/alice", "userName": "alice"}, "requestParameters": {"secretId": "db"}},
+	{"eventID": "4", "eventName": "AssumeRole", "eventTime": "2024-10-03T09:00:00Z", "userIdentity": {"type": "IAMUser", "arn": "arn:aws:iam::123456789012:user/bob", "userName": "bob"}, "requestParameters": {"roleArn": "arn:aws:iam::123456789012:role/deployer"}}
+]}`
+
+func TestCloudtrailFilesClientReadsStdinOnce(t *testing.T) {
+	stdinPath := filepath.Join(t.TempDir(), "stdin.json")
+	if err := os.WriteFile(stdinPath, []byte(stdinLogFile), 0o600); err != nil {
+		t.Fatal(err)
+	}
+	stdin, err := os.Open(stdinPath)
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer stdin.Close()
+	originalStdin := os.Stdin
+	os.Stdin = stdin
+	defer func() { os.Stdin = originalStdin }()
+
+	tests := []struct {
+		eventName string
+		startTime time.Time
+		eventIds  []string
+	}{
+		{eventName: "GetSecretValue", eventIds: []string{"1", "3"}},
+		{eventName: "PutSecretValue", eventIds: []string{"2"}},
+		{eventName: "DeleteSecret", eventIds: nil},
+		{eventName: "GetSecretValue", startTime: time.Date(2024, 10, 2, 0, 0, 0, 0, time.UTC), eventIds: []string{"3"}},
+		{eventName: "AssumeRole", eventIds: []string{"4"}},
+	}
+	for _, test := range tests {
+		// Every collection creates its own client, like the role chains resolver does
+		client := NewCloudtrailFilesClient([]string{StdinPath})
+		events, err := client.GetEvents(test.startTime, &EventsFilter{EventName: &test.eventName})
+		if err != nil {
+			t.Fatalf("%s: unexpected error: %v", test.eventName, err)
+		}
+		var eventIds []string
+		for _, event := range events {
+			eventIds = append(eventIds, event.ExternalId)
+		}
+		if len(eventIds) != len(test.eventIds) {
+			t.Fatalf("%s since %s: expected events %v, got %v", test.eventName, test.startTime, test.eventIds, eventIds)
+		}
+		for i := range eventIds {
+			if eventIds[i] != test.eventIds[i] {
+				t.Fatalf("%s since %s: expected events %v, got %v", test.eventName, test.startTime, test.eventIds, eventIds)
+			}
+		}
+	}
+}
+
+func TestCloudtrailFilesClientReadsLogFiles(t *testing.T) {
+	const logFile = `{"Records": [
+		{"eventID": "1", "eventName": "GetSecretValue", "eventSource": "secretsmanager.amazonaws.com", "eventTime": "2024-10-01T10:00:00Z", "awsRegion": "us-east-1", "errorCode": "AccessDenied", "userIdentity": {"type": "IAMUser", "arn": "arn:aws:iam::123456789012:user/alice", "userName": "alice"}, "requestParameters": {"secretId": "db"}},
+		{"eventID": "2", "eventName": "CreateSecret", "eventSource": "secretsmanager.amazonaws.com", "eventTime": "2024-10-02T10:00:00Z", "userIdentity": {"type": "AssumedRole", "arn": "arn:aws:sts::123456789012:assumed-role/deployer/bob"}, "requestParameters": {"name": "db"}},
+		{"eventID": "3", "eventName": "GetSecretValue", "eventSource": "secretsmanager.amazonaws.com", "eventTime": "2024-10-03T10:00:00Z", "userIdentity": {"type": "IAMUser", "arn": "arn:aws:iam::123456789012:user/alice", "userName": "alice"}, "resources": [{"ARN": "arn:aws:secretsmanager:us-east-1:123456789012:secret:db-AbCdEf", "type": "AWS::SecretsManager::Secret"}], "requestParameters": {"secretId": "db"}}
+	]}`
+	directory := t.TempDir()
+	if err := os.MkdirAll(filepath.Join(directory, "2024", "10"), 0o700); err != nil {
+		t.Fatal(err)
+	}
+	var gzipped bytes.Buffer
+	gzipWriter := gzip.NewWriter(&gzipped)
+	if _, err := gzipWriter.Write([]byte(logFile)); err != nil {
+		t.Fatal(err)
+	}
+	if err := gzipWriter.Close(); err != nil {
+		t.Fatal(err)
+	}
+	files := map[string][]byte{
+		filepath.Join("2024", "10", "log.json.gz"): gzipped.Bytes(),
+		"notes.txt": []byte("not a log file"),
+	}
+	for name, content := range files {
+		if err := os.WriteFile(filepath.Join(directory, name), content, 0o600); err != nil {
+			t.Fatal(err)
+		}
+	}
+
+	tests := []struct {
+		name      string
+		eventName string
+		expected  []CloudtrailEvent
+	}{
+		{
+			name:      "resources from the secret id of the request",
+			eventName: "GetSecretValue",
+			expected: []CloudtrailEvent{
+				{ExternalId: "1", Username: "alice", Region: "us-east-1", ErrorCode: "AccessDenied", Resources: []CloudTrailEventResource{{ResourceType: "AWS::SecretsManager::Secret", ResourceName: "db"}}},
+				{ExternalId: "3", Username: "alice", Resources: []CloudTrailEventResource{{ResourceType: "AWS::SecretsManager::Secret", ResourceName: "arn:aws:secretsmanager:us-east-1:123456789012:secret:db-AbCdEf"}}},
+			},
+		},
+		{
+			name:      "resources from the name of a created secret",
+			eventName: "CreateSecret",
+			expected: []CloudtrailEvent{
+				{ExternalId: "2", Username: "bob", Resources: []CloudTrailEventResource{{ResourceType: "AWS::SecretsManager::Secret", ResourceName: "db"}}},
+			},
+		},
+	}
+
+	for _, test := range tests {
+		t.Run(test.name, func(t *testing.T) {
+			events, err := NewCloudtrailFilesClient([]string{directory}).GetEvents(time.Time{}, &EventsFilter{EventName: &test.eventName})
+			if err != nil {
+				t.Fatal(err)
+			}
+			if len(events) != len(test.expected) {
+				t.Fatalf("expected %d events, got %+v", len(test.expected), events)
+			}
+			for i, event := range events {
+				expected := test.expected[i]
+				if event.ExternalId != expected.ExternalId || event.Username != expected.Username || event.Region != expected.Region ||
+					event.ErrorCode != expected.ErrorCode || !reflect.DeepEqual(event.Resources, expected.Resources) {
+					t.Errorf("expected the event %+v, got %+v", expected, event)
+				}
+			}
+		})
+	}
+}
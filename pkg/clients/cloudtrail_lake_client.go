@@ -0,0 +1,136 @@
+package clients
+
+import (
+	"context"
+	"fmt"
+	"strings"
+	"time"
+
+	"github.com/samber/lo"
+
+	"github.com/aws/aws-sdk-go-v2/aws"
+	"github.com/aws/aws-sdk-go-v2/service/cloudtrail"
+	"github.com/aws/aws-sdk-go-v2/service/cloudtrail/types"
+)
+
+// CloudTrail Lake returns timestamps without a time zone, in UTC
+const lakeTimeLayout = "2006-01-02 15:04:05"
+
+// CloudtrailLakeClient queries the events of a CloudTrail Lake event data store, which isn't limited to 90 days, a single region or a single account.
+type CloudtrailLakeClient struct {
+	client         *cloudtrail.Client
+	region         string
+	eventDataStore string
+	queryTimeout   time.Duration // A query still running after that long is cancelled (no limit when zero)
+}
+
+func NewCloudtrailLakeClient(region string, profile string, eventDataStore string, queryTimeout time.Duration) (client *CloudtrailLakeClient, err error) {
+	cfg, err := loadAWSConfig(region, profile)
+	if err != nil {
+		return nil, err
+	}
+
+	cloudtrailLakeClient := CloudtrailLakeClient{
+		client:         cloudtrail.NewFromConfig(cfg),
+		region:         region,
+		eventDataStore: eventDataStore,
+		queryTimeout:   queryTimeout,
+	}
+	return &cloudtrailLakeClient, nil
+}
+
+func (c *CloudtrailLakeClient) GetEvents(startTime time.Time, eventsFilter *EventsFilter) ([]CloudtrailEvent, error) {
+	// CreateSecret refers to the secret by its name rather than its id
+	secretIdColumn := "coalesce(element_at(requestParameters, 'secretId'), element_at(requestParameters, 'name'))"
+	columns := append(append([]string{}, cloudtrailQueryColumns...),
+		secretIdColumn+" AS secretId",
+		"element_at(requestParameters, 'roleArn') AS roleArn",
+		"element_at(requestParameters, 'versionStage') AS versionStage",
+		"json_extract_scalar(element_at(responseElements, 'credentials'), '$.accessKeyId') AS issuedAccessKeyId",
+	)
+	// The FROM clause takes the event data store's id, which is the last part of its ARN
+	eventDataStoreId := c.eventDataStore[strings.LastIndex(c.eventDataStore, "/")+1:]
+	statement := fmt.Sprintf("SELECT %s FROM %s WHERE %s", strings.Join(columns, ", "), eventDataStoreId,
+		strings.Join(cloudtrailQueryConditions(startTime, eventsFilter, lakeTimeLayout, secretIdColumn), " AND "))
+
+	rows, err := c.query(statement)
+	if err != nil {
+		return nil, fmt.Errorf("could not query cloudtrail lake events: %v", err)
+	}
+
+	var cloudtrailEvents []CloudtrailEvent
+	for _, row := range rows {
+		if !isQueryRowOfSecret(row, eventsFilter) {
+			continue
+		}
+		cloudtrailEvent, err := parseCloudtrailQueryRow(row, lakeTimeLayout)
+		if err != nil {
+			return nil, fmt.Errorf("failed to process event: %v", err)
+		}
+		cloudtrailEvents = append(cloudtrailEvents, *cloudtrailEvent)
+	}
+	return cloudtrailEvents, nil
+}
+
+func (c *CloudtrailLakeClient) query(statement string) ([]map[string]string, error) {
+	startResp, err := c.client.StartQuery(context.Background(), &cloudtrail.StartQueryInput{
+		QueryStatement: aws.String(statement),
+	})
+	if err != nil {
+		return nil, fmt.Errorf("failed to start query: %v", err)
+	}
+
+	ctx, cancel := queryDeadline(c.queryTimeout)
+	defer cancel()
+
+	var rows []map[string]string
+	var nextToken *string
+	for {
+		resp, err := c.client.GetQueryResults(context.Background(), &cloudtrail.GetQueryResultsInput{
+			QueryId:   startResp.QueryId,
+			NextToken: nextToken,
+		})
+		if err != nil {
+			return nil, fmt.Errorf("failed to get query results: %v", err)
+		}
+
+		switch resp.QueryStatus {
+		case types.QueryStatusQueued, types.QueryStatusRunning:
+			if err := waitToPollQuery(ctx); err != nil {
+				return nil, c.cancelQuery(startResp.QueryId)
+			}
+			continue
+		case types.QueryStatusFailed, types.QueryStatusCancelled, types.QueryStatusTimedOut:
+			return nil, fmt.Errorf("query %s: %s", strings.ToLower(string(resp.QueryStatus)), lo.FromPtr(resp.ErrorMessage))
+		}
+
+		// Each row is a list of single column maps
+		for _, resultRow := range resp.QueryResultRows {
+			row := map[string]string{}
+			for _, column := range resultRow {
+				for name, value := range column {
+					row[strings.ToLower(name)] = value
+				}
+			}
+			rows = append(rows, row)
+		}
+
+		if resp.NextToken == nil {
+			break
+		}
+		nextToken = resp.NextToken
+	}
+	return rows, nil
+}
+
+// cancelQuery cancels a query that timed out, so that it doesn't keep scanning the event data store in the background.
+func (c *CloudtrailLakeClient) cancelQuery(queryId *string) error {
+	_, err := c.client.CancelQuery(context.Background(), &cloudtrail.CancelQueryInput{
+		QueryId:        queryId,
+		EventDataStore: aws.String(c.eventDataStore),
+	})
+	if err != nil {
+		return fmt.Errorf("query timed out after %s, and failed to cancel it: %v", c.queryTimeout, err)
+	}
+	return fmt.Errorf("query timed out after %s, and was cancelled", c.queryTimeout)
+}
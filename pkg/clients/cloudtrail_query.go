@@ -0,0 +1,206 @@
+package clients
+
+import (
+	"context"
+	"fmt"
+	"strings"
+	"time"
+
+	jsonutil "github.com/torchsecurity/torch-secret-analyzer/pkg/utils/json"
+)
+
+const queryPollingInterval = time.Second
+
+// queryDeadline bounds the wait for a query to complete, where a zero timeout waits indefinitely.
+func queryDeadline(timeout time.Duration) (context.Context, context.CancelFunc) {
+	if timeout <= 0 {
+		return context.WithCancel(context.Background())
+	}
+	return context.WithTimeout(context.Background(), timeout)
+}
+
+// waitToPollQuery waits before polling a query again, failing once the query's deadline has passed.
+func waitToPollQuery(ctx context.Context) error {
+	select {
+	case <-ctx.Done():
+		return ctx.Err()
+	case <-time.After(queryPollingInterval):
+		return nil
+	}
+}
+
+// cloudtrailQueryColumns selects the fields of an event we analyze, flattened into columns, since nested fields are not returned as JSON.
+// Both CloudTrail Lake and the Athena CloudTrail table share this schema.
+var cloudtrailQueryColumns = []string{
+	"eventID AS eventId",
+	"eventName AS eventName",
+	"eventSource AS eventSource",
+	"eventTime AS eventTime",
+	"awsRegion AS awsRegion",
+	"eventCategory AS eventCategory",
+	"sourceIPAddress AS sourceIpAddress",
+	"userAgent AS userAgent",
+	"vpcEndpointId AS vpcEndpointId",
+	"errorCode AS errorCode",
+	"userIdentity.type AS identityType",
+	"userIdentity.principalId AS identityPrincipalId",
+	"userIdentity.arn AS identityArn",
+	"userIdentity.accountId AS identityAccountId",
+	"userIdentity.userName AS identityUserName",
+	"userIdentity.accessKeyId AS identityAccessKeyId",
+	"userIdentity.invokedBy AS identityInvokedBy",
+	"userIdentity.sessionContext.attributes.mfaAuthenticated AS sessionMfaAuthenticated",
+	"userIdentity.sessionContext.attributes.creationDate AS sessionCreationDate",
+	"userIdentity.sessionContext.sessionIssuer.type AS issuerType",
+	"userIdentity.sessionContext.sessionIssuer.principalId AS issuerPrincipalId",
+	"userIdentity.sessionContext.sessionIssuer.arn AS issuerArn",
+	"userIdentity.sessionContext.sessionIssuer.accountId AS issuerAccountId",
+	"userIdentity.sessionContext.sessionIssuer.userName AS issuerUserName",
+	"userIdentity.sessionContext.webIdFederationData.federatedProvider AS federatedProvider",
+	"userIdentity.sessionContext.ec2RoleDelivery AS ec2RoleDelivery",
+}
+
+func cloudtrailQueryColumnAliases() []string {
+	var aliases []string
+	for _, column := range cloudtrailQueryColumns {
+		aliases = append(aliases, column[strings.LastIndex(column, " ")+1:])
+	}
+	return aliases
+}
+
+// cloudtrailQueryConditions filters the events on the server side, by their name and the secret they refer to.
+// Like isResourceMatchingSecret, a secret id matches the secret's name, ARN, or an ARN of a secret with that name.
+// The ARN pattern is broader than that (e.g. it matches the ARNs of secrets whose name starts with "<id>-"), so the rows
+// still need to be filtered with isQueryRowOfSecret.
+func cloudtrailQueryConditions(startTime time.Time, eventsFilter *EventsFilter, timeLayout string, secretIdColumn string) []string {
+	eventSource := "secretsmanager.amazonaws.com"
+	if eventsFilter.EventSource != nil {
+		eventSource = *eventsFilter.EventSource
+	}
+	conditions := []string{fmt.Sprintf("eventSource = '%s'", escapeQueryString(eventSource))}
+	if !startTime.IsZero() {
+		conditions = append(conditions, fmt.Sprintf("eventTime >= '%s'", startTime.UTC().Format(timeLayout)))
+	}
+	if eventsFilter.EventName != nil {
+		conditions = append(conditions, fmt.Sprintf("eventName = '%s'", escapeQueryString(*eventsFilter.EventName)))
+	}
+	if eventsFilter.SecretId != nil {
+		secretId := escapeQueryString(*eventsFilter.SecretId)
+		secretIdPattern := escapeQueryString(escapeLikePattern(*eventsFilter.SecretId))
+		conditions = append(conditions, fmt.Sprintf(`(%s = '%s' OR %s LIKE '%%:secret:%s-%%' ESCAPE '\')`, secretIdColumn, secretId, secretIdColumn, secretIdPattern))
+	}
+	return conditions
+}
+
+func escapeQueryString(value string) string {
+	return strings.ReplaceAll(value, "'", "''")
+}
+
+// escapeLikePattern escapes the wildcards of a LIKE pattern whose escape character is '\', as secret names may contain '_' and '%'.
+func escapeLikePattern(value string) string {
+	return strings.NewReplacer(`\`, `\\`, `%`, `\%`, `_`, `\_`).Replace(value)
+}
+
+// isQueryRowOfSecret tells whether the secret id a row refers to is the secret, by its name or ARN, or an ARN of a secret with that name.
+func isQueryRowOfSecret(queryRow map[string]string, eventsFilter *EventsFilter) bool {
+	if eventsFilter.SecretId == nil {
+		return true
+	}
+	rowSecretId, secretId := queryRow["secretid"], *eventsFilter.SecretId
+	if rowSecretId == secretId {
+		return true
+	}
+	secretIndex := strings.Index(rowSecretId, ":secret:")
+	if !strings.HasPrefix(rowSecretId, "arn:") || secretIndex == -1 {
+		return false
+	}
+	// Secrets Manager suffixes the name in a secret's ARN with a hyphen and random characters
+	suffix, found := strings.CutPrefix(rowSecretId[secretIndex+len(":secret:"):], secretId+"-")
+	return found && suffix != "" && strings.IndexFunc(suffix, func(r rune) bool {
+		return !('a' <= r && r <= 'z' || 'A' <= r && r <= 'Z' || '0' <= r && r <= '9')
+	}) == -1
+}
+
+// parseCloudtrailQueryRow maps a row of cloudtrailQueryColumns back into an event.
+// Query engines don't agree on the case of column aliases, so the row's columns are expected in lower case.
+func parseCloudtrailQueryRow(queryRow map[string]string, timeLayout string) (*CloudtrailEvent, error) {
+	row := map[string]string{}
+	for _, column := range cloudtrailQueryColumnAliases() {
+		row[column] = queryRow[strings.ToLower(column)]
+	}
+	eventTime, err := time.Parse(timeLayout, row["eventTime"])
+	if err != nil {
+		return nil, fmt.Errorf("could not parse event time: %v", err)
+	}
+
+	userIdentity := AWSUserIdentity{
+		Type:        row["identityType"],
+		PrincipalId: row["identityPrincipalId"],
+		Arn:         row["identityArn"],
+		AccountId:   row["identityAccountId"],
+		UserName:    row["identityUserName"],
+		AccessKeyId: row["identityAccessKeyId"],
+		InvokedBy:   row["identityInvokedBy"],
+	}
+	if row["identityType"] == "AssumedRole" || row["issuerArn"] != "" || row["federatedProvider"] != "" {
+		userIdentity.SessionContext = &AWSUserIdentitySessionContext{
+			Attributes:      &AWSUserIdentitySessionContextAttributes{MfaAuthenticated: row["sessionMfaAuthenticated"]},
+			Ec2RoleDelivery: row["ec2RoleDelivery"],
+		}
+		if creationDate, err := time.Parse(timeLayout, row["sessionCreationDate"]); err == nil {
+			userIdentity.SessionContext.Attributes.CreationDate = &creationDate
+		}
+		if row["issuerArn"] != "" {
+			userIdentity.SessionContext.SessionIssuer = &AWSUserIdentitySessionContextSessionIssuer{
+				Type:        row["issuerType"],
+				PrincipalId: row["issuerPrincipalId"],
+				Arn:         row["issuerArn"],
+				AccountId:   row["issuerAccountId"],
+				UserName:    row["issuerUserName"],
+			}
+		}
+		if row["federatedProvider"] != "" {
+			userIdentity.SessionContext.WebIdFederationData = &AWSUserIdentitySessionContextWebIdFederationData{FederatedProvider: row["federatedProvider"]}
+		}
+	}
+
+	resources := make([]CloudTrailEventResource, 0)
+	row["secretId"] = queryRow["secretid"]
+	if row["secretId"] != "" {
+		resources = append(resources, CloudTrailEventResource{ResourceType: "AWS::SecretsManager::Secret", ResourceName: row["secretId"]})
+	}
+
+	// Only the request and response fields we analyze are selected, so we rebuild them from their columns
+	requestParameters := map[string]string{}
+	if row["secretId"] != "" {
+		requestParameters["secretId"] = row["secretId"]
+	}
+	if roleArn := queryRow["rolearn"]; roleArn != "" {
+		requestParameters["roleArn"] = roleArn
+	}
+	if versionStage := queryRow["versionstage"]; versionStage != "" {
+		requestParameters["versionStage"] = versionStage
+	}
+	var responseElements map[string]any
+	if issuedAccessKeyId := queryRow["issuedaccesskeyid"]; issuedAccessKeyId != "" {
+		responseElements = map[string]any{"credentials": map[string]string{"accessKeyId": issuedAccessKeyId}}
+	}
+
+	return &CloudtrailEvent{
+		ExternalId:        row["eventId"],
+		EventName:         row["eventName"],
+		EventSource:       row["eventSource"],
+		EventCategory:     row["eventCategory"],
+		EventTime:         eventTime,
+		Region:            row["awsRegion"],
+		Username:          usernameOfIdentity(userIdentity),
+		Resources:         resources,
+		UserIdentity:      userIdentity,
+		SourceIpAddress:   row["sourceIpAddress"],
+		UserAgent:         row["userAgent"],
+		VpcEndpointId:     row["vpcEndpointId"],
+		ErrorCode:         row["errorCode"],
+		RequestParameters: jsonutil.MustMarshalToString(requestParameters),
+		ResponseElements:  jsonutil.MustMarshalToString(responseElements),
+	}, nil
+}
@@ -0,0 +1,173 @@
+package clients
+
+import (
+	"reflect"
+	"testing"
+	"time"
+)
+
+func TestCloudtrailQueryConditionsEscapeSecretId(t *testing.T) {
+	secretId := "it's_100%"
+	conditions := cloudtrailQueryConditions(time.Time{}, &EventsFilter{SecretId: &secretId}, athenaTimeLayout, "secretId")
+	expected := `(secretId = 'it''s_100%' OR secretId LIKE '%:secret:it''s\_100\%-%' ESCAPE '\')`
+	if condition := conditions[len(conditions)-1]; condition != expected {
+		t.Fatalf("expected condition %s, got %s", expected, condition)
+	}
+}
+
+func TestIsQueryRowOfSecret(t *testing.T) {
+	tests := []struct {
+		rowSecretId string
+		secretId    string
+		expected    bool
+	}{
+		{rowSecretId: "my_db", secretId: "my_db", expected: true},
+		{rowSecretId: "arn:aws:secretsmanager:us-east-1:123456789012:secret:my_db-AbC123", secretId: "my_db", expected: true},
+		{rowSecretId: "arn:aws-us-gov:secretsmanager:us-gov-west-1:123456789012:secret:my_db-AbC123", secretId: "my_db", expected: true},
+		// Wildcards of the LIKE pattern
+		{rowSecretId: "arn:aws:secretsmanager:us-east-1:123456789012:secret:myXdb-AbC123", secretId: "my_db", expected: false},
+		{rowSecretId: "myXdb", secretId: "my_db", expected: false},
+		// Secrets whose name starts with the secret's name
+		{rowSecretId: "arn:aws:secretsmanager:us-east-1:123456789012:secret:my_db-replica-AbC123", secretId: "my_db", expected: false},
+		{rowSecretId: "arn:aws:secretsmanager:us-east-1:123456789012:secret:my_db-", secretId: "my_db", expected: false},
+	}
+	for _, test := range tests {
+		row := map[string]string{"secretid": test.rowSecretId}
+		if matches := isQueryRowOfSecret(row, &EventsFilter{SecretId: &test.secretId}); matches != test.expected {
+			t.Errorf("%s of %s: expected %t, got %t", test.rowSecretId, test.secretId, test.expected, matches)
+		}
+	}
+	if !isQueryRowOfSecret(map[string]string{"secretid": "other"}, &EventsFilter{}) {
+		t.Errorf("expected rows to match when not filtering by secret")
+	}
+}
+
+func TestParseCloudtrailQueryRow(t *testing.T) {
+	eventTime := time.Date(2024, 10, 1, 10, 0, 0, 0, time.UTC)
+	sessionCreationDate := time.Date(2024, 10, 1, 9, 0, 0, 0, time.UTC)
+	// Query results name their columns in lower case
+	roleSessionRow := func(timeLayout string) map[string]string {
+		return map[string]string{
+			"eventid":             "1",
+			"eventname":           "GetSecretValue",
+			"eventsource":         "secretsmanager.amazonaws.com",
+			"eventtime":           eventTime.Format(timeLayout),
+			"awsregion":           "us-east-1",
+			"sourceipaddress":     "10.0.0.1",
+			"useragent":           "aws-sdk-go-v2/1.30.0",
+			"errorcode":           "AccessDenied",
+			"identitytype":        "AssumedRole",
+			"identityprincipalid": "AROAAPP:i-1",
+			"identityarn":         "arn:aws:sts::123456789012:assumed-role/app/i-1",
+			"identityaccountid":   "123456789012",
+			"identityaccesskeyid": "ASIAAPP",
+			"sessioncreationdate": sessionCreationDate.Format(timeLayout),
+			"issuertype":          "Role",
+			"issuerprincipalid":   "AROAAPP",
+			"issuerarn":           "arn:aws:iam::123456789012:role/app",
+			"issueraccountid":     "123456789012",
+			"issuerusername":      "app",
+			"secretid":            "arn:aws:secretsmanager:us-east-1:123456789012:secret:db-AbCdEf",
+			"versionstage":        "AWSPREVIOUS",
+		}
+	}
+
+	tests := []struct {
+		name              string
+		row               map[string]string
+		timeLayout        string
+		userIdentity      AWSUserIdentity
+		resources         []CloudTrailEventResource
+		requestParameters string
+		responseElements  string
+	}{
+		{
+			name:       "role session read in CloudTrail Lake",
+			row:        roleSessionRow(lakeTimeLayout),
+			timeLayout: lakeTimeLayout,
+			userIdentity: AWSUserIdentity{
+				Type:        "AssumedRole",
+				PrincipalId: "AROAAPP:i-1",
+				Arn:         "arn:aws:sts::123456789012:assumed-role/app/i-1",
+				AccountId:   "123456789012",
+				AccessKeyId: "ASIAAPP",
+				SessionContext: &AWSUserIdentitySessionContext{
+					Attributes:    &AWSUserIdentitySessionContextAttributes{CreationDate: &sessionCreationDate},
+					SessionIssuer: &AWSUserIdentitySessionContextSessionIssuer{Type: "Role", PrincipalId: "AROAAPP", Arn: "arn:aws:iam::123456789012:role/app", AccountId: "123456789012", UserName: "app"},
+				},
+			},
+			resources:         []CloudTrailEventResource{{ResourceType: "AWS::SecretsManager::Secret", ResourceName: "arn:aws:secretsmanager:us-east-1:123456789012:secret:db-AbCdEf"}},
+			requestParameters: `{"secretId":"arn:aws:secretsmanager:us-east-1:123456789012:secret:db-AbCdEf","versionStage":"AWSPREVIOUS"}`,
+			responseElements:  `null`,
+		},
+		{
+			name:       "role session read in Athena",
+			row:        roleSessionRow(athenaTimeLayout),
+			timeLayout: athenaTimeLayout,
+			userIdentity: AWSUserIdentity{
+				Type:        "AssumedRole",
+				PrincipalId: "AROAAPP:i-1",
+				Arn:         "arn:aws:sts::123456789012:assumed-role/app/i-1",
+				AccountId:   "123456789012",
+				AccessKeyId: "ASIAAPP",
+				SessionContext: &AWSUserIdentitySessionContext{
+					Attributes:    &AWSUserIdentitySessionContextAttributes{CreationDate: &sessionCreationDate},
+					SessionIssuer: &AWSUserIdentitySessionContextSessionIssuer{Type: "Role", PrincipalId: "AROAAPP", Arn: "arn:aws:iam::123456789012:role/app", AccountId: "123456789012", UserName: "app"},
+				},
+			},
+			resources:         []CloudTrailEventResource{{ResourceType: "AWS::SecretsManager::Secret", ResourceName: "arn:aws:secretsmanager:us-east-1:123456789012:secret:db-AbCdEf"}},
+			requestParameters: `{"secretId":"arn:aws:secretsmanager:us-east-1:123456789012:secret:db-AbCdEf","versionStage":"AWSPREVIOUS"}`,
+			responseElements:  `null`,
+		},
+		{
+			name: "web identity assuming a role",
+			row: map[string]string{
+				"eventid":             "2",
+				"eventname":           "AssumeRoleWithWebIdentity",
+				"eventtime":           eventTime.Format(athenaTimeLayout),
+				"identitytype":        "WebIdentityUser",
+				"identityprincipalid": "oidc.eks.us-east-1.amazonaws.com/id/ABC:sub",
+				"federatedprovider":   "arn:aws:iam::123456789012:oidc-provider/oidc.eks.us-east-1.amazonaws.com/id/ABC",
+				"rolearn":             "arn:aws:iam::123456789012:role/app",
+				"issuedaccesskeyid":   "ASIAAPP",
+			},
+			timeLayout: athenaTimeLayout,
+			userIdentity: AWSUserIdentity{
+				Type:        "WebIdentityUser",
+				PrincipalId: "oidc.eks.us-east-1.amazonaws.com/id/ABC:sub",
+				SessionContext: &AWSUserIdentitySessionContext{
+					Attributes:          &AWSUserIdentitySessionContextAttributes{},
+					WebIdFederationData: &AWSUserIdentitySessionContextWebIdFederationData{FederatedProvider: "arn:aws:iam::123456789012:oidc-provider/oidc.eks.us-east-1.amazonaws.com/id/ABC"},
+				},
+			},
+			resources:         []CloudTrailEventResource{},
+			requestParameters: `{"roleArn":"arn:aws:iam::123456789012:role/app"}`,
+			responseElements:  `{"credentials":{"accessKeyId":"ASIAAPP"}}`,
+		},
+	}
+
+	for _, test := range tests {
+		t.Run(test.name, func(t *testing.T) {
+			event, err := parseCloudtrailQueryRow(test.row, test.timeLayout)
+			if err != nil {
+				t.Fatal(err)
+			}
+			if !event.EventTime.Equal(eventTime) || event.ExternalId != test.row["eventid"] || event.EventName != test.row["eventname"] || event.ErrorCode != test.row["errorcode"] {
+				t.Errorf("expected the event %s (%s) at %s, got %+v", test.row["eventid"], test.row["eventname"], eventTime, event)
+			}
+			if !reflect.DeepEqual(event.UserIdentity, test.userIdentity) {
+				t.Errorf("expected the user identity %+v, got %+v", test.userIdentity, event.UserIdentity)
+			}
+			if !reflect.DeepEqual(event.Resources, test.resources) {
+				t.Errorf("expected the resources %+v, got %+v", test.resources, event.Resources)
+			}
+			if event.RequestParameters != test.requestParameters || event.ResponseElements != test.responseElements {
+				t.Errorf("expected the request %s and response %s, got %s and %s", test.requestParameters, test.responseElements, event.RequestParameters, event.ResponseElements)
+			}
+		})
+	}
+
+	if _, err := parseCloudtrailQueryRow(map[string]string{"eventtime": "yesterday"}, athenaTimeLayout); err == nil {
+		t.Error("expected an error parsing a row with an invalid event time")
+	}
+}
@@ -0,0 +1,72 @@
+package clients
+
+import (
+	"context"
+	"fmt"
+
+	"github.com/samber/lo"
+
+	"github.com/aws/aws-sdk-go-v2/service/ec2"
+	"github.com/aws/aws-sdk-go-v2/service/ec2/types"
+)
+
+type EC2Instance struct {
+	InstanceId string
+	Name       string // The instance's Name tag
+}
+
+type EC2Client struct {
+	client *ec2.Client
+	region string
+}
+
+func NewEC2Client(region string, profile string) (client *EC2Client, err error) {
+	cfg, err := loadAWSConfig(region, profile)
+	if err != nil {
+		return nil, err
+	}
+
+	ec2Client := EC2Client{
+		client: ec2.NewFromConfig(cfg),
+		region: region,
+	}
+	return &ec2Client, nil
+}
+
+// DescribeRegions returns the regions enabled for the account.
+func (c *EC2Client) DescribeRegions() ([]string, error) {
+	resp, err := c.client.DescribeRegions(context.Background(), &ec2.DescribeRegionsInput{})
+	if err != nil {
+		return nil, fmt.Errorf("failed to describe regions: %v", err)
+	}
+
+	var regions []string
+	for _, region := range resp.Regions {
+		regions = append(regions, lo.FromPtr(region.RegionName))
+	}
+	return regions, nil
+}
+
+func (c *EC2Client) DescribeInstances() ([]EC2Instance, error) {
+	var instances []EC2Instance
+	paginator := ec2.NewDescribeInstancesPaginator(c.client, &ec2.DescribeInstancesInput{})
+	for paginator.HasMorePages() {
+		resp, err := paginator.NextPage(context.Background())
+		if err != nil {
+			return nil, fmt.Errorf("failed to describe instances: %v", err)
+		}
+
+		for _, reservation := range resp.Reservations {
+			for _, instance := range reservation.Instances {
+				nameTag, _ := lo.Find(instance.Tags, func(tag types.Tag) bool {
+					return lo.FromPtr(tag.Key) == "Name"
+				})
+				instances = append(instances, EC2Instance{
+					InstanceId: lo.FromPtr(instance.InstanceId),
+					Name:       lo.FromPtr(nameTag.Value),
+				})
+			}
+		}
+	}
+	return instances, nil
+}
@@ -0,0 +1,61 @@
+package clients
+
+import (
+	"context"
+	"fmt"
+
+	"github.com/samber/lo"
+
+	"github.com/aws/aws-sdk-go-v2/service/ecs"
+	"github.com/aws/aws-sdk-go-v2/service/ecs/types"
+)
+
+type ECSTaskDefinition struct {
+	Family      string
+	Arn         string
+	TaskRoleArn string
+}
+
+type ECSClient struct {
+	client *ecs.Client
+	region string
+}
+
+func NewECSClient(region string, profile string) (client *ECSClient, err error) {
+	cfg, err := loadAWSConfig(region, profile)
+	if err != nil {
+		return nil, err
+	}
+
+	ecsClient := ECSClient{
+		client: ecs.NewFromConfig(cfg),
+		region: region,
+	}
+	return &ecsClient, nil
+}
+
+// GetTaskDefinitions returns the latest revision of every active task definition family.
+func (c *ECSClient) GetTaskDefinitions() ([]ECSTaskDefinition, error) {
+	var taskDefinitions []ECSTaskDefinition
+	paginator := ecs.NewListTaskDefinitionFamiliesPaginator(c.client, &ecs.ListTaskDefinitionFamiliesInput{Status: types.TaskDefinitionFamilyStatusActive})
+	for paginator.HasMorePages() {
+		resp, err := paginator.NextPage(context.Background())
+		if err != nil {
+			return nil, fmt.Errorf("failed to list task definition families: %v", err)
+		}
+
+		for _, family := range resp.Families {
+			// Describing a family returns its latest active revision
+			taskDefinitionResp, err := c.client.DescribeTaskDefinition(context.Background(), &ecs.DescribeTaskDefinitionInput{TaskDefinition: &family})
+			if err != nil {
+				return nil, fmt.Errorf("failed to describe task definition %s: %v", family, err)
+			}
+			taskDefinitions = append(taskDefinitions, ECSTaskDefinition{
+				Family:      family,
+				Arn:         lo.FromPtr(taskDefinitionResp.TaskDefinition.TaskDefinitionArn),
+				TaskRoleArn: lo.FromPtr(taskDefinitionResp.TaskDefinition.TaskRoleArn),
+			})
+		}
+	}
+	return taskDefinitions, nil
+}
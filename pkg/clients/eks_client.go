@@ -0,0 +1,111 @@
+package clients
+
+import (
+	"context"
+	"fmt"
+
+	"github.com/samber/lo"
+
+	"github.com/aws/aws-sdk-go-v2/service/eks"
+)
+
+type EKSPodIdentityAssociation struct {
+	Namespace      string
+	ServiceAccount string
+	RoleArn        string
+}
+
+type EKSCluster struct {
+	Name                    string
+	Arn                     string
+	OidcIssuer              string // e.g. https://oidc.eks.us-east-1.amazonaws.com/id/EXAMPLED539D4633E53DE1B71EXAMPLE
+	PodIdentityAssociations []EKSPodIdentityAssociation
+}
+
+type EKSClient struct {
+	client *eks.Client
+	region string
+}
+
+func NewEKSClient(region string, profile string) (client *EKSClient, err error) {
+	cfg, err := loadAWSConfig(region, profile)
+	if err != nil {
+		return nil, err
+	}
+
+	eksClient := EKSClient{
+		client: eks.NewFromConfig(cfg),
+		region: region,
+	}
+	return &eksClient, nil
+}
+
+// GetClusters returns the clusters of the region, along with their OIDC issuer and pod identity associations.
+func (c *EKSClient) GetClusters() ([]EKSCluster, error) {
+	var clusters []EKSCluster
+	paginator := eks.NewListClustersPaginator(c.client, &eks.ListClustersInput{})
+	for paginator.HasMorePages() {
+		resp, err := paginator.NextPage(context.Background())
+		if err != nil {
+			return nil, fmt.Errorf("failed to list clusters: %v", err)
+		}
+
+		for _, clusterName := range resp.Clusters {
+			cluster, err := c.describeCluster(clusterName)
+			if err != nil {
+				return nil, err
+			}
+			clusters = append(clusters, *cluster)
+		}
+	}
+	return clusters, nil
+}
+
+func (c *EKSClient) describeCluster(clusterName string) (*EKSCluster, error) {
+	resp, err := c.client.DescribeCluster(context.Background(), &eks.DescribeClusterInput{Name: &clusterName})
+	if err != nil {
+		return nil, fmt.Errorf("failed to describe cluster %s: %v", clusterName, err)
+	}
+
+	cluster := EKSCluster{
+		Name: clusterName,
+		Arn:  lo.FromPtr(resp.Cluster.Arn),
+	}
+	if resp.Cluster.Identity != nil && resp.Cluster.Identity.Oidc != nil {
+		cluster.OidcIssuer = lo.FromPtr(resp.Cluster.Identity.Oidc.Issuer)
+	}
+
+	cluster.PodIdentityAssociations, err = c.getPodIdentityAssociations(clusterName)
+	if err != nil {
+		return nil, err
+	}
+	return &cluster, nil
+}
+
+// getPodIdentityAssociations lists the pod identity associations of a cluster. Their summaries don't include the role, so each association is described.
+func (c *EKSClient) getPodIdentityAssociations(clusterName string) ([]EKSPodIdentityAssociation, error) {
+	var associations []EKSPodIdentityAssociation
+	paginator := eks.NewListPodIdentityAssociationsPaginator(c.client, &eks.ListPodIdentityAssociationsInput{ClusterName: &clusterName})
+	for paginator.HasMorePages() {
+		resp, err := paginator.NextPage(context.Background())
+		if err != nil {
+			return nil, fmt.Errorf("failed to list pod identity associations of cluster %s: %v", clusterName, err)
+		}
+
+		for _, summary := range resp.Associations {
+			association, err := c.client.DescribePodIdentityAssociation(context.Background(), &eks.DescribePodIdentityAssociationInput{
+				ClusterName:   &clusterName,
+				AssociationId: summary.AssociationId,
+			})
+			if err != nil {
+				return nil, fmt.Errorf("failed to describe pod identity association %s: %v", lo.FromPtr(summary.AssociationId), err)
+			}
+			associations = append(associations, EKSPodIdentityAssociation{
+				Namespace:      lo.FromPtr(association.Association.Namespace),
+				ServiceAccount: lo.FromPtr(association.Association.ServiceAccount),
+				RoleArn:        lo.FromPtr(association.Association.RoleArn),
+			})
+		}
+	}
+	return associations, nil
+}
@@ -0,0 +1,65 @@
+package clients
+
+import (
+	"fmt"
+	"net"
+
+	"github.com/oschwald/maxminddb-golang"
+)
+
+type GeoIPRecord struct {
+	Country        string // The ISO code of the country
+	ASN            uint
+	ASOrganization string
+}
+
+type geoIPDatabaseRecord struct {
+	Country struct {
+		IsoCode string `maxminddb:"iso_code"`
+	} `maxminddb:"country"`
+	AutonomousSystemNumber       uint   `maxminddb:"autonomous_system_number"`
+	AutonomousSystemOrganization string `maxminddb:"autonomous_system_organization"`
+}
+
+// GeoIPClient looks up IP addresses in local MaxMind-format databases (e.g. GeoLite2 Country and ASN), with no network access.
+type GeoIPClient struct {
+	readers []*maxminddb.Reader
+}
+
+func NewGeoIPClient(databaseFiles []string) (client *GeoIPClient, err error) {
+	geoIPClient := GeoIPClient{}
+	for _, databaseFile := range databaseFiles {
+		reader, err := maxminddb.Open(databaseFile)
+		if err != nil {
+			geoIPClient.Close()
+			return nil, fmt.Errorf("failed to open GeoIP database %s: %v", databaseFile, err)
+		}
+		geoIPClient.readers = append(geoIPClient.readers, reader)
+	}
+	return &geoIPClient, nil
+}
+
+// Lookup merges the records of an IP address in all of the databases, as the country and the ASN are usually in separate databases.
+func (c *GeoIPClient) Lookup(ip net.IP) (GeoIPRecord, error) {
+	var record GeoIPRecord
+	for _, reader := range c.readers {
+		var databaseRecord geoIPDatabaseRecord
+		if err := reader.Lookup(ip, &databaseRecord); err != nil {
+			return record, fmt.Errorf("failed to look up %s: %v", ip, err)
+		}
+		if databaseRecord.Country.IsoCode != "" {
+			record.Country = databaseRecord.Country.IsoCode
+		}
+		if databaseRecord.AutonomousSystemNumber != 0 {
+			record.ASN = databaseRecord.AutonomousSystemNumber
+			record.ASOrganization = databaseRecord.AutonomousSystemOrganization
+		}
+	}
+	return record, nil
+}
+
+func (c *GeoIPClient) Close() {
+	for _, reader := range c.readers {
+		reader.Close()
+	}
+}
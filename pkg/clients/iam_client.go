@@ -0,0 +1,224 @@
+package clients
+
+import (
+	"context"
+	"fmt"
+	"net/url"
+
+	"github.com/samber/lo"
+
+	"github.com/aws/aws-sdk-go-v2/service/iam"
+	"github.com/aws/aws-sdk-go-v2/service/iam/types"
+)
+
+type IAMInlinePolicy struct {
+	PolicyName     string
+	PolicyDocument string
+}
+
+type IAMUser struct {
+	Arn                    string
+	UserId                 string
+	UserName               string
+	Path                   string
+	GroupNames             []string
+	InlinePolicies         []IAMInlinePolicy
+	AttachedPolicyArns     []string
+	PermissionsBoundaryArn string
+	Tags                   map[string]string
+}
+
+type IAMGroup struct {
+	Arn                string
+	GroupId            string
+	GroupName          string
+	InlinePolicies     []IAMInlinePolicy
+	AttachedPolicyArns []string
+}
+
+type IAMRole struct {
+	Arn                      string
+	RoleId                   string
+	RoleName                 string
+	Path                     string
+	AssumeRolePolicyDocument string
+	InlinePolicies           []IAMInlinePolicy
+	AttachedPolicyArns       []string
+	PermissionsBoundaryArn   string
+	Tags                     map[string]string
+}
+
+type IAMManagedPolicy struct {
+	Arn            string
+	PolicyName     string
+	PolicyDocument string
+}
+
+type IAMAuthorizationDetails struct {
+	Users    []IAMUser
+	Groups   []IAMGroup
+	Roles    []IAMRole
+	Policies map[string]IAMManagedPolicy // by policy arn
+}
+
+type IAMClient struct {
+	client *iam.Client
+	region string
+}
+
+func NewIAMClient(region string, profile string, options ...ConfigOption) (client *IAMClient, err error) {
+	cfg, err := loadAWSConfig(region, profile, options...)
+	if err != nil {
+		return nil, err
+	}
+
+	iamClient := IAMClient{
+		client: iam.NewFromConfig(cfg),
+		region: region,
+	}
+	return &iamClient, nil
+}
+
+// GetAuthorizationDetails loads every IAM user, group, role and managed policy (attached ones) of the account, along with their policy documents.
+func (c *IAMClient) GetAuthorizationDetails() (*IAMAuthorizationDetails, error) {
+	details := &IAMAuthorizationDetails{Policies: map[string]IAMManagedPolicy{}}
+
+	paginator := iam.NewGetAccountAuthorizationDetailsPaginator(c.client, &iam.GetAccountAuthorizationDetailsInput{})
+	for paginator.HasMorePages() {
+		resp, err := paginator.NextPage(context.Background())
+		if err != nil {
+			return nil, fmt.Errorf("failed to get account authorization details: %v", err)
+		}
+
+		for _, user := range resp.UserDetailList {
+			inlinePolicies, err := parseInlinePolicies(user.UserPolicyList)
+			if err != nil {
+				return nil, fmt.Errorf("could not parse policies of user %s: %v", lo.FromPtr(user.UserName), err)
+			}
+			details.Users = append(details.Users, IAMUser{
+				Arn:                    lo.FromPtr(user.Arn),
+				UserId:                 lo.FromPtr(user.UserId),
+				UserName:               lo.FromPtr(user.UserName),
+				Path:                   lo.FromPtr(user.Path),
+				GroupNames:             user.GroupList,
+				InlinePolicies:         inlinePolicies,
+				AttachedPolicyArns:     parseAttachedPolicies(user.AttachedManagedPolicies),
+				PermissionsBoundaryArn: parsePermissionsBoundary(user.PermissionsBoundary),
+				Tags:                   parseIAMTags(user.Tags),
+			})
+		}
+
+		for _, group := range resp.GroupDetailList {
+			inlinePolicies, err := parseInlinePolicies(group.GroupPolicyList)
+			if err != nil {
+				return nil, fmt.Errorf("could not parse policies of group %s: %v", lo.FromPtr(group.GroupName), err)
+			}
+			details.Groups = append(details.Groups, IAMGroup{
+				Arn:                lo.FromPtr(group.Arn),
+				GroupId:            lo.FromPtr(group.GroupId),
+				GroupName:          lo.FromPtr(group.GroupName),
+				InlinePolicies:     inlinePolicies,
+				AttachedPolicyArns: parseAttachedPolicies(group.AttachedManagedPolicies),
+			})
+		}
+
+		for _, role := range resp.RoleDetailList {
+			inlinePolicies, err := parseInlinePolicies(role.RolePolicyList)
+			if err != nil {
+				return nil, fmt.Errorf("could not parse policies of role %s: %v", lo.FromPtr(role.RoleName), err)
+			}
+			assumeRolePolicyDocument, err := decodePolicyDocument(role.AssumeRolePolicyDocument)
+			if err != nil {
+				return nil, fmt.Errorf("could not parse trust policy of role %s: %v", lo.FromPtr(role.RoleName), err)
+			}
+			details.Roles = append(details.Roles, IAMRole{
+				Arn:                      lo.FromPtr(role.Arn),
+				RoleId:                   lo.FromPtr(role.RoleId),
+				RoleName:                 lo.FromPtr(role.RoleName),
+				Path:                     lo.FromPtr(role.Path),
+				AssumeRolePolicyDocument: assumeRolePolicyDocument,
+				InlinePolicies:           inlinePolicies,
+				AttachedPolicyArns:       parseAttachedPolicies(role.AttachedManagedPolicies),
+				PermissionsBoundaryArn:   parsePermissionsBoundary(role.PermissionsBoundary),
+				Tags:                     parseIAMTags(role.Tags),
+			})
+		}
+
+		for _, policy := range resp.Policies {
+			for _, version := range policy.PolicyVersionList {
+				if !version.IsDefaultVersion {
+					continue
+				}
+				policyDocument, err := decodePolicyDocument(version.Document)
+				if err != nil {
+					return nil, fmt.Errorf("could not parse managed policy %s: %v", lo.FromPtr(policy.PolicyName), err)
+				}
+				details.Policies[lo.FromPtr(policy.Arn)] = IAMManagedPolicy{
+					Arn:            lo.FromPtr(policy.Arn),
+					PolicyName:     lo.FromPtr(policy.PolicyName),
+					PolicyDocument: policyDocument,
+				}
+			}
+		}
+	}
+
+	return details, nil
+}
+
+// GetAccountAlias returns the alias of the account, or an empty string if it has none.
+func (c *IAMClient) GetAccountAlias() (string, error) {
+	resp, err := c.client.ListAccountAliases(context.Background(), &iam.ListAccountAliasesInput{})
+	if err != nil {
+		return "", fmt.Errorf("failed to list account aliases: %v", err)
+	}
+
+	// An account can have at most one alias
+	if len(resp.AccountAliases) == 0 {
+		return "", nil
+	}
+	return resp.AccountAliases[0], nil
+}
+
+func parseInlinePolicies(policies []types.PolicyDetail) ([]IAMInlinePolicy, error) {
+	var inlinePolicies []IAMInlinePolicy
+	for _, policy := range policies {
+		policyDocument, err := decodePolicyDocument(policy.PolicyDocument)
+		if err != nil {
+			return nil, err
+		}
+		inlinePolicies = append(inlinePolicies, IAMInlinePolicy{
+			PolicyName:     lo.FromPtr(policy.PolicyName),
+			PolicyDocument: policyDocument,
+		})
+	}
+	return inlinePolicies, nil
+}
+
+func parseAttachedPolicies(policies []types.AttachedPolicy) []string {
+	return lo.Map(policies, func(policy types.AttachedPolicy, _ int) string {
+		return lo.FromPtr(policy.PolicyArn)
+	})
+}
+
+func parsePermissionsBoundary(boundary *types.AttachedPermissionsBoundary) string {
+	if boundary == nil {
+		return ""
+	}
+	return lo.FromPtr(boundary.PermissionsBoundaryArn)
+}
+
+func parseIAMTags(tags []types.Tag) map[string]string {
+	parsedTags := map[string]string{}
+	for _, tag := range tags {
+		parsedTags[lo.FromPtr(tag.Key)] = lo.FromPtr(tag.Value)
+	}
+	return parsedTags
+}
+
+// IAM returns policy documents URL-encoded (RFC 3986).
+func decodePolicyDocument(document *string) (string, error) {
+	if document == nil {
+		return "", nil
+	}
+	return url.QueryUnescape(*document)
+}
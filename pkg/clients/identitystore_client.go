@@ -0,0 +1,114 @@
+package clients
+
+import (
+	"context"
+	"fmt"
+
+	"github.com/samber/lo"
+
+	"github.com/aws/aws-sdk-go-v2/service/identitystore"
+	"github.com/aws/aws-sdk-go-v2/service/identitystore/types"
+)
+
+type IdentityStoreUser struct {
+	UserId      string
+	UserName    string
+	DisplayName string
+	Emails      []string
+}
+
+type IdentityStoreGroup struct {
+	GroupId     string
+	DisplayName string
+	MemberIds   []string // The user ids of the group's members
+}
+
+// IdentityStoreClient reads the users and groups of an IAM Identity Center identity store.
+type IdentityStoreClient struct {
+	client          *identitystore.Client
+	region          string
+	identityStoreId string
+}
+
+func NewIdentityStoreClient(region string, profile string, identityStoreId string) (client *IdentityStoreClient, err error) {
+	cfg, err := loadAWSConfig(region, profile)
+	if err != nil {
+		return nil, err
+	}
+
+	identityStoreClient := IdentityStoreClient{
+		client:          identitystore.NewFromConfig(cfg),
+		region:          region,
+		identityStoreId: identityStoreId,
+	}
+	return &identityStoreClient, nil
+}
+
+func (c *IdentityStoreClient) ListUsers() ([]IdentityStoreUser, error) {
+	var users []IdentityStoreUser
+	paginator := identitystore.NewListUsersPaginator(c.client, &identitystore.ListUsersInput{IdentityStoreId: &c.identityStoreId})
+	for paginator.HasMorePages() {
+		resp, err := paginator.NextPage(context.Background())
+		if err != nil {
+			return nil, fmt.Errorf("failed to list users: %v", err)
+		}
+
+		for _, user := range resp.Users {
+			users = append(users, IdentityStoreUser{
+				UserId:      lo.FromPtr(user.UserId),
+				UserName:    lo.FromPtr(user.UserName),
+				DisplayName: lo.FromPtr(user.DisplayName),
+				Emails: lo.Map(user.Emails, func(email types.Email, _ int) string {
+					return lo.FromPtr(email.Value)
+				}),
+			})
+		}
+	}
+	return users, nil
+}
+
+// ListGroups returns the groups of the identity store, along with their members.
+func (c *IdentityStoreClient) ListGroups() ([]IdentityStoreGroup, error) {
+	var groups []IdentityStoreGroup
+	paginator := identitystore.NewListGroupsPaginator(c.client, &identitystore.ListGroupsInput{IdentityStoreId: &c.identityStoreId})
+	for paginator.HasMorePages() {
+		resp, err := paginator.NextPage(context.Background())
+		if err != nil {
+			return nil, fmt.Errorf("failed to list groups: %v", err)
+		}
+
+		for _, group := range resp.Groups {
+			memberIds, err := c.listGroupMemberIds(lo.FromPtr(group.GroupId))
+			if err != nil {
+				return nil, err
+			}
+			groups = append(groups, IdentityStoreGroup{
+				GroupId:     lo.FromPtr(group.GroupId),
+				DisplayName: lo.FromPtr(group.DisplayName),
+				MemberIds:   memberIds,
+			})
+		}
+	}
+	return groups, nil
+}
+
+func (c *IdentityStoreClient) listGroupMemberIds(groupId string) ([]string, error) {
+	var memberIds []string
+	paginator := identitystore.NewListGroupMembershipsPaginator(c.client, &identitystore.ListGroupMembershipsInput{
+		IdentityStoreId: &c.identityStoreId,
+		GroupId:         &groupId,
+	})
+	for paginator.HasMorePages() {
+		resp, err := paginator.NextPage(context.Background())
+		if err != nil {
+			return nil, fmt.Errorf("failed to list memberships of group %s: %v", groupId, err)
+		}
+
+		for _, membership := range resp.GroupMemberships {
+			if userId, ok := membership.MemberId.(*types.MemberIdMemberUserId); ok {
+				memberIds = append(memberIds, userId.Value)
+			}
+		}
+	}
+	return memberIds, nil
+}
@@ -0,0 +1,100 @@
+package clients
+
+import (
+	"context"
+	"fmt"
+
+	"github.com/samber/lo"
+
+	"github.com/aws/aws-sdk-go-v2/aws"
+	"github.com/aws/aws-sdk-go-v2/service/kms"
+	"github.com/aws/aws-sdk-go-v2/service/kms/types"
+)
+
+type KMSKey struct {
+	Arn        string
+	KeyId      string
+	KeyManager string // "AWS" for AWS managed keys, "CUSTOMER" for customer managed keys
+}
+
+type KMSGrant struct {
+	GrantId                 string
+	GranteePrincipal        string
+	Operations              []string
+	EncryptionContextEquals map[string]string
+	EncryptionContextSubset map[string]string
+}
+
+type KMSClient struct {
+	client *kms.Client
+	region string
+}
+
+func NewKMSClient(region string, profile string) (client *KMSClient, err error) {
+	cfg, err := loadAWSConfig(region, profile)
+	if err != nil {
+		return nil, err
+	}
+
+	kmsClient := KMSClient{
+		client: kms.NewFromConfig(cfg),
+		region: region,
+	}
+	return &kmsClient, nil
+}
+
+func (c *KMSClient) DescribeKey(keyId string) (*KMSKey, error) {
+	resp, err := c.client.DescribeKey(context.Background(), &kms.DescribeKeyInput{
+		KeyId: aws.String(keyId),
+	})
+	if err != nil {
+		return nil, fmt.Errorf("failed to describe kms key: %v", err)
+	}
+
+	return &KMSKey{
+		Arn:        lo.FromPtr(resp.KeyMetadata.Arn),
+		KeyId:      lo.FromPtr(resp.KeyMetadata.KeyId),
+		KeyManager: string(resp.KeyMetadata.KeyManager),
+	}, nil
+}
+
+func (c *KMSClient) GetKeyPolicy(keyId string) (string, error) {
+	resp, err := c.client.GetKeyPolicy(context.Background(), &kms.GetKeyPolicyInput{
+		KeyId:      aws.String(keyId),
+		PolicyName: aws.String("default"), // The only policy name KMS supports
+	})
+	if err != nil {
+		return "", fmt.Errorf("failed to get kms key policy: %v", err)
+	}
+
+	return lo.FromPtr(resp.Policy), nil
+}
+
+func (c *KMSClient) ListGrants(keyId string) ([]KMSGrant, error) {
+	var grants []KMSGrant
+
+	paginator := kms.NewListGrantsPaginator(c.client, &kms.ListGrantsInput{KeyId: aws.String(keyId)})
+	for paginator.HasMorePages() {
+		resp, err := paginator.NextPage(context.Background())
+		if err != nil {
+			return nil, fmt.Errorf("failed to list kms grants: %v", err)
+		}
+
+		for _, grant := range resp.Grants {
+			kmsGrant := KMSGrant{
+				GrantId:          lo.FromPtr(grant.GrantId),
+				GranteePrincipal: lo.FromPtr(grant.GranteePrincipal),
+				Operations: lo.Map(grant.Operations, func(operation types.GrantOperation, _ int) string {
+					return string(operation)
+				}),
+			}
+			if grant.Constraints != nil {
+				kmsGrant.EncryptionContextEquals = grant.Constraints.EncryptionContextEquals
+				kmsGrant.EncryptionContextSubset = grant.Constraints.EncryptionContextSubset
+			}
+			grants = append(grants, kmsGrant)
+		}
+	}
+
+	return grants, nil
+}
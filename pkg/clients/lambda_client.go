@@ -0,0 +1,54 @@
+package clients
+
+import (
+	"context"
+	"fmt"
+
+	"github.com/samber/lo"
+
+	"github.com/aws/aws-sdk-go-v2/service/lambda"
+)
+
+type LambdaFunction struct {
+	FunctionName string
+	FunctionArn  string
+	RoleArn      string // The execution role of the function
+}
+
+type LambdaClient struct {
+	client *lambda.Client
+	region string
+}
+
+func NewLambdaClient(region string, profile string) (client *LambdaClient, err error) {
+	cfg, err := loadAWSConfig(region, profile)
+	if err != nil {
+		return nil, err
+	}
+
+	lambdaClient := LambdaClient{
+		client: lambda.NewFromConfig(cfg),
+		region: region,
+	}
+	return &lambdaClient, nil
+}
+
+func (c *LambdaClient) ListFunctions() ([]LambdaFunction, error) {
+	var functions []LambdaFunction
+	paginator := lambda.NewListFunctionsPaginator(c.client, &lambda.ListFunctionsInput{})
+	for paginator.HasMorePages() {
+		resp, err := paginator.NextPage(context.Background())
+		if err != nil {
+			return nil, fmt.Errorf("failed to list functions: %v", err)
+		}
+
+		for _, function := range resp.Functions {
+			functions = append(functions, LambdaFunction{
+				FunctionName: lo.FromPtr(function.FunctionName),
+				FunctionArn:  lo.FromPtr(function.FunctionArn),
+				RoleArn:      lo.FromPtr(function.Role),
+			})
+		}
+	}
+	return functions, nil
+}
@@ -0,0 +1,82 @@
+package clients
+
+import (
+	"context"
+	"errors"
+	"fmt"
+
+	"github.com/samber/lo"
+
+	"github.com/aws/aws-sdk-go-v2/service/organizations"
+	"github.com/aws/aws-sdk-go-v2/service/organizations/types"
+)
+
+type Organization struct {
+	Id                  string
+	Arn                 string
+	ManagementAccountId string
+}
+
+type Account struct {
+	Id     string
+	Name   string
+	Status string
+}
+
+type OrganizationsClient struct {
+	client *organizations.Client
+	region string
+}
+
+func NewOrganizationsClient(region string, profile string) (client *OrganizationsClient, err error) {
+	cfg, err := loadAWSConfig(region, profile)
+	if err != nil {
+		return nil, err
+	}
+
+	organizationsClient := OrganizationsClient{
+		client: organizations.NewFromConfig(cfg),
+		region: region,
+	}
+	return &organizationsClient, nil
+}
+
+// DescribeOrganization returns the organization the account belongs to. If the account is not a member of an organization, an empty organization is returned.
+func (c *OrganizationsClient) DescribeOrganization() (*Organization, error) {
+	resp, err := c.client.DescribeOrganization(context.Background(), &organizations.DescribeOrganizationInput{})
+	if err != nil {
+		var notInUseErr *types.AWSOrganizationsNotInUseException
+		if errors.As(err, &notInUseErr) {
+			return &Organization{}, nil
+		}
+		return nil, fmt.Errorf("failed to describe organization: %v", err)
+	}
+
+	return &Organization{
+		Id:                  lo.FromPtr(resp.Organization.Id),
+		Arn:                 lo.FromPtr(resp.Organization.Arn),
+		ManagementAccountId: lo.FromPtr(resp.Organization.MasterAccountId),
+	}, nil
+}
+
+// ListAccounts returns the member accounts of the organization. Only the management account and delegated administrators can list them.
+func (c *OrganizationsClient) ListAccounts() ([]Account, error) {
+	var accounts []Account
+
+	paginator := organizations.NewListAccountsPaginator(c.client, &organizations.ListAccountsInput{})
+	for paginator.HasMorePages() {
+		resp, err := paginator.NextPage(context.Background())
+		if err != nil {
+			return nil, fmt.Errorf("failed to list accounts: %v", err)
+		}
+
+		for _, account := range resp.Accounts {
+			accounts = append(accounts, Account{
+				Id:     lo.FromPtr(account.Id),
+				Name:   lo.FromPtr(account.Name),
+				Status: string(account.Status),
+			})
+		}
+	}
+	return accounts, nil
+}
@@ -0,0 +1,140 @@
+package clients
+
+import (
+	"context"
+	"fmt"
+	"time"
+
+	"github.com/samber/lo"
+
+	"github.com/aws/aws-sdk-go-v2/aws"
+	"github.com/aws/aws-sdk-go-v2/service/secretsmanager"
+	"github.com/aws/aws-sdk-go-v2/service/secretsmanager/types"
+)
+
+type Secret struct {
+	Arn              string
+	Name             string
+	KmsKeyId         string
+	Tags             map[string]string
+	RotationEnabled  bool
+	LastRotatedDate  time.Time
+	LastAccessedDate time.Time // Secrets Manager only keeps the date, not the time
+	PrimaryRegion    string    // Only set for replicas
+	ReplicaRegions   []string
+	CreatedDate      time.Time
+	DeletedDate      time.Time // Only set for secrets scheduled for deletion
+	RotationInterval int64     // In days, zero when the rotation is scheduled by an expression or disabled
+	NextRotationDate time.Time
+}
+
+type SecretsManagerClient struct {
+	client *secretsmanager.Client
+	region string
+}
+
+func NewSecretsManagerClient(region string, profile string) (client *SecretsManagerClient, err error) {
+	cfg, err := loadAWSConfig(region, profile)
+	if err != nil {
+		return nil, err
+	}
+
+	secretsManagerClient := SecretsManagerClient{
+		client: secretsmanager.NewFromConfig(cfg),
+		region: region,
+	}
+	return &secretsManagerClient, nil
+}
+
+func (c *SecretsManagerClient) DescribeSecret(secretId string) (*Secret, error) {
+	resp, err := c.client.DescribeSecret(context.Background(), &secretsmanager.DescribeSecretInput{
+		SecretId: aws.String(secretId),
+	})
+	if err != nil {
+		return nil, fmt.Errorf("failed to describe secret: %v", err)
+	}
+
+	return &Secret{
+		Arn:              lo.FromPtr(resp.ARN),
+		Name:             lo.FromPtr(resp.Name),
+		KmsKeyId:         lo.FromPtr(resp.KmsKeyId),
+		Tags:             parseSecretTags(resp.Tags),
+		RotationEnabled:  lo.FromPtr(resp.RotationEnabled),
+		LastRotatedDate:  lo.FromPtr(resp.LastRotatedDate),
+		LastAccessedDate: lo.FromPtr(resp.LastAccessedDate),
+		PrimaryRegion:    lo.FromPtr(resp.PrimaryRegion),
+		ReplicaRegions:   parseReplicaRegions(resp.ReplicationStatus),
+		CreatedDate:      lo.FromPtr(resp.CreatedDate),
+		DeletedDate:      lo.FromPtr(resp.DeletedDate),
+		RotationInterval: parseRotationInterval(resp.RotationRules),
+		NextRotationDate: lo.FromPtr(resp.NextRotationDate),
+	}, nil
+}
+
+// ListSecrets lists the secrets of the region, and optionally the secrets that are scheduled for deletion too.
+func (c *SecretsManagerClient) ListSecrets(includePlannedDeletion bool) ([]Secret, error) {
+	var secrets []Secret
+
+	paginator := secretsmanager.NewListSecretsPaginator(c.client, &secretsmanager.ListSecretsInput{
+		IncludePlannedDeletion: aws.Bool(includePlannedDeletion),
+	})
+	for paginator.HasMorePages() {
+		resp, err := paginator.NextPage(context.Background())
+		if err != nil {
+			return nil, fmt.Errorf("failed to list secrets: %v", err)
+		}
+
+		for _, secret := range resp.SecretList {
+			secrets = append(secrets, Secret{
+				Arn:              lo.FromPtr(secret.ARN),
+				Name:             lo.FromPtr(secret.Name),
+				KmsKeyId:         lo.FromPtr(secret.KmsKeyId),
+				Tags:             parseSecretTags(secret.Tags),
+				RotationEnabled:  lo.FromPtr(secret.RotationEnabled),
+				LastRotatedDate:  lo.FromPtr(secret.LastRotatedDate),
+				LastAccessedDate: lo.FromPtr(secret.LastAccessedDate),
+				PrimaryRegion:    lo.FromPtr(secret.PrimaryRegion),
+				CreatedDate:      lo.FromPtr(secret.CreatedDate),
+				DeletedDate:      lo.FromPtr(secret.DeletedDate),
+				RotationInterval: parseRotationInterval(secret.RotationRules),
+				NextRotationDate: lo.FromPtr(secret.NextRotationDate),
+			})
+		}
+	}
+	return secrets, nil
+}
+
+// GetResourcePolicy returns the resource-based policy attached to the secret, or an empty string if the secret has none.
+func (c *SecretsManagerClient) GetResourcePolicy(secretId string) (string, error) {
+	resp, err := c.client.GetResourcePolicy(context.Background(), &secretsmanager.GetResourcePolicyInput{
+		SecretId: aws.String(secretId),
+	})
+	if err != nil {
+		return "", fmt.Errorf("failed to get secret resource policy: %v", err)
+	}
+
+	return lo.FromPtr(resp.ResourcePolicy), nil
+}
+
+func parseReplicaRegions(replicationStatus []types.ReplicationStatusType) []string {
+	var regions []string
+	for _, replica := range replicationStatus {
+		regions = append(regions, lo.FromPtr(replica.Region))
+	}
+	return regions
+}
+
+func parseRotationInterval(rotationRules *types.RotationRulesType) int64 {
+	if rotationRules == nil {
+		return 0
+	}
+	return lo.FromPtr(rotationRules.AutomaticallyAfterDays)
+}
+
+func parseSecretTags(tags []types.Tag) map[string]string {
+	parsedTags := map[string]string{}
+	for _, tag := range tags {
+		parsedTags[lo.FromPtr(tag.Key)] = lo.FromPtr(tag.Value)
+	}
+	return parsedTags
+}
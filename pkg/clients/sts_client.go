@@ -0,0 +1,51 @@
+package clients
+
+import (
+	"context"
+	"fmt"
+
+	"github.com/aws/aws-sdk-go-v2/aws/arn"
+	"github.com/aws/aws-sdk-go-v2/service/sts"
+	"github.com/samber/lo"
+)
+
+type CallerIdentity struct {
+	AccountId string
+	Arn       string
+	Partition string // e.g. aws, aws-us-gov or aws-cn
+}
+
+type STSClient struct {
+	client *sts.Client
+	region string
+}
+
+func NewSTSClient(region string, profile string) (client *STSClient, err error) {
+	cfg, err := loadAWSConfig(region, profile)
+	if err != nil {
+		return nil, err
+	}
+
+	stsClient := STSClient{
+		client: sts.NewFromConfig(cfg),
+		region: region,
+	}
+	return &stsClient, nil
+}
+
+func (c *STSClient) GetCallerIdentity() (*CallerIdentity, error) {
+	resp, err := c.client.GetCallerIdentity(context.Background(), &sts.GetCallerIdentityInput{})
+	if err != nil {
+		return nil, fmt.Errorf("failed to get caller identity: %v", err)
+	}
+
+	callerArn, err := arn.Parse(lo.FromPtr(resp.Arn))
+	if err != nil {
+		return nil, fmt.Errorf("failed to parse caller identity arn: %v", err)
+	}
+	return &CallerIdentity{
+		AccountId: lo.FromPtr(resp.Account),
+		Arn:       callerArn.String(),
+		Partition: callerArn.Partition,
+	}, nil
+}
@@ -1,54 +1,222 @@
 package aws_cloudtrail
 
 import (
+	"errors"
 	"fmt"
+	"sync"
 	"time"
 
+	"github.com/samber/lo"
 	"github.com/torchsecurity/torch-secret-analyzer/pkg/clients"
 )
 
 const (
-	CreateSecretEvent   = "CreateSecret"
-	GetSecretValueEvent = "GetSecretValue"
-	PutSecretValueEvent = "PutSecretValue"
-	UpdateSecretEvent   = "UpdateSecret"
-	RotateSecretEvent   = "RotateSecret"
+	CreateSecretEvent      = "CreateSecret"
+	GetSecretValueEvent    = "GetSecretValue"
+	PutSecretValueEvent    = "PutSecretValue"
+	UpdateSecretEvent      = "UpdateSecret"
+	RotateSecretEvent      = "RotateSecret"
+	DeleteSecretEvent      = "DeleteSecret"
+	RestoreSecretEvent     = "RestoreSecret"
+	PutResourcePolicyEvent = "PutResourcePolicy"
+
+	AssumeRoleEvent                = "AssumeRole"
+	AssumeRoleWithSAMLEvent        = "AssumeRoleWithSAML"
+	AssumeRoleWithWebIdentityEvent = "AssumeRoleWithWebIdentity"
 )
 
-var SupportedEvents = []string{
+// ReadEvents are the events of reading a secret's value
+var ReadEvents = []string{
 	GetSecretValueEvent,
 }
 
+// WriteEvents are the events of creating, modifying, rotating, deleting or re-permissioning a secret
+var WriteEvents = []string{
+	CreateSecretEvent,
+	PutSecretValueEvent,
+	UpdateSecretEvent,
+	RotateSecretEvent,
+	DeleteSecretEvent,
+	RestoreSecretEvent,
+	PutResourcePolicyEvent,
+}
+
+var SupportedEvents = append(append([]string{}, ReadEvents...), WriteEvents...)
+
+// AssumeRoleEvents are the events of issuing role sessions, which are used to follow role chains back to their originating identity
+var AssumeRoleEvents = []string{
+	AssumeRoleEvent,
+	AssumeRoleWithSAMLEvent,
+	AssumeRoleWithWebIdentityEvent,
+}
+
+const (
+	secretsManagerEventSource = "secretsmanager.amazonaws.com"
+	stsEventSource            = "sts.amazonaws.com"
+)
+
+func eventSourceOf(eventName string) string {
+	if lo.Contains(AssumeRoleEvents, eventName) {
+		return stsEventSource
+	}
+	return secretsManagerEventSource
+}
+
 type EventsByName map[string][]clients.CloudtrailEvent
 
-func CollectCloudTrail(region string, daysBack int, profile string) (cloudtrailEvents EventsByName, err error) {
-	cloudtrailClient, err := clients.NewCloudtrailClient(region, profile)
+// LookupEvents is throttled per account and region, so the accounts and the regions of each account are collected a few at a time
+const (
+	maxConcurrentAccounts = 8
+	maxConcurrentRegions  = 4
+)
+
+func CollectCloudTrail(region string, daysBack int, eventNames []string, profile string, options ...clients.ConfigOption) (cloudtrailEvents EventsByName, err error) {
+	cloudtrailClient, err := clients.NewCloudtrailClient(region, profile, options...)
 	if err != nil {
 		return nil, fmt.Errorf("could not initial cloudtrail client %w", err)
 	}
 	collector := NewCloudTrailCollector(region, profile, cloudtrailClient)
-	return collector.Collect(daysBack)
+	return collector.Collect(daysBack, eventNames)
+}
+
+// CollectCloudTrailRegions collects the events of several regions concurrently, with a CloudTrail client per region.
+func CollectCloudTrailRegions(regions []string, daysBack int, eventNames []string, profile string, options ...clients.ConfigOption) (cloudtrailEvents EventsByName, err error) {
+	var wg sync.WaitGroup
+	var mutex sync.Mutex
+	var errs []error
+	allEvents := EventsByName{}
+	semaphore := make(chan struct{}, maxConcurrentRegions)
+	for _, region := range regions {
+		wg.Add(1)
+		go func(region string) {
+			defer wg.Done()
+			semaphore <- struct{}{}
+			events, err := CollectCloudTrail(region, daysBack, eventNames, profile, options...)
+			<-semaphore
+
+			mutex.Lock()
+			defer mutex.Unlock()
+			if err != nil {
+				errs = append(errs, fmt.Errorf("error collecting cloudtrail data in region %s: %v", region, err))
+				return
+			}
+			for eventName, regionEvents := range events {
+				allEvents[eventName] = append(allEvents[eventName], regionEvents...)
+			}
+		}(region)
+	}
+	wg.Wait()
+
+	if len(errs) > 0 {
+		return nil, errors.Join(errs...)
+	}
+	return allEvents, nil
+}
+
+// CollectCloudTrailAccounts collects the events of several accounts (and regions) concurrently, by assuming a role in each account
+// but the caller's own (e.g. the management account, which has no OrganizationAccountAccessRole).
+// Cross-account reads are logged by both the reader's and the secret's accounts, so events are deduplicated by their id.
+// The events of the accounts that could be collected are returned along with the errors of the ones that couldn't.
+func CollectCloudTrailAccounts(accountIds []string, callerAccountId string, partition string, roleName string, regions []string, daysBack int, eventNames []string, profile string) (cloudtrailEvents EventsByName, accountErrs []error) {
+	var wg sync.WaitGroup
+	var mutex sync.Mutex
+	allEvents := EventsByName{}
+	collectedEventIds := map[string]bool{}
+	semaphore := make(chan struct{}, maxConcurrentAccounts)
+	for _, accountId := range accountIds {
+		wg.Add(1)
+		go func(accountId string) {
+			defer wg.Done()
+			semaphore <- struct{}{}
+			events, err := CollectCloudTrailRegions(regions, daysBack, eventNames, profile, clients.WithAccountRole(partition, accountId, callerAccountId, roleName))
+			<-semaphore
+
+			mutex.Lock()
+			defer mutex.Unlock()
+			if err != nil {
+				accountErrs = append(accountErrs, fmt.Errorf("error collecting cloudtrail data in account %s: %v", accountId, err))
+				return
+			}
+			for eventName, accountEvents := range events {
+				for _, event := range accountEvents {
+					if !collectedEventIds[event.ExternalId] {
+						collectedEventIds[event.ExternalId] = true
+						allEvents[eventName] = append(allEvents[eventName], event)
+					}
+				}
+			}
+		}(accountId)
+	}
+	wg.Wait()
+	return allEvents, accountErrs
+}
+
+// CollectCloudTrailFiles collects the events from exported CloudTrail log files instead of the CloudTrail API, so no AWS credentials are needed.
+// A daysBack of 0 collects all the events in the files.
+func CollectCloudTrailFiles(paths []string, daysBack int, eventNames []string) (cloudtrailEvents EventsByName, err error) {
+	collector := NewCloudTrailCollector("", "", clients.NewCloudtrailFilesClient(paths))
+	return collector.Collect(daysBack, eventNames)
+}
+
+// CollectCloudTrailLake collects the events of a secret from a CloudTrail Lake event data store instead of the CloudTrail API.
+// An empty secretId collects the events of all secrets, and a query still running after queryTimeout is cancelled.
+func CollectCloudTrailLake(region string, daysBack int, eventNames []string, profile string, eventDataStore string, queryTimeout time.Duration, secretId string) (cloudtrailEvents EventsByName, err error) {
+	cloudtrailLakeClient, err := clients.NewCloudtrailLakeClient(region, profile, eventDataStore, queryTimeout)
+	if err != nil {
+		return nil, fmt.Errorf("could not initial cloudtrail lake client %w", err)
+	}
+	collector := NewCloudTrailCollector(region, profile, cloudtrailLakeClient)
+	return collector.CollectSecretEvents(daysBack, eventNames, secretId)
+}
+
+// CollectCloudTrailAthena collects the events of a secret from an Athena table over CloudTrail log files in S3.
+// An empty secretId collects the events of all secrets, and a query still running after queryTimeout is cancelled.
+func CollectCloudTrailAthena(region string, daysBack int, eventNames []string, profile string, table clients.AthenaTable, queryTimeout time.Duration, secretId string) (cloudtrailEvents EventsByName, err error) {
+	cloudtrailAthenaClient, err := clients.NewCloudtrailAthenaClient(region, profile, table, queryTimeout)
+	if err != nil {
+		return nil, fmt.Errorf("could not initial athena client %w", err)
+	}
+	collector := NewCloudTrailCollector(region, profile, cloudtrailAthenaClient)
+	return collector.CollectSecretEvents(daysBack, eventNames, secretId)
+}
+
+// EventsGetter is a source of CloudTrail events, such as the CloudTrail API or exported log files.
+type EventsGetter interface {
+	GetEvents(startTime time.Time, eventsFilter *clients.EventsFilter) ([]clients.CloudtrailEvent, error)
 }
 
 type CloudTrailCollector struct {
-	region           string
-	profile          string
-	cloudtrailClient *clients.CloudtrailClient
+	region       string
+	profile      string
+	eventsGetter EventsGetter
 }
 
-func NewCloudTrailCollector(region string, profile string, cloudtrailClient *clients.CloudtrailClient) *CloudTrailCollector {
+func NewCloudTrailCollector(region string, profile string, eventsGetter EventsGetter) *CloudTrailCollector {
 	return &CloudTrailCollector{
-		region:           region,
-		profile:          profile,
-		cloudtrailClient: cloudtrailClient,
+		region:       region,
+		profile:      profile,
+		eventsGetter: eventsGetter,
 	}
 }
 
-func (c *CloudTrailCollector) Collect(daysBack int) (cloudtrailEvents EventsByName, err error) {
-	startTime := time.Now().AddDate(0, 0, -daysBack)
+func (c *CloudTrailCollector) Collect(daysBack int, eventNames []string) (cloudtrailEvents EventsByName, err error) {
+	return c.CollectSecretEvents(daysBack, eventNames, "")
+}
+
+// CollectSecretEvents collects the events of a single secret, when the events source supports filtering by secret.
+func (c *CloudTrailCollector) CollectSecretEvents(daysBack int, eventNames []string, secretId string) (cloudtrailEvents EventsByName, err error) {
+	var startTime time.Time
+	if daysBack > 0 {
+		startTime = time.Now().AddDate(0, 0, -daysBack)
+	}
 	allEvents := EventsByName{}
-	for _, eventName := range SupportedEvents {
-		events, err := c.cloudtrailClient.GetEvents(startTime, &clients.EventsFilter{EventName: &eventName})
+	for _, eventName := range eventNames {
+		eventSource := eventSourceOf(eventName)
+		eventsFilter := &clients.EventsFilter{EventName: &eventName, EventSource: &eventSource}
+		if secretId != "" {
+			eventsFilter.SecretId = &secretId
+		}
+		events, err := c.eventsGetter.GetEvents(startTime, eventsFilter)
 		if err != nil {
 			return nil, fmt.Errorf("error collecting cloudtrail data for event %s: %v", eventName, err)
 		}
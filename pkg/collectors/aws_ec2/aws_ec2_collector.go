@@ -0,0 +1,55 @@
+package aws_ec2
+
+import (
+	"fmt"
+
+	"github.com/torchsecurity/torch-secret-analyzer/pkg/clients"
+)
+
+func CollectRegions(region string, profile string) (regions []string, err error) {
+	ec2Client, err := clients.NewEC2Client(region, profile)
+	if err != nil {
+		return nil, fmt.Errorf("could not initial ec2 client %w", err)
+	}
+	collector := NewEC2Collector(region, profile, ec2Client)
+	return collector.CollectRegions()
+}
+
+func CollectInstances(region string, profile string) (instances []clients.EC2Instance, err error) {
+	ec2Client, err := clients.NewEC2Client(region, profile)
+	if err != nil {
+		return nil, fmt.Errorf("could not initial ec2 client %w", err)
+	}
+	collector := NewEC2Collector(region, profile, ec2Client)
+	return collector.CollectInstances()
+}
+
+type EC2Collector struct {
+	region    string
+	profile   string
+	ec2Client *clients.EC2Client
+}
+
+func NewEC2Collector(region string, profile string, ec2Client *clients.EC2Client) *EC2Collector {
+	return &EC2Collector{
+		region:    region,
+		profile:   profile,
+		ec2Client: ec2Client,
+	}
+}
+
+func (c *EC2Collector) CollectRegions() (regions []string, err error) {
+	regions, err = c.ec2Client.DescribeRegions()
+	if err != nil {
+		return nil, fmt.Errorf("error collecting regions: %v", err)
+	}
+	return regions, nil
+}
+
+func (c *EC2Collector) CollectInstances() (instances []clients.EC2Instance, err error) {
+	instances, err = c.ec2Client.DescribeInstances()
+	if err != nil {
+		return nil, fmt.Errorf("error collecting instances: %v", err)
+	}
+	return instances, nil
+}
@@ -0,0 +1,38 @@
+package aws_ecs
+
+import (
+	"fmt"
+
+	"github.com/torchsecurity/torch-secret-analyzer/pkg/clients"
+)
+
+func CollectTaskDefinitions(region string, profile string) (taskDefinitions []clients.ECSTaskDefinition, err error) {
+	ecsClient, err := clients.NewECSClient(region, profile)
+	if err != nil {
+		return nil, fmt.Errorf("could not initial ecs client %w", err)
+	}
+	collector := NewECSCollector(region, profile, ecsClient)
+	return collector.CollectTaskDefinitions()
+}
+
+type ECSCollector struct {
+	region    string
+	profile   string
+	ecsClient *clients.ECSClient
+}
+
+func NewECSCollector(region string, profile string, ecsClient *clients.ECSClient) *ECSCollector {
+	return &ECSCollector{
+		region:    region,
+		profile:   profile,
+		ecsClient: ecsClient,
+	}
+}
+
+func (c *ECSCollector) CollectTaskDefinitions() (taskDefinitions []clients.ECSTaskDefinition, err error) {
+	taskDefinitions, err = c.ecsClient.GetTaskDefinitions()
+	if err != nil {
+		return nil, fmt.Errorf("error collecting ecs task definitions: %v", err)
+	}
+	return taskDefinitions, nil
+}
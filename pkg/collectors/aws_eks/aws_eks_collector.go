@@ -0,0 +1,38 @@
+package aws_eks
+
+import (
+	"fmt"
+
+	"github.com/torchsecurity/torch-secret-analyzer/pkg/clients"
+)
+
+func CollectClusters(region string, profile string) (clusters []clients.EKSCluster, err error) {
+	eksClient, err := clients.NewEKSClient(region, profile)
+	if err != nil {
+		return nil, fmt.Errorf("could not initial eks client %w", err)
+	}
+	collector := NewEKSCollector(region, profile, eksClient)
+	return collector.CollectClusters()
+}
+
+type EKSCollector struct {
+	region    string
+	profile   string
+	eksClient *clients.EKSClient
+}
+
+func NewEKSCollector(region string, profile string, eksClient *clients.EKSClient) *EKSCollector {
+	return &EKSCollector{
+		region:    region,
+		profile:   profile,
+		eksClient: eksClient,
+	}
+}
+
+func (c *EKSCollector) CollectClusters() (clusters []clients.EKSCluster, err error) {
+	clusters, err = c.eksClient.GetClusters()
+	if err != nil {
+		return nil, fmt.Errorf("error collecting eks clusters: %v", err)
+	}
+	return clusters, nil
+}
@@ -0,0 +1,56 @@
+package aws_iam
+
+import (
+	"fmt"
+
+	"github.com/torchsecurity/torch-secret-analyzer/pkg/clients"
+)
+
+func CollectIAM(region string, profile string) (authorizationDetails *clients.IAMAuthorizationDetails, err error) {
+	iamClient, err := clients.NewIAMClient(region, profile)
+	if err != nil {
+		return nil, fmt.Errorf("could not initial iam client %w", err)
+	}
+	collector := NewIAMCollector(region, profile, iamClient)
+	return collector.Collect()
+}
+
+// CollectAccountAlias collects the alias of the account the client's credentials (or assumed role) belong to.
+func CollectAccountAlias(region string, profile string, options ...clients.ConfigOption) (alias string, err error) {
+	iamClient, err := clients.NewIAMClient(region, profile, options...)
+	if err != nil {
+		return "", fmt.Errorf("could not initial iam client %w", err)
+	}
+	collector := NewIAMCollector(region, profile, iamClient)
+	return collector.CollectAccountAlias()
+}
+
+type IAMCollector struct {
+	region    string
+	profile   string
+	iamClient *clients.IAMClient
+}
+
+func NewIAMCollector(region string, profile string, iamClient *clients.IAMClient) *IAMCollector {
+	return &IAMCollector{
+		region:    region,
+		profile:   profile,
+		iamClient: iamClient,
+	}
+}
+
+func (c *IAMCollector) Collect() (authorizationDetails *clients.IAMAuthorizationDetails, err error) {
+	authorizationDetails, err = c.iamClient.GetAuthorizationDetails()
+	if err != nil {
+		return nil, fmt.Errorf("error collecting iam authorization details: %v", err)
+	}
+	return authorizationDetails, nil
+}
+
+func (c *IAMCollector) CollectAccountAlias() (alias string, err error) {
+	alias, err = c.iamClient.GetAccountAlias()
+	if err != nil {
+		return "", fmt.Errorf("error collecting account alias: %v", err)
+	}
+	return alias, nil
+}
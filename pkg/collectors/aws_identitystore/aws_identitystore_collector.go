@@ -0,0 +1,42 @@
+package aws_identitystore
+
+import (
+	"fmt"
+
+	"github.com/torchsecurity/torch-secret-analyzer/pkg/clients"
+)
+
+func CollectUsersAndGroups(region string, profile string, identityStoreId string) (users []clients.IdentityStoreUser, groups []clients.IdentityStoreGroup, err error) {
+	identityStoreClient, err := clients.NewIdentityStoreClient(region, profile, identityStoreId)
+	if err != nil {
+		return nil, nil, fmt.Errorf("could not initial identitystore client %w", err)
+	}
+	collector := NewIdentityStoreCollector(region, profile, identityStoreClient)
+	return collector.CollectUsersAndGroups()
+}
+
+type IdentityStoreCollector struct {
+	region              string
+	profile             string
+	identityStoreClient *clients.IdentityStoreClient
+}
+
+func NewIdentityStoreCollector(region string, profile string, identityStoreClient *clients.IdentityStoreClient) *IdentityStoreCollector {
+	return &IdentityStoreCollector{
+		region:              region,
+		profile:             profile,
+		identityStoreClient: identityStoreClient,
+	}
+}
+
+func (c *IdentityStoreCollector) CollectUsersAndGroups() (users []clients.IdentityStoreUser, groups []clients.IdentityStoreGroup, err error) {
+	users, err = c.identityStoreClient.ListUsers()
+	if err != nil {
+		return nil, nil, fmt.Errorf("error collecting identity store users: %v", err)
+	}
+	groups, err = c.identityStoreClient.ListGroups()
+	if err != nil {
+		return nil, nil, fmt.Errorf("error collecting identity store groups: %v", err)
+	}
+	return users, groups, nil
+}
@@ -0,0 +1,38 @@
+package aws_lambda
+
+import (
+	"fmt"
+
+	"github.com/torchsecurity/torch-secret-analyzer/pkg/clients"
+)
+
+func CollectFunctions(region string, profile string) (functions []clients.LambdaFunction, err error) {
+	lambdaClient, err := clients.NewLambdaClient(region, profile)
+	if err != nil {
+		return nil, fmt.Errorf("could not initial lambda client %w", err)
+	}
+	collector := NewLambdaCollector(region, profile, lambdaClient)
+	return collector.CollectFunctions()
+}
+
+type LambdaCollector struct {
+	region       string
+	profile      string
+	lambdaClient *clients.LambdaClient
+}
+
+func NewLambdaCollector(region string, profile string, lambdaClient *clients.LambdaClient) *LambdaCollector {
+	return &LambdaCollector{
+		region:       region,
+		profile:      profile,
+		lambdaClient: lambdaClient,
+	}
+}
+
+func (c *LambdaCollector) CollectFunctions() (functions []clients.LambdaFunction, err error) {
+	functions, err = c.lambdaClient.ListFunctions()
+	if err != nil {
+		return nil, fmt.Errorf("error collecting lambda functions: %v", err)
+	}
+	return functions, nil
+}
@@ -0,0 +1,59 @@
+package aws_organizations
+
+import (
+	"fmt"
+
+	"github.com/samber/lo"
+	"github.com/torchsecurity/torch-secret-analyzer/pkg/clients"
+)
+
+func CollectOrganization(region string, profile string) (organization *clients.Organization, err error) {
+	organizationsClient, err := clients.NewOrganizationsClient(region, profile)
+	if err != nil {
+		return nil, fmt.Errorf("could not initial organizations client %w", err)
+	}
+	collector := NewOrganizationsCollector(region, profile, organizationsClient)
+	return collector.CollectOrganization()
+}
+
+func CollectAccounts(region string, profile string) (accounts []clients.Account, err error) {
+	organizationsClient, err := clients.NewOrganizationsClient(region, profile)
+	if err != nil {
+		return nil, fmt.Errorf("could not initial organizations client %w", err)
+	}
+	collector := NewOrganizationsCollector(region, profile, organizationsClient)
+	return collector.CollectAccounts()
+}
+
+type OrganizationsCollector struct {
+	region              string
+	profile             string
+	organizationsClient *clients.OrganizationsClient
+}
+
+func NewOrganizationsCollector(region string, profile string, organizationsClient *clients.OrganizationsClient) *OrganizationsCollector {
+	return &OrganizationsCollector{
+		region:              region,
+		profile:             profile,
+		organizationsClient: organizationsClient,
+	}
+}
+
+func (c *OrganizationsCollector) CollectOrganization() (organization *clients.Organization, err error) {
+	organization, err = c.organizationsClient.DescribeOrganization()
+	if err != nil {
+		return nil, fmt.Errorf("error collecting organization: %v", err)
+	}
+	return organization, nil
+}
+
+// CollectAccounts collects the active member accounts of the organization.
+func (c *OrganizationsCollector) CollectAccounts() (accounts []clients.Account, err error) {
+	accounts, err = c.organizationsClient.ListAccounts()
+	if err != nil {
+		return nil, fmt.Errorf("error collecting accounts: %v", err)
+	}
+	return lo.Filter(accounts, func(account clients.Account, _ int) bool {
+		return account.Status == "ACTIVE"
+	}), nil
+}
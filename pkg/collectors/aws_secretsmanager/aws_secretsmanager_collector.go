@@ -0,0 +1,163 @@
+package aws_secretsmanager
+
+import (
+	"fmt"
+
+	"github.com/aws/aws-sdk-go-v2/aws/arn"
+	"github.com/samber/lo"
+	"github.com/torchsecurity/torch-secret-analyzer/pkg/clients"
+)
+
+type SecretDetails struct {
+	Secret         clients.Secret
+	ResourcePolicy string
+	EncryptionKey  *EncryptionKeyDetails // nil when the secret is encrypted with the default aws/secretsmanager key
+}
+
+type EncryptionKeyDetails struct {
+	Key       clients.KMSKey
+	KeyPolicy string
+	Grants    []clients.KMSGrant
+}
+
+func CollectSecret(region string, profile string, secretId string) (secretDetails *SecretDetails, err error) {
+	secretsManagerClient, err := clients.NewSecretsManagerClient(region, profile)
+	if err != nil {
+		return nil, fmt.Errorf("could not initial secrets manager client %w", err)
+	}
+	kmsClient, err := clients.NewKMSClient(region, profile)
+	if err != nil {
+		return nil, fmt.Errorf("could not initial kms client %w", err)
+	}
+	collector := NewSecretsManagerCollector(region, profile, secretsManagerClient, kmsClient)
+	return collector.CollectSecret(secretId)
+}
+
+func CollectSecrets(region string, profile string) (secrets []clients.Secret, err error) {
+	secretsManagerClient, err := clients.NewSecretsManagerClient(region, profile)
+	if err != nil {
+		return nil, fmt.Errorf("could not initial secrets manager client %w", err)
+	}
+	// Listing secrets doesn't require their KMS keys
+	collector := NewSecretsManagerCollector(region, profile, secretsManagerClient, nil)
+	return collector.CollectSecrets()
+}
+
+// CollectSecretsDetails collects all secrets, including the ones scheduled for deletion, with their resource policies.
+// Their encryption keys are not collected.
+func CollectSecretsDetails(region string, profile string) (secretsDetails []SecretDetails, err error) {
+	secretsManagerClient, err := clients.NewSecretsManagerClient(region, profile)
+	if err != nil {
+		return nil, fmt.Errorf("could not initial secrets manager client %w", err)
+	}
+	collector := NewSecretsManagerCollector(region, profile, secretsManagerClient, nil)
+	return collector.CollectSecretsDetails()
+}
+
+func CollectSecretRegions(region string, profile string, secretId string) (regions []string, err error) {
+	secretsManagerClient, err := clients.NewSecretsManagerClient(region, profile)
+	if err != nil {
+		return nil, fmt.Errorf("could not initial secrets manager client %w", err)
+	}
+	collector := NewSecretsManagerCollector(region, profile, secretsManagerClient, nil)
+	return collector.CollectSecretRegions(secretId)
+}
+
+type SecretsManagerCollector struct {
+	region               string
+	profile              string
+	secretsManagerClient *clients.SecretsManagerClient
+	kmsClient            *clients.KMSClient
+}
+
+func NewSecretsManagerCollector(region string, profile string, secretsManagerClient *clients.SecretsManagerClient, kmsClient *clients.KMSClient) *SecretsManagerCollector {
+	return &SecretsManagerCollector{
+		region:               region,
+		profile:              profile,
+		secretsManagerClient: secretsManagerClient,
+		kmsClient:            kmsClient,
+	}
+}
+
+func (c *SecretsManagerCollector) CollectSecret(secretId string) (secretDetails *SecretDetails, err error) {
+	secret, err := c.secretsManagerClient.DescribeSecret(secretId)
+	if err != nil {
+		return nil, fmt.Errorf("error collecting secret %s: %v", secretId, err)
+	}
+	resourcePolicy, err := c.secretsManagerClient.GetResourcePolicy(secret.Arn)
+	if err != nil {
+		return nil, fmt.Errorf("error collecting resource policy of secret %s: %v", secretId, err)
+	}
+	secretDetails = &SecretDetails{Secret: *secret, ResourcePolicy: resourcePolicy}
+
+	if secret.KmsKeyId != "" {
+		secretDetails.EncryptionKey, err = c.collectEncryptionKey(secret.KmsKeyId)
+		if err != nil {
+			return nil, fmt.Errorf("error collecting encryption key of secret %s: %v", secretId, err)
+		}
+	}
+	return secretDetails, nil
+}
+
+func (c *SecretsManagerCollector) CollectSecrets() (secrets []clients.Secret, err error) {
+	secrets, err = c.secretsManagerClient.ListSecrets(false)
+	if err != nil {
+		return nil, fmt.Errorf("error collecting secrets: %v", err)
+	}
+	return secrets, nil
+}
+
+func (c *SecretsManagerCollector) CollectSecretsDetails() (secretsDetails []SecretDetails, err error) {
+	secrets, err := c.secretsManagerClient.ListSecrets(true)
+	if err != nil {
+		return nil, fmt.Errorf("error collecting secrets: %v", err)
+	}
+	for _, secret := range secrets {
+		resourcePolicy, err := c.secretsManagerClient.GetResourcePolicy(secret.Arn)
+		if err != nil {
+			return nil, fmt.Errorf("error collecting resource policy of secret %s: %v", secret.Name, err)
+		}
+		secretsDetails = append(secretsDetails, SecretDetails{Secret: secret, ResourcePolicy: resourcePolicy})
+	}
+	return secretsDetails, nil
+}
+
+// CollectSecretRegions collects the regions a secret is replicated to, including its primary region.
+func (c *SecretsManagerCollector) CollectSecretRegions(secretId string) (regions []string, err error) {
+	secret, err := c.secretsManagerClient.DescribeSecret(secretId)
+	if err != nil {
+		return nil, fmt.Errorf("error collecting secret %s: %v", secretId, err)
+	}
+
+	secretArn, err := arn.Parse(secret.Arn)
+	if err != nil {
+		return nil, fmt.Errorf("error parsing secret arn %s: %v", secret.Arn, err)
+	}
+	regions = append([]string{secretArn.Region}, secret.ReplicaRegions...)
+	if secret.PrimaryRegion != "" {
+		regions = append(regions, secret.PrimaryRegion)
+	}
+	return lo.Uniq(regions), nil
+}
+
+func (c *SecretsManagerCollector) collectEncryptionKey(keyId string) (*EncryptionKeyDetails, error) {
+	key, err := c.kmsClient.DescribeKey(keyId)
+	if err != nil {
+		return nil, err
+	}
+	encryptionKey := &EncryptionKeyDetails{Key: *key}
+	// Access to AWS managed keys is managed by AWS, so there is no point in collecting their policy and grants
+	if key.KeyManager == "AWS" {
+		return encryptionKey, nil
+	}
+
+	encryptionKey.KeyPolicy, err = c.kmsClient.GetKeyPolicy(key.Arn)
+	if err != nil {
+		return nil, err
+	}
+	encryptionKey.Grants, err = c.kmsClient.ListGrants(key.Arn)
+	if err != nil {
+		return nil, err
+	}
+	return encryptionKey, nil
+}
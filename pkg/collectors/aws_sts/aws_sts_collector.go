@@ -0,0 +1,38 @@
+package aws_sts
+
+import (
+	"fmt"
+
+	"github.com/torchsecurity/torch-secret-analyzer/pkg/clients"
+)
+
+func CollectCallerIdentity(region string, profile string) (callerIdentity *clients.CallerIdentity, err error) {
+	stsClient, err := clients.NewSTSClient(region, profile)
+	if err != nil {
+		return nil, fmt.Errorf("could not initial sts client %w", err)
+	}
+	collector := NewSTSCollector(region, profile, stsClient)
+	return collector.CollectCallerIdentity()
+}
+
+type STSCollector struct {
+	region    string
+	profile   string
+	stsClient *clients.STSClient
+}
+
+func NewSTSCollector(region string, profile string, stsClient *clients.STSClient) *STSCollector {
+	return &STSCollector{
+		region:    region,
+		profile:   profile,
+		stsClient: stsClient,
+	}
+}
+
+func (c *STSCollector) CollectCallerIdentity() (callerIdentity *clients.CallerIdentity, err error) {
+	callerIdentity, err = c.stsClient.GetCallerIdentity()
+	if err != nil {
+		return nil, fmt.Errorf("error collecting caller identity: %v", err)
+	}
+	return callerIdentity, nil
+}
@@ -0,0 +1,233 @@
+package engines
+
+import (
+	"fmt"
+	"sort"
+	"strings"
+	"time"
+
+	"github.com/samber/lo"
+	"github.com/torchsecurity/torch-secret-analyzer/pkg/clients"
+	"github.com/torchsecurity/torch-secret-analyzer/pkg/collectors/aws_cloudtrail"
+	timeutil "github.com/torchsecurity/torch-secret-analyzer/pkg/utils/time"
+)
+
+// AnomalyKind is the check that flagged a read as an anomaly.
+type AnomalyKind string
+
+const (
+	NewConsumerAnomaly     AnomalyKind = "new-consumer"
+	HumanOnMachineAnomaly  AnomalyKind = "human-on-machine-secret"
+	NewSourceIpAnomaly     AnomalyKind = "new-source-ip"
+	NewASNAnomaly          AnomalyKind = "new-asn"
+	UnusualHoursAnomaly    AnomalyKind = "unusual-hours"
+	ReadVolumeSpikeAnomaly AnomalyKind = "read-volume-spike"
+)
+
+const (
+	minBaselineReadsForHours = 10  // A consumer's usual hours are only known after enough reads
+	minSpikeReads            = 10  // A handful of reads is not a spike, even for a consumer that rarely reads the secret
+	spikeFactor              = 3.0 // How many times its baseline daily reads a consumer has to read the secret a day to spike
+)
+
+// AnomalyPeriods splits the collection window into a baseline period, that tells what the usual access to a secret is,
+// and a detection period, whose reads are compared with it.
+type AnomalyPeriods struct {
+	BaselineStart  time.Time
+	DetectionStart time.Time
+	DetectionEnd   time.Time
+}
+
+// AccessAnomaly is a consumer's reads in the detection period that stand out from the baseline period.
+type AccessAnomaly struct {
+	Kind       AnomalyKind `json:"kind" yaml:"kind"`
+	DetectedAt time.Time   `json:"detectedAt" yaml:"detectedAt"` // The first read that fired the anomaly
+	Reason     string      `json:"reason" yaml:"reason"`
+	Consumer   Consumer    `json:"consumer" yaml:"consumer"` // The consumer, with the stats of its reads in the detection period
+}
+
+// consumerBaseline is how a consumer read a secret in the baseline period, in any of its sessions.
+type consumerBaseline struct {
+	reads       int
+	sourceIps   map[string]bool
+	asns        map[uint]bool
+	hoursOfDays map[int]bool // In UTC
+}
+
+// DetectAWSAccessAnomalies flags the consumers that read a secret in the detection period for the first time, humans that read
+// a secret only machines read in the baseline period, and consumers that read it from new source IPs or ASNs, outside of their
+// usual hours or much more than usual. Unattributed reads are left out, as they can't be compared with a consumer's baseline.
+func DetectAWSAccessAnomalies(cloudtrailEvents aws_cloudtrail.EventsByName, secretId string, periods AnomalyPeriods, resolvers ...ConsumerResolver) ([]AccessAnomaly, error) {
+	events := filterEventsBySecret(cloudtrailEvents[aws_cloudtrail.GetSecretValueEvent], secretId)
+	sort.SliceStable(events, func(i, j int) bool {
+		return events[i].EventTime.Before(events[j].EventTime)
+	})
+
+	baselines := map[string]*consumerBaseline{}
+	var baselineReads int
+	machineOnly := true
+	detectionReads := map[string][]Consumer{}
+	var detectionConsumers []string // In the order of their first read
+	for _, event := range events {
+		if event.EventTime.Before(periods.BaselineStart) || event.EventTime.After(periods.DetectionEnd) {
+			continue
+		}
+		read, err := extractConsumerRead(event, resolvers)
+		if err != nil {
+			continue
+		}
+
+		consumerKey := stableConsumerKey(read)
+		if event.EventTime.Before(periods.DetectionStart) {
+			baselineReads++
+			machineOnly = machineOnly && read.Category != HumanConsumer
+			baseline, exists := baselines[consumerKey]
+			if !exists {
+				baseline = &consumerBaseline{sourceIps: map[string]bool{}, asns: map[uint]bool{}, hoursOfDays: map[int]bool{}}
+				baselines[consumerKey] = baseline
+			}
+			baseline.reads++
+			baseline.sourceIps[event.SourceIpAddress] = true
+			baseline.hoursOfDays[event.EventTime.UTC().Hour()] = true
+			for _, origin := range read.NetworkOrigins {
+				baseline.asns[origin.ASN] = true
+			}
+			continue
+		}
+
+		if _, exists := detectionReads[consumerKey]; !exists {
+			detectionConsumers = append(detectionConsumers, consumerKey)
+		}
+		detectionReads[consumerKey] = append(detectionReads[consumerKey], read)
+	}
+	if baselineReads == 0 {
+		return nil, fmt.Errorf("no reads in the baseline period (%s to %s) to compare with", timeutil.FormatTime(periods.BaselineStart), timeutil.FormatTime(periods.DetectionStart))
+	}
+
+	var anomalies []AccessAnomaly
+	for _, consumerKey := range detectionConsumers {
+		reads := detectionReads[consumerKey]
+		consumer := lo.Reduce(reads[1:], func(consumer Consumer, read Consumer, _ int) Consumer {
+			return mergeConsumerStats(consumer, read)
+		}, reads[0])
+		anomaly := func(kind AnomalyKind, detectedAt time.Time, reason string) {
+			anomalies = append(anomalies, AccessAnomaly{Kind: kind, DetectedAt: detectedAt, Reason: reason, Consumer: consumer})
+		}
+
+		if machineOnly && consumer.Category == HumanConsumer {
+			anomaly(HumanOnMachineAnomaly, consumer.FirstAccessedAt,
+				fmt.Sprintf("a human (%s) read the secret, while only machines read it in the baseline period", consumer.Type))
+		}
+		baseline, exists := baselines[consumerKey]
+		if !exists {
+			anomaly(NewConsumerAnomaly, consumer.FirstAccessedAt,
+				fmt.Sprintf("first read the secret on %s, and never read it in the baseline period (since %s)", timeutil.FormatTime(consumer.FirstAccessedAt), timeutil.FormatTime(periods.BaselineStart)))
+			// The other checks compare a consumer with its own baseline
+			continue
+		}
+
+		newReads := lo.Filter(reads, func(read Consumer, _ int) bool {
+			sourceIp := lo.FirstOrEmpty(read.SourceIpAddresses)
+			return sourceIp != "" && !baseline.sourceIps[sourceIp]
+		})
+		if len(newReads) > 0 {
+			sourceIps := lo.Uniq(lo.Map(newReads, func(read Consumer, _ int) string { return lo.FirstOrEmpty(read.SourceIpAddresses) }))
+			anomaly(NewSourceIpAnomaly, newReads[0].AccessedResourceAt,
+				fmt.Sprintf("read the secret from source IPs not seen in the baseline period: %s", strings.Join(sourceIps, ", ")))
+		}
+
+		newOrigins := lo.FilterMap(reads, func(read Consumer, _ int) (NetworkOrigin, bool) {
+			origin, found := lo.First(read.NetworkOrigins)
+			return origin, found && origin.ASN != 0 && !baseline.asns[origin.ASN]
+		})
+		if len(newOrigins) > 0 {
+			asns := lo.Uniq(lo.Map(newOrigins, func(origin NetworkOrigin, _ int) string { return describeASN(origin) }))
+			firstRead, _ := lo.Find(reads, func(read Consumer) bool {
+				origin, found := lo.First(read.NetworkOrigins)
+				return found && origin.ASN == newOrigins[0].ASN
+			})
+			anomaly(NewASNAnomaly, firstRead.AccessedResourceAt,
+				fmt.Sprintf("read the secret from ASNs not seen in the baseline period: %s", strings.Join(asns, ", ")))
+		}
+
+		if baseline.reads >= minBaselineReadsForHours {
+			// Reads an hour before or after the usual hours are usual too
+			unusualReads := lo.Filter(reads, func(read Consumer, _ int) bool {
+				hour := read.AccessedResourceAt.UTC().Hour()
+				return !baseline.hoursOfDays[hour] && !baseline.hoursOfDays[(hour+1)%24] && !baseline.hoursOfDays[(hour+23)%24]
+			})
+			if len(unusualReads) > 0 {
+				hours := lo.Uniq(lo.Map(unusualReads, func(read Consumer, _ int) int { return read.AccessedResourceAt.UTC().Hour() }))
+				anomaly(UnusualHoursAnomaly, unusualReads[0].AccessedResourceAt,
+					fmt.Sprintf("read the secret at %s UTC, outside of its usual hours in the baseline period (%s UTC)", describeHours(hours), describeHours(lo.Keys(baseline.hoursOfDays))))
+			}
+		}
+
+		baselineRate := float64(baseline.reads) / days(periods.DetectionStart.Sub(periods.BaselineStart))
+		detectionRate := float64(len(reads)) / days(periods.DetectionEnd.Sub(periods.DetectionStart))
+		if len(reads) >= minSpikeReads && detectionRate >= spikeFactor*baselineRate {
+			anomaly(ReadVolumeSpikeAnomaly, consumer.FirstAccessedAt,
+				fmt.Sprintf("read the secret %.1f times a day, %.1fx its %.1f reads a day in the baseline period", detectionRate, detectionRate/baselineRate, baselineRate))
+		}
+	}
+
+	sort.SliceStable(anomalies, func(i, j int) bool {
+		return anomalies[i].DetectedAt.Before(anomalies[j].DetectedAt)
+	})
+	return anomalies, nil
+}
+
+// stableConsumerKey identifies a consumer across its sessions, as machines get a new session name every so often
+// (e.g. ECS task ids, botocore-session-* IRSA sessions and EC2 instance ids), while their role stays the same.
+// Humans are told apart by their session, as people sharing a role (e.g. an SSO permission set) name their sessions after themselves.
+// CountUnattributedReads counts the reads of a secret in the analyzed periods that could not be attributed to a consumer,
+// which are left out of the detection.
+func CountUnattributedReads(cloudtrailEvents aws_cloudtrail.EventsByName, secretId string, periods AnomalyPeriods) int {
+	return lo.CountBy(filterEventsBySecret(cloudtrailEvents[aws_cloudtrail.GetSecretValueEvent], secretId), func(event clients.CloudtrailEvent) bool {
+		if event.EventTime.Before(periods.BaselineStart) || event.EventTime.After(periods.DetectionEnd) {
+			return false
+		}
+		_, err := extractConsumerFromEvent(event)
+		return err != nil
+	})
+}
+
+func stableConsumerKey(consumer Consumer) string {
+	roleKey := principalKey(consumer.ExternalResourceName)
+	if roleKey == consumer.ExternalResourceName {
+		// Not an IAM user or role (e.g. an AWS service), whose principal id is stable
+		return consumer.AccountId + ":" + consumer.ExternalId
+	}
+	if consumer.Category == HumanConsumer && strings.Contains(roleKey, ":role/") {
+		return roleKey + "/" + consumer.ExternalId
+	}
+	return roleKey
+}
+
+// days counts the days in a period, and at least one, so that short periods don't inflate daily rates.
+func days(period time.Duration) float64 {
+	return max(period.Hours()/24, 1)
+}
+
+func describeASN(origin NetworkOrigin) string {
+	asn := strings.TrimSpace(fmt.Sprintf("AS%d %s", origin.ASN, origin.ASOrganization))
+	if origin.Country != "" {
+		asn += fmt.Sprintf(" (%s)", origin.Country)
+	}
+	return asn
+}
+
+// describeHours describes hours of the day as ranges (e.g. "08:00-10:59, 14:00-14:59").
+func describeHours(hours []int) string {
+	sort.Ints(hours)
+	var ranges []string
+	for i := 0; i < len(hours); {
+		j := i
+		for j+1 < len(hours) && hours[j+1] == hours[j]+1 {
+			j++
+		}
+		ranges = append(ranges, fmt.Sprintf("%02d:00-%02d:59", hours[i], hours[j]))
+		i = j + 1
+	}
+	return strings.Join(ranges, ", ")
+}
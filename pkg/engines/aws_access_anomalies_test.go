@@ -0,0 +1,115 @@
+package engines
+
+import (
+	"fmt"
+	"slices"
+	"sort"
+	"testing"
+	"time"
+
+	"github.com/torchsecurity/torch-secret-analyzer/pkg/clients"
+	"github.com/torchsecurity/torch-secret-analyzer/pkg/collectors/aws_cloudtrail"
+)
+
+func TestDetectAWSAccessAnomalies(t *testing.T) {
+	periods := AnomalyPeriods{
+		BaselineStart:  time.Date(2024, 10, 1, 0, 0, 0, 0, time.UTC),
+		DetectionStart: time.Date(2024, 10, 15, 0, 0, 0, 0, time.UTC),
+		DetectionEnd:   time.Date(2024, 10, 22, 0, 0, 0, 0, time.UTC),
+	}
+	// A machine reading the secret once a day at 10:00 from the same IP, in a new session every day
+	var baseline []clients.CloudtrailEvent
+	for day := 1; day <= 14; day++ {
+		eventTime := time.Date(2024, 10, day, 10, 0, 0, 0, time.UTC)
+		baseline = append(baseline, testReadEvent(eventTime, testRoleSession("app", fmt.Sprintf("i-%d", day)), "10.0.0.1"))
+	}
+	detectionTime := time.Date(2024, 10, 16, 10, 30, 0, 0, time.UTC)
+
+	tests := []struct {
+		name      string
+		detection []clients.CloudtrailEvent
+		kinds     []AnomalyKind
+	}{
+		{
+			name:      "new session of a known role",
+			detection: []clients.CloudtrailEvent{testReadEvent(detectionTime, testRoleSession("app", "i-new"), "10.0.0.1")},
+		},
+		{
+			name:      "new role",
+			detection: []clients.CloudtrailEvent{testReadEvent(detectionTime, testRoleSession("batch", "i-1"), "10.0.0.1")},
+			kinds:     []AnomalyKind{NewConsumerAnomaly},
+		},
+		{
+			name:      "human reading a machine secret",
+			detection: []clients.CloudtrailEvent{testReadEvent(detectionTime, testIAMUser("alice"), "10.0.0.1")},
+			kinds:     []AnomalyKind{HumanOnMachineAnomaly, NewConsumerAnomaly},
+		},
+		{
+			name:      "new source IP",
+			detection: []clients.CloudtrailEvent{testReadEvent(detectionTime, testRoleSession("app", "i-new"), "203.0.113.5")},
+			kinds:     []AnomalyKind{NewSourceIpAnomaly},
+		},
+		{
+			name:      "unusual hours",
+			detection: []clients.CloudtrailEvent{testReadEvent(time.Date(2024, 10, 16, 3, 0, 0, 0, time.UTC), testRoleSession("app", "i-new"), "10.0.0.1")},
+			kinds:     []AnomalyKind{UnusualHoursAnomaly},
+		},
+		{
+			name: "read volume spike",
+			detection: func() []clients.CloudtrailEvent {
+				var events []clients.CloudtrailEvent
+				for i := 0; i < 30; i++ {
+					events = append(events, testReadEvent(detectionTime.Add(time.Duration(i)*time.Minute), testRoleSession("app", "i-new"), "10.0.0.1"))
+				}
+				return events
+			}(),
+			kinds: []AnomalyKind{ReadVolumeSpikeAnomaly},
+		},
+		{
+			name: "denied read of a new role",
+			detection: func() []clients.CloudtrailEvent {
+				event := testReadEvent(detectionTime, testRoleSession("batch", "i-1"), "10.0.0.1")
+				event.ErrorCode = "AccessDenied"
+				return []clients.CloudtrailEvent{event}
+			}(),
+			kinds: []AnomalyKind{NewConsumerAnomaly},
+		},
+		{
+			name:      "reads after the detection period",
+			detection: []clients.CloudtrailEvent{testReadEvent(periods.DetectionEnd.Add(time.Hour), testRoleSession("batch", "i-1"), "10.0.0.1")},
+		},
+	}
+
+	for _, test := range tests {
+		t.Run(test.name, func(t *testing.T) {
+			events := aws_cloudtrail.EventsByName{aws_cloudtrail.GetSecretValueEvent: append(slices.Clone(baseline), test.detection...)}
+			anomalies, err := DetectAWSAccessAnomalies(events, "prod/db", periods)
+			if err != nil {
+				t.Fatal(err)
+			}
+
+			var kinds []AnomalyKind
+			for _, anomaly := range anomalies {
+				kinds = append(kinds, anomaly.Kind)
+			}
+			sort.Slice(kinds, func(i, j int) bool { return kinds[i] < kinds[j] })
+			if !slices.Equal(kinds, test.kinds) {
+				t.Errorf("expected anomalies %v, got %+v", test.kinds, anomalies)
+			}
+		})
+	}
+}
+
+func TestDetectAWSAccessAnomaliesWithoutBaseline(t *testing.T) {
+	periods := AnomalyPeriods{
+		BaselineStart:  time.Date(2024, 10, 1, 0, 0, 0, 0, time.UTC),
+		DetectionStart: time.Date(2024, 10, 15, 0, 0, 0, 0, time.UTC),
+		DetectionEnd:   time.Date(2024, 10, 22, 0, 0, 0, 0, time.UTC),
+	}
+	events := aws_cloudtrail.EventsByName{aws_cloudtrail.GetSecretValueEvent: {
+		testReadEvent(time.Date(2024, 10, 16, 10, 0, 0, 0, time.UTC), testRoleSession("app", "i-1"), "10.0.0.1"),
+	}}
+	if _, err := DetectAWSAccessAnomalies(events, "prod/db", periods); err == nil {
+		t.Error("expected an error without reads in the baseline period")
+	}
+}
@@ -1,36 +1,160 @@
 package engines
 
 import (
+	"encoding/json"
 	"fmt"
 	"regexp"
+	"sort"
 	"strings"
 	"time"
 
+	"github.com/aws/aws-sdk-go-v2/aws/arn"
+	"github.com/samber/lo"
 	"github.com/torchsecurity/torch-secret-analyzer/pkg/clients"
 	"github.com/torchsecurity/torch-secret-analyzer/pkg/collectors/aws_cloudtrail"
-	"github.com/torchsecurity/torch-secret-analyzer/pkg/utils/colors"
 )
 
 type ConsumerCategory string
 
 const (
-	HumanConsumer   ConsumerCategory = "Human"
-	MachineConsumer ConsumerCategory = "Machine"
+	HumanConsumer        ConsumerCategory = "Human"
+	MachineConsumer      ConsumerCategory = "Machine"
+	UnattributedConsumer ConsumerCategory = "Unattributed" // The principal of an event whose identity lacks the details to attribute it to a consumer
+)
+
+// ConsumerAccess describes the permission a potential consumer has to access a secret.
+type ConsumerAccess string
+
+const (
+	AllowedAccess      ConsumerAccess = "Allowed"
+	ConditionalAccess  ConsumerAccess = "Conditional"    // Depends on conditions we could not resolve (e.g. aws:SourceIp)
+	BlockedByKMSAccess ConsumerAccess = "Blocked by KMS" // Allowed to read the secret, but not to decrypt it with the secret's KMS key
 )
 
 type Consumer struct {
-	Category             ConsumerCategory
-	Type                 string
-	Name                 string
-	ExternalId           string
-	ExternalResourceName string
-	AccessKeyId          string
-	AccessedResourceAt   time.Time
+	Category             ConsumerCategory `json:"category" yaml:"category"`
+	Type                 string           `json:"type" yaml:"type"`
+	Name                 string           `json:"name" yaml:"name"`
+	ExternalId           string           `json:"externalId" yaml:"externalId"`
+	ExternalResourceName string           `json:"arn" yaml:"arn"`
+	AccessKeyId          string           `json:"accessKeyId,omitempty" yaml:"accessKeyId,omitempty"`
+	AccessedResourceAt   time.Time        `json:"lastAccessedAt" yaml:"lastAccessedAt"`
+	FirstAccessedAt      time.Time        `json:"firstAccessedAt" yaml:"firstAccessedAt,omitempty"`
+	ReadCount            int              `json:"readCount,omitempty" yaml:"readCount,omitempty"`
+	SourceIpAddresses    []string         `json:"sourceIpAddresses,omitempty" yaml:"sourceIpAddresses,omitempty"` // The distinct source IPs of the consumer's reads
+	UserAgents           []string         `json:"userAgents,omitempty" yaml:"userAgents,omitempty"`
+	Clients              []string         `json:"clients,omitempty" yaml:"clients,omitempty"` // The clients identified by the user agents (e.g. AWS CLI 2.15.30)
+	AccessKeyIds         []string         `json:"accessKeyIds,omitempty" yaml:"accessKeyIds,omitempty"`
+	NetworkOrigins       []NetworkOrigin  `json:"networkOrigins,omitempty" yaml:"networkOrigins,omitempty"` // The networks the consumer's reads came from
+	PermissionSets       []string         `json:"permissionSets,omitempty" yaml:"permissionSets,omitempty"` // The IAM Identity Center permission sets of an SSO user's sessions
+	Email                string           `json:"email,omitempty" yaml:"email,omitempty"`
+	DisplayName          string           `json:"displayName,omitempty" yaml:"displayName,omitempty"`
+	Groups               []string         `json:"groups,omitempty" yaml:"groups,omitempty"`
+	IdentityChain        []IdentityLink   `json:"identityChain,omitempty" yaml:"identityChain,omitempty"` // The identities that assumed roles on the way to the consumer's session, originating identity first
+	Region               string           `json:"region,omitempty" yaml:"region,omitempty"`               // The region the consumer read the secret in
+	AccountId            string           `json:"accountId,omitempty" yaml:"accountId,omitempty"`
+	AccountAlias         string           `json:"accountAlias,omitempty" yaml:"accountAlias,omitempty"`
+	Access               ConsumerAccess   `json:"access,omitempty" yaml:"access,omitempty"`
+	AccessReason         string           `json:"accessReason,omitempty" yaml:"accessReason,omitempty"`
+	EventId              string           `json:"eventId,omitempty" yaml:"eventId,omitempty"` // The event of an unattributed consumer
+
+	// Whether a resolver told what the consumer is (e.g. a workload resolver or a custom classification rule),
+	// rather than the default rules, so that the originating identity of a role chain doesn't reclassify it
+	classified bool
 }
 
-func GetAWSActualConsumers(cloudtrailEvents aws_cloudtrail.EventsByName, secretId string) []Consumer {
+// MarshalJSON omits the first access time of consumers that never read the secret (e.g. potential consumers), like the YAML output,
+// as encoding/json doesn't consider a zero time empty.
+func (c Consumer) MarshalJSON() ([]byte, error) {
+	type consumer Consumer
+	var firstAccessedAt *time.Time
+	if !c.FirstAccessedAt.IsZero() {
+		firstAccessedAt = &c.FirstAccessedAt
+	}
+	return json.Marshal(struct {
+		consumer
+		FirstAccessedAt *time.Time `json:"firstAccessedAt,omitempty"`
+	}{consumer: consumer(c), FirstAccessedAt: firstAccessedAt})
+}
+
+// ConsumerResolver names the workload or person behind an actual consumer, using details that are not in the event itself.
+type ConsumerResolver interface {
+	ResolveConsumer(event clients.CloudtrailEvent, consumer *Consumer)
+}
+
+func GetAWSActualConsumers(cloudtrailEvents aws_cloudtrail.EventsByName, secretId string, resolvers ...ConsumerResolver) []Consumer {
 	getSecretValueEvents := filterEventsBySecret(cloudtrailEvents[aws_cloudtrail.GetSecretValueEvent], secretId)
-	return getConsumers(getSecretValueEvents)
+	return getConsumers(getSecretValueEvents, resolvers)
+}
+
+// GetAWSActualConsumersBySecret groups the read events by the secret they refer to, so that the consumers of all secrets are analyzed in one pass.
+// Consumers are keyed by the secret's ARN (a replica's in its own region), or by its name when no event refers to the secret by its ARN.
+func GetAWSActualConsumersBySecret(cloudtrailEvents aws_cloudtrail.EventsByName, resolvers ...ConsumerResolver) map[string][]Consumer {
+	eventsBySecret := map[string][]clients.CloudtrailEvent{}
+	for _, event := range cloudtrailEvents[aws_cloudtrail.GetSecretValueEvent] {
+		if secret := secretOfEvent(event); secret != "" {
+			eventsBySecret[secret] = append(eventsBySecret[secret], event)
+		}
+	}
+
+	// Merge the events that refer to a secret by its name into the events that refer to it by its ARN, preferring the ARN of the
+	// replica in the event's region. The ARNs are sorted, so that a name matching several secrets always merges into the same one.
+	secretArns := lo.Filter(lo.Keys(eventsBySecret), func(secret string, _ int) bool { return strings.HasPrefix(secret, "arn:") })
+	sort.Strings(secretArns)
+	for _, secret := range lo.Keys(eventsBySecret) {
+		if strings.HasPrefix(secret, "arn:") {
+			continue
+		}
+		var unmatchedEvents []clients.CloudtrailEvent
+		for _, event := range eventsBySecret[secret] {
+			secretArn, found := lo.Find(secretArns, func(secretArn string) bool {
+				return isResourceMatchingSecret(secretArn, secret) && regionOfArn(secretArn) == event.Region
+			})
+			if !found {
+				secretArn, found = lo.Find(secretArns, func(secretArn string) bool { return isResourceMatchingSecret(secretArn, secret) })
+			}
+			if !found {
+				unmatchedEvents = append(unmatchedEvents, event)
+				continue
+			}
+			eventsBySecret[secretArn] = append(eventsBySecret[secretArn], event)
+		}
+		if len(unmatchedEvents) == 0 {
+			delete(eventsBySecret, secret)
+		} else {
+			eventsBySecret[secret] = unmatchedEvents
+		}
+	}
+
+	consumersBySecret := map[string][]Consumer{}
+	for secret, events := range eventsBySecret {
+		consumersBySecret[secret] = getConsumers(events, resolvers)
+	}
+	return consumersBySecret
+}
+
+// secretOfEvent returns the ARN (or name) of the secret an event refers to, preferring the resource's ARN when the event has both.
+func secretOfEvent(event clients.CloudtrailEvent) string {
+	var secret string
+	for _, resource := range event.Resources {
+		if resource.ResourceType != "" && resource.ResourceType != "AWS::SecretsManager::Secret" {
+			continue
+		}
+		if strings.HasPrefix(resource.ResourceName, "arn:") {
+			return resource.ResourceName
+		}
+		if secret == "" {
+			secret = resource.ResourceName
+		}
+	}
+	return secret
+}
+
+// SetAccountAliases attributes consumers with the aliases of their accounts, when analyzing several accounts.
+func SetAccountAliases(consumers []Consumer, accountAliases map[string]string) {
+	for i := range consumers {
+		consumers[i].AccountAlias = accountAliases[consumers[i].AccountId]
+	}
 }
 
 func filterEventsBySecret(cloudtrailEvents []clients.CloudtrailEvent, secretId string) []clients.CloudtrailEvent {
@@ -56,6 +180,13 @@ func isResourceMatchingSecret(resourceName, secretId string) bool {
 		return true
 	}
 
+	// The replicas of a secret have its ARN in their own regions, so reads of a replica match the ARN of the primary secret
+	if resourceArn, found := secretArnWithoutRegion(resourceName); found {
+		if secretArn, found := secretArnWithoutRegion(secretId); found {
+			return resourceArn == secretArn
+		}
+	}
+
 	// If resource name is an ARN, extract the secret name part and compare.
 	const arnPrefix = "arn:aws:secretsmanager:"
 	const secretPrefix = "secret:"
@@ -77,30 +208,103 @@ func isResourceMatchingSecret(resourceName, secretId string) bool {
 	return false
 }
 
-func getConsumers(events []clients.CloudtrailEvent) []Consumer {
+// secretArnWithoutRegion strips the region off the ARN of a secret, leaving its partition, account and name.
+func secretArnWithoutRegion(secretArn string) (string, bool) {
+	parsedArn, err := arn.Parse(secretArn)
+	if err != nil || parsedArn.Service != "secretsmanager" {
+		return "", false
+	}
+	parsedArn.Region = ""
+	return parsedArn.String(), true
+}
+
+func getConsumers(events []clients.CloudtrailEvent, resolvers []ConsumerResolver) []Consumer {
+	var consumers []Consumer
 	consumersLastEvents := map[string]Consumer{}
 	for _, event := range events {
-		consumer, err := extractConsumerFromEvent(event)
+		consumer, err := extractConsumerRead(event, resolvers)
 		if err != nil {
-			fmt.Printf(colors.Yellow("Could not extract Consumer from event: %s\n"), event.EventCategory)
+			// Unattributed events can't be told apart, so each of them is listed on its own
+			consumers = append(consumers, consumer)
 			continue
 		}
-		consumerLastEvent, exists := consumersLastEvents[consumer.ExternalId]
-		if !exists || (exists && consumer.AccessedResourceAt.After(consumerLastEvent.AccessedResourceAt)) {
-			consumersLastEvents[consumer.ExternalId] = consumer
+
+		// A consumer that read a secret's replicas in several regions is listed once per region, and the same session name
+		// in several accounts (e.g. a role deployed in every account) is a different consumer in each of them
+		consumerKey := consumer.AccountId + "/" + consumer.ExternalId + "/" + consumer.Region
+		consumerLastEvent, exists := consumersLastEvents[consumerKey]
+		if !exists {
+			consumersLastEvents[consumerKey] = consumer
+			continue
 		}
+		consumersLastEvents[consumerKey] = mergeConsumerStats(consumerLastEvent, consumer)
 	}
 
-	var consumers []Consumer
 	for _, consumer := range consumersLastEvents {
 		consumers = append(consumers, consumer)
 	}
 	return consumers
 }
 
+// extractConsumerRead extracts the consumer of a single read event, along with the stats of that read.
+func extractConsumerRead(event clients.CloudtrailEvent, resolvers []ConsumerResolver) (Consumer, error) {
+	consumer, err := extractResolvedConsumer(event, resolvers)
+	consumer.FirstAccessedAt = consumer.AccessedResourceAt
+	consumer.ReadCount = 1
+	consumer.SourceIpAddresses = appendDistinct(nil, event.SourceIpAddress)
+	consumer.UserAgents = appendDistinct(nil, event.UserAgent)
+	consumer.Clients = appendDistinct(nil, ParseUserAgent(event.UserAgent))
+	consumer.AccessKeyIds = appendDistinct(nil, consumer.AccessKeyId)
+	return consumer, err
+}
+
+// mergeConsumerStats merges the reads of the same consumer, keeping the details of its last read.
+func mergeConsumerStats(consumer Consumer, other Consumer) Consumer {
+	merged := consumer
+	if other.AccessedResourceAt.After(consumer.AccessedResourceAt) {
+		merged = other
+	}
+	merged.FirstAccessedAt = consumer.FirstAccessedAt
+	if other.FirstAccessedAt.Before(consumer.FirstAccessedAt) {
+		merged.FirstAccessedAt = other.FirstAccessedAt
+	}
+	merged.ReadCount = consumer.ReadCount + other.ReadCount
+	merged.SourceIpAddresses = appendDistinct(consumer.SourceIpAddresses, other.SourceIpAddresses...)
+	merged.UserAgents = appendDistinct(consumer.UserAgents, other.UserAgents...)
+	merged.Clients = appendDistinct(consumer.Clients, other.Clients...)
+	merged.AccessKeyIds = appendDistinct(consumer.AccessKeyIds, other.AccessKeyIds...)
+	merged.NetworkOrigins = mergeNetworkOrigins(consumer.NetworkOrigins, other.NetworkOrigins)
+	merged.PermissionSets = appendDistinct(consumer.PermissionSets, other.PermissionSets...)
+	return merged
+}
+
+// appendDistinct appends the non-empty values that are not in the slice yet, into a new slice.
+func appendDistinct(values []string, newValues ...string) []string {
+	distinct := append([]string{}, values...)
+	for _, value := range newValues {
+		if value != "" && !lo.Contains(distinct, value) {
+			distinct = append(distinct, value)
+		}
+	}
+	return lo.Ternary(len(distinct) == 0, nil, distinct)
+}
+
+// extractResolvedConsumer extracts the consumer of an event, and lets the resolvers name the workload or person behind it.
+// An event that can't be attributed to a consumer returns an unattributed consumer along with the error, so that it isn't dropped.
+func extractResolvedConsumer(event clients.CloudtrailEvent, resolvers []ConsumerResolver) (Consumer, error) {
+	consumer, err := extractConsumerFromEvent(event)
+	if err != nil {
+		return unattributedConsumer(event), err
+	}
+	for _, resolver := range resolvers {
+		resolver.ResolveConsumer(event, &consumer)
+	}
+	return consumer, nil
+}
+
 func extractConsumerFromEvent(event clients.CloudtrailEvent) (Consumer, error) {
 	var err error
-	consumer := Consumer{AccessedResourceAt: event.EventTime}
+	consumer := Consumer{AccessedResourceAt: event.EventTime, Region: event.Region, AccountId: event.UserIdentity.AccountId}
 
 	userIdentity := event.UserIdentity
 
@@ -123,6 +327,33 @@ func extractConsumerFromEvent(event clients.CloudtrailEvent) (Consumer, error) {
 	return consumer, err
 }
 
+// unattributedConsumer describes the principal of an event by its raw identity.
+func unattributedConsumer(event clients.CloudtrailEvent) Consumer {
+	userIdentity := event.UserIdentity
+	return Consumer{
+		Category:             UnattributedConsumer,
+		Type:                 userIdentity.Type,
+		Name:                 lo.CoalesceOrEmpty(userIdentity.PrincipalId, userIdentity.Arn, "unknown"),
+		ExternalId:           userIdentity.PrincipalId,
+		ExternalResourceName: userIdentity.Arn,
+		AccessKeyId:          userIdentity.AccessKeyId,
+		AccessedResourceAt:   event.EventTime,
+		Region:               event.Region,
+		AccountId:            userIdentity.AccountId,
+		EventId:              event.ExternalId,
+	}
+}
+
+// CountUnattributedConsumers counts the events that could not be attributed to a consumer.
+func CountUnattributedConsumers(consumers []Consumer) int {
+	return lo.CountBy(consumers, func(consumer Consumer) bool {
+		return consumer.Category == UnattributedConsumer
+	})
+}
+
+// arn:aws:sts::<account>:assumed-role/AWSReservedSSO_<permission set>_<hash>/<user>
+var ssoSessionPattern = regexp.MustCompile(`:assumed-role/AWSReservedSSO_(.+)_[0-9a-f]+/(.+)$`)
+
 func identifyAssumedRoleAccessPrivileges(userIdentity clients.AWSUserIdentity, consumer *Consumer) error {
 	if userIdentity.SessionContext == nil {
 		return fmt.Errorf("missing session context for assumed role")
@@ -136,51 +367,21 @@ func identifyAssumedRoleAccessPrivileges(userIdentity clients.AWSUserIdentity, c
 	consumer.Name = assumingPrincipalId
 	consumer.ExternalResourceName = userIdentity.Arn
 
-	return nil
-}
-
-func classifyAssumingConsumer(userIdentity clients.AWSUserIdentity) (category ConsumerCategory, identityType string) {
-	roleArn := ""
-	federatedProvider := ""
-
-	if userIdentity.SessionContext != nil {
-		if userIdentity.SessionContext.SessionIssuer != nil {
-			roleArn = userIdentity.SessionContext.SessionIssuer.Arn
-		}
-		if userIdentity.SessionContext.WebIdFederationData != nil {
-			federatedProvider = userIdentity.SessionContext.WebIdFederationData.FederatedProvider
+	// SSO users read through the role of a permission set, in a session named after the user
+	if matches := ssoSessionPattern.FindStringSubmatch(userIdentity.Arn); matches != nil {
+		consumer.PermissionSets = []string{matches[1]}
+		if strings.Contains(matches[2], "@") {
+			consumer.Email = matches[2]
 		}
 	}
 
-	entityId := extractAssumingPrincipalId(userIdentity.PrincipalId)
+	return nil
+}
 
-	if federatedProvider != "" {
-		if strings.Contains(federatedProvider, "oidc.eks.") {
-			return MachineConsumer, "AWS EKS Service Account"
-		}
-	}
-	if strings.HasPrefix(entityId, "i-") {
-		return MachineConsumer, "AWS EC2 Instance"
-	}
-	if userIdentity.Type == "AWSService" || strings.Contains(roleArn, "/aws-service-role") {
-		return MachineConsumer, "AWS Service"
-	}
-	if userIdentity.Type == "WebIdentityUser" || (strings.Contains(userIdentity.Arn, "sts.amazonaws.com:assumed-role") && strings.Contains(userIdentity.Arn, "WebIdentity")) {
-		return HumanConsumer, "Web Identity User"
-	}
-	if userIdentity.Type == "SAMLUser" || strings.Contains(userIdentity.Arn, "AWSReservedSSO") {
-		return HumanConsumer, "AWS SAML User"
-	}
-	if userIdentity.Type == "IAMUser" || strings.Contains(userIdentity.Arn, ":user/") {
-		return HumanConsumer, "AWS IAM User"
-	}
-	if userIdentity.Type == "IAMRole" || strings.Contains(userIdentity.Arn, ":role/") {
-		return MachineConsumer, "AWS IAM Role"
-	}
-	if userIdentity.Type == "FederatedUser" {
-		return HumanConsumer, "AWS Federated User"
-	}
-	return MachineConsumer, "Application"
+func classifyAssumingConsumer(userIdentity clients.AWSUserIdentity) (category ConsumerCategory, identityType string) {
+	// The default rules end with a rule that matches any identity
+	rule := DefaultClassificationRules.classify(userIdentity, "")
+	return rule.Category, rule.Type
 }
 
 func extractAssumingPrincipalId(principalId string) string {
@@ -0,0 +1,211 @@
+package engines
+
+import (
+	"encoding/json"
+	"fmt"
+	"reflect"
+	"sort"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/torchsecurity/torch-secret-analyzer/pkg/clients"
+	"github.com/torchsecurity/torch-secret-analyzer/pkg/collectors/aws_cloudtrail"
+	"gopkg.in/yaml.v3"
+)
+
+func TestConsumerOmitsZeroFirstAccessedAt(t *testing.T) {
+	tests := []struct {
+		name     string
+		consumer Consumer
+		present  bool
+	}{
+		{name: "potential consumer", consumer: Consumer{Name: "app"}, present: false},
+		{name: "actual consumer", consumer: Consumer{Name: "app", FirstAccessedAt: time.Date(2024, 10, 1, 10, 0, 0, 0, time.UTC)}, present: true},
+	}
+
+	for _, test := range tests {
+		t.Run(test.name, func(t *testing.T) {
+			jsonOutput, err := json.Marshal(test.consumer)
+			if err != nil {
+				t.Fatal(err)
+			}
+			yamlOutput, err := yaml.Marshal(test.consumer)
+			if err != nil {
+				t.Fatal(err)
+			}
+			for format, output := range map[string]string{"json": string(jsonOutput), "yaml": string(yamlOutput)} {
+				if present := strings.Contains(output, "firstAccessedAt"); present != test.present {
+					t.Errorf("expected firstAccessedAt in the %s output: %v, got %s", format, test.present, output)
+				}
+			}
+		})
+	}
+}
+
+func TestIsResourceMatchingSecret(t *testing.T) {
+	const secretArn = "arn:aws:secretsmanager:us-east-1:111111111111:secret:prod/db-AbCdEf"
+	tests := []struct {
+		name         string
+		resourceName string
+		secretId     string
+		matches      bool
+	}{
+		{name: "same name", resourceName: "prod/db", secretId: "prod/db", matches: true},
+		{name: "ARN of the secret name", resourceName: secretArn, secretId: "prod/db", matches: true},
+		{name: "ARN of another secret with the same prefix", resourceName: "arn:aws:secretsmanager:us-east-1:111111111111:secret:prod/db-replica-AbCdEf", secretId: "prod/db"},
+		{name: "same ARN", resourceName: secretArn, secretId: secretArn, matches: true},
+		{name: "ARN of a replica", resourceName: "arn:aws:secretsmanager:eu-west-1:111111111111:secret:prod/db-AbCdEf", secretId: secretArn, matches: true},
+		{name: "ARN of a secret with the same name in another account", resourceName: "arn:aws:secretsmanager:us-east-1:222222222222:secret:prod/db-AbCdEf", secretId: secretArn},
+		{name: "ARN of another secret", resourceName: "arn:aws:secretsmanager:us-east-1:111111111111:secret:prod/api-AbCdEf", secretId: secretArn},
+	}
+
+	for _, test := range tests {
+		t.Run(test.name, func(t *testing.T) {
+			if matches := isResourceMatchingSecret(test.resourceName, test.secretId); matches != test.matches {
+				t.Errorf("isResourceMatchingSecret(%q, %q) = %v, expected %v", test.resourceName, test.secretId, matches, test.matches)
+			}
+		})
+	}
+}
+
+func TestGetAWSActualConsumersBySecret(t *testing.T) {
+	eventTime := time.Date(2024, 10, 1, 10, 0, 0, 0, time.UTC)
+	read := func(sessionName string, resourceNames ...string) clients.CloudtrailEvent {
+		event := testReadEvent(eventTime, testRoleSession("app", sessionName), "10.0.0.1")
+		event.Resources = nil
+		for _, resourceName := range resourceNames {
+			event.Resources = append(event.Resources, clients.CloudTrailEventResource{ResourceType: "AWS::SecretsManager::Secret", ResourceName: resourceName})
+		}
+		return event
+	}
+
+	tests := []struct {
+		name      string
+		reads     []clients.CloudtrailEvent
+		consumers map[string][]string // The names of the consumers of each secret
+	}{
+		{
+			name:      "reads by ARN",
+			reads:     []clients.CloudtrailEvent{read("i-1", testSecretArn), read("i-2", testOtherSecretArn), read("i-1", testSecretArn)},
+			consumers: map[string][]string{testSecretArn: {"i-1"}, testOtherSecretArn: {"i-2"}},
+		},
+		{
+			name:      "reads by name are merged into the reads by ARN",
+			reads:     []clients.CloudtrailEvent{read("i-1", testSecretArn), read("i-2", "prod/db")},
+			consumers: map[string][]string{testSecretArn: {"i-1", "i-2"}},
+		},
+		{
+			name:      "reads by name only",
+			reads:     []clients.CloudtrailEvent{read("i-1", "prod/db"), read("i-2", "prod/db")},
+			consumers: map[string][]string{"prod/db": {"i-1", "i-2"}},
+		},
+		{
+			name:      "reads with both the name and the ARN",
+			reads:     []clients.CloudtrailEvent{read("i-1", "prod/db", testSecretArn)},
+			consumers: map[string][]string{testSecretArn: {"i-1"}},
+		},
+		{
+			name:      "reads without a secret",
+			reads:     []clients.CloudtrailEvent{read("i-1")},
+			consumers: map[string][]string{},
+		},
+	}
+
+	for _, test := range tests {
+		t.Run(test.name, func(t *testing.T) {
+			consumersBySecret := GetAWSActualConsumersBySecret(aws_cloudtrail.EventsByName{aws_cloudtrail.GetSecretValueEvent: test.reads})
+			consumerNames := map[string][]string{}
+			for secret, consumers := range consumersBySecret {
+				for _, consumer := range consumers {
+					consumerNames[secret] = append(consumerNames[secret], consumer.Name)
+				}
+				sort.Strings(consumerNames[secret])
+			}
+			if !reflect.DeepEqual(consumerNames, test.consumers) {
+				t.Errorf("expected the consumers %v, got %v", test.consumers, consumerNames)
+			}
+		})
+	}
+}
+
+func TestGetAWSActualConsumersBySecretMergesNamesIntoReplicas(t *testing.T) {
+	const replicaArn = "arn:aws:secretsmanager:eu-west-1:111111111111:secret:prod/db-AbCdEf"
+	read := func(secret string, region string, sessionName string) clients.CloudtrailEvent {
+		event := testReadEvent(time.Date(2024, 10, 1, 10, 0, 0, 0, time.UTC), testRoleSession("app", sessionName), "10.0.0.1")
+		event.Region = region
+		event.Resources = []clients.CloudTrailEventResource{{ResourceType: "AWS::SecretsManager::Secret", ResourceName: secret}}
+		return event
+	}
+	events := aws_cloudtrail.EventsByName{aws_cloudtrail.GetSecretValueEvent: {
+		read(testSecretArn, "us-east-1", "i-1"),
+		read(replicaArn, "eu-west-1", "i-2"),
+		read("prod/db", "us-east-1", "i-3"),
+		read("prod/db", "eu-west-1", "i-4"),
+		read("prod/other", "us-east-1", "i-5"),
+	}}
+
+	// Map iteration is random, so the grouping is checked a few times, and reads of the name go to the replica in their region
+	for i := 0; i < 10; i++ {
+		consumersBySecret := GetAWSActualConsumersBySecret(events)
+		consumerNames := map[string][]string{}
+		for secret, consumers := range consumersBySecret {
+			for _, consumer := range consumers {
+				consumerNames[secret] = append(consumerNames[secret], consumer.Name)
+			}
+			sort.Strings(consumerNames[secret])
+		}
+		expected := map[string][]string{
+			testSecretArn: {"i-1", "i-3"},
+			replicaArn:    {"i-2", "i-4"},
+			"prod/other":  {"i-5"},
+		}
+		if !reflect.DeepEqual(consumerNames, expected) {
+			t.Fatalf("expected the consumers %v, got %v", expected, consumerNames)
+		}
+	}
+}
+
+func testReadEvent(eventTime time.Time, userIdentity clients.AWSUserIdentity, sourceIp string) clients.CloudtrailEvent {
+	return clients.CloudtrailEvent{
+		ExternalId:        fmt.Sprintf("%s-%d", userIdentity.PrincipalId, eventTime.Unix()),
+		EventName:         aws_cloudtrail.GetSecretValueEvent,
+		EventSource:       "secretsmanager.amazonaws.com",
+		EventTime:         eventTime,
+		Region:            "us-east-1",
+		Resources:         []clients.CloudTrailEventResource{{ResourceType: "AWS::SecretsManager::Secret", ResourceName: testSecretArn}},
+		UserIdentity:      userIdentity,
+		SourceIpAddress:   sourceIp,
+		UserAgent:         "aws-sdk-go-v2/1.30.0",
+		RequestParameters: `{"secretId":"` + testSecretArn + `"}`,
+	}
+}
+
+func testRoleSession(roleName string, sessionName string) clients.AWSUserIdentity {
+	roleId := "AROA" + roleName
+	return clients.AWSUserIdentity{
+		Type:        "AssumedRole",
+		PrincipalId: roleId + ":" + sessionName,
+		Arn:         fmt.Sprintf("arn:aws:sts::111111111111:assumed-role/%s/%s", roleName, sessionName),
+		AccountId:   "111111111111",
+		SessionContext: &clients.AWSUserIdentitySessionContext{
+			SessionIssuer: &clients.AWSUserIdentitySessionContextSessionIssuer{
+				Type:        "Role",
+				PrincipalId: roleId,
+				Arn:         "arn:aws:iam::111111111111:role/" + roleName,
+				AccountId:   "111111111111",
+				UserName:    roleName,
+			},
+		},
+	}
+}
+
+func testIAMUser(userName string) clients.AWSUserIdentity {
+	return clients.AWSUserIdentity{
+		Type:        "IAMUser",
+		PrincipalId: "AIDA" + userName,
+		Arn:         "arn:aws:iam::111111111111:user/" + userName,
+		AccountId:   "111111111111",
+		UserName:    userName,
+	}
+}
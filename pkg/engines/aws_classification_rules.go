@@ -0,0 +1,167 @@
+package engines
+
+import (
+	"fmt"
+	"regexp"
+	"strings"
+
+	"github.com/samber/lo"
+	"github.com/torchsecurity/torch-secret-analyzer/pkg/clients"
+	"gopkg.in/yaml.v3"
+)
+
+// ClassificationMatch matches the userIdentity of an event. Empty fields match anything, and the others must all match.
+// Fields other than the type and arnRegex are patterns that support the '*' and '?' wildcards.
+type ClassificationMatch struct {
+	Type              string `yaml:"type"`              // The userIdentity's type (e.g. AssumedRole)
+	Arn               string `yaml:"arn"`               // The userIdentity's ARN
+	ArnRegex          string `yaml:"arnRegex"`          // A regular expression of the userIdentity's ARN
+	SessionName       string `yaml:"sessionName"`       // The session name (or principal id, for identities without sessions)
+	SessionIssuer     string `yaml:"sessionIssuer"`     // The ARN of the role that issued the session
+	FederatedProvider string `yaml:"federatedProvider"` // The identity provider of web identity sessions
+	UserAgent         string `yaml:"userAgent"`
+
+	arnRegex *regexp.Regexp
+}
+
+// ClassificationRule assigns a category, a type and optionally a display name to the consumers it matches.
+// The display name supports the {session}, {user}, {role} and {arn} placeholders.
+type ClassificationRule struct {
+	Name        string              `yaml:"name"`
+	Match       ClassificationMatch `yaml:"match"`
+	Category    ConsumerCategory    `yaml:"category"`
+	Type        string              `yaml:"type"`
+	DisplayName string              `yaml:"displayName"`
+
+	custom bool // Rules of a rules file take precedence over what the originating identity of a role chain tells
+}
+
+// ClassificationRules are evaluated in order, the first matching rule classifies the consumer.
+type ClassificationRules []ClassificationRule
+
+type classificationRulesFile struct {
+	Rules ClassificationRules `yaml:"rules"`
+}
+
+// DefaultClassificationRules classify consumers by the conventions of AWS identities. They end with a rule that matches any consumer.
+var DefaultClassificationRules = ClassificationRules{
+	{Name: "eks-service-account", Match: ClassificationMatch{FederatedProvider: "*oidc.eks.*"}, Category: MachineConsumer, Type: "AWS EKS Service Account"},
+	{Name: "ec2-instance", Match: ClassificationMatch{SessionName: "i-*"}, Category: MachineConsumer, Type: "AWS EC2 Instance"},
+	{Name: "aws-service", Match: ClassificationMatch{Type: "AWSService"}, Category: MachineConsumer, Type: "AWS Service"},
+	{Name: "aws-service-role", Match: ClassificationMatch{SessionIssuer: "*/aws-service-role*"}, Category: MachineConsumer, Type: "AWS Service"},
+	{Name: "web-identity-user", Match: ClassificationMatch{Type: "WebIdentityUser"}, Category: HumanConsumer, Type: "Web Identity User"},
+	{Name: "web-identity-session", Match: ClassificationMatch{Arn: "*sts.amazonaws.com:assumed-role*WebIdentity*"}, Category: HumanConsumer, Type: "Web Identity User"},
+	{Name: "web-identity-session-reversed", Match: ClassificationMatch{Arn: "*WebIdentity*sts.amazonaws.com:assumed-role*"}, Category: HumanConsumer, Type: "Web Identity User"},
+	{Name: "saml-user", Match: ClassificationMatch{Type: "SAMLUser"}, Category: HumanConsumer, Type: "AWS SAML User"},
+	{Name: "sso-session", Match: ClassificationMatch{Arn: "*AWSReservedSSO*"}, Category: HumanConsumer, Type: "AWS SAML User"},
+	{Name: "iam-user", Match: ClassificationMatch{Type: "IAMUser"}, Category: HumanConsumer, Type: "AWS IAM User"},
+	{Name: "iam-user-arn", Match: ClassificationMatch{Arn: "*:user/*"}, Category: HumanConsumer, Type: "AWS IAM User"},
+	{Name: "iam-role", Match: ClassificationMatch{Type: "IAMRole"}, Category: MachineConsumer, Type: "AWS IAM Role"},
+	{Name: "iam-role-arn", Match: ClassificationMatch{Arn: "*:role/*"}, Category: MachineConsumer, Type: "AWS IAM Role"},
+	{Name: "federated-user", Match: ClassificationMatch{Type: "FederatedUser"}, Category: HumanConsumer, Type: "AWS Federated User"},
+	{Name: "application", Category: MachineConsumer, Type: "Application"},
+}
+
+// ParseClassificationRules parses a YAML rules file ({"rules": [...]}). The default rules are evaluated after the file's rules,
+// so that consumers the file doesn't match are classified as usual.
+func ParseClassificationRules(data []byte) (ClassificationRules, error) {
+	var rulesFile classificationRulesFile
+	if err := yaml.Unmarshal(data, &rulesFile); err != nil {
+		return nil, fmt.Errorf("could not parse classification rules: %v", err)
+	}
+
+	for i := range rulesFile.Rules {
+		rule := &rulesFile.Rules[i]
+		if rule.Category != HumanConsumer && rule.Category != MachineConsumer {
+			return nil, fmt.Errorf("rule %d (%s) has an unsupported category '%s', expected %s or %s", i+1, rule.Name, rule.Category, HumanConsumer, MachineConsumer)
+		}
+		rule.custom = true
+		if rule.Type == "" {
+			return nil, fmt.Errorf("rule %d (%s) is missing a type", i+1, rule.Name)
+		}
+		if rule.Match.ArnRegex != "" {
+			arnRegex, err := regexp.Compile(rule.Match.ArnRegex)
+			if err != nil {
+				return nil, fmt.Errorf("rule %d (%s) has an invalid arnRegex: %v", i+1, rule.Name, err)
+			}
+			rule.Match.arnRegex = arnRegex
+		}
+	}
+	return append(rulesFile.Rules, DefaultClassificationRules...), nil
+}
+
+// classify returns the first rule that matches the identity, or nil if none does.
+func (rules ClassificationRules) classify(userIdentity clients.AWSUserIdentity, userAgent string) *ClassificationRule {
+	for i := range rules {
+		if rules[i].Match.matches(userIdentity, userAgent) {
+			return &rules[i]
+		}
+	}
+	return nil
+}
+
+func (m ClassificationMatch) matches(userIdentity clients.AWSUserIdentity, userAgent string) bool {
+	if m.Type != "" && m.Type != userIdentity.Type {
+		return false
+	}
+	if m.arnRegex != nil && !m.arnRegex.MatchString(userIdentity.Arn) {
+		return false
+	}
+
+	var sessionIssuer, federatedProvider string
+	if userIdentity.SessionContext != nil {
+		if userIdentity.SessionContext.SessionIssuer != nil {
+			sessionIssuer = userIdentity.SessionContext.SessionIssuer.Arn
+		}
+		if userIdentity.SessionContext.WebIdFederationData != nil {
+			federatedProvider = userIdentity.SessionContext.WebIdFederationData.FederatedProvider
+		}
+	}
+	patterns := [][2]string{
+		{m.Arn, userIdentity.Arn},
+		{m.SessionName, extractAssumingPrincipalId(userIdentity.PrincipalId)},
+		{m.SessionIssuer, sessionIssuer},
+		{m.FederatedProvider, federatedProvider},
+		{m.UserAgent, userAgent},
+	}
+	for _, pattern := range patterns {
+		if pattern[0] != "" && !matchesPattern(pattern[0], pattern[1], false) {
+			return false
+		}
+	}
+	return true
+}
+
+// RulesClassifier classifies consumers by custom classification rules, instead of the default ones.
+type RulesClassifier struct {
+	rules ClassificationRules
+}
+
+func NewRulesClassifier(rules ClassificationRules) *RulesClassifier {
+	return &RulesClassifier{rules: rules}
+}
+
+func (c *RulesClassifier) ResolveConsumer(event clients.CloudtrailEvent, consumer *Consumer) {
+	rule := c.rules.classify(event.UserIdentity, event.UserAgent)
+	if rule == nil {
+		return
+	}
+
+	consumer.Category = rule.Category
+	consumer.Type = rule.Type
+	consumer.classified = rule.custom
+	if rule.DisplayName != "" {
+		userIdentity := event.UserIdentity
+		var role string
+		if userIdentity.SessionContext != nil && userIdentity.SessionContext.SessionIssuer != nil {
+			sessionIssuer := userIdentity.SessionContext.SessionIssuer
+			role = lo.CoalesceOrEmpty(sessionIssuer.UserName, sessionIssuer.Arn[strings.LastIndex(sessionIssuer.Arn, "/")+1:])
+		}
+		consumer.Name = strings.NewReplacer(
+			"{session}", extractAssumingPrincipalId(userIdentity.PrincipalId),
+			"{user}", userIdentity.UserName,
+			"{role}", role,
+			"{arn}", userIdentity.Arn,
+		).Replace(rule.DisplayName)
+	}
+}
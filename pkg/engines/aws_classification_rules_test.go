@@ -0,0 +1,181 @@
+package engines
+
+import (
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/torchsecurity/torch-secret-analyzer/pkg/clients"
+)
+
+func TestParseClassificationRules(t *testing.T) {
+	tests := []struct {
+		name  string
+		rules string
+		err   string
+	}{
+		{
+			name: "valid rules",
+			rules: `
+rules:
+  - name: ci
+    match: {sessionIssuer: "*:role/github-actions", userAgent: "*terraform*"}
+    category: Machine
+    type: CI Pipeline
+  - name: oncall
+    match: {arnRegex: "assumed-role/oncall-[a-z]+/"}
+    category: Human
+    type: On-call Engineer
+`,
+		},
+		{
+			name:  "no rules",
+			rules: `rules: []`,
+		},
+		{
+			name:  "invalid YAML",
+			rules: `rules: [`,
+			err:   "could not parse classification rules",
+		},
+		{
+			name:  "unsupported category",
+			rules: `rules: [{name: ci, category: Robot, type: CI Pipeline}]`,
+			err:   "rule 1 (ci) has an unsupported category 'Robot'",
+		},
+		{
+			name:  "missing type",
+			rules: `rules: [{name: ci, category: Machine}]`,
+			err:   "rule 1 (ci) is missing a type",
+		},
+		{
+			name:  "invalid ARN regex",
+			rules: `rules: [{name: ci, category: Machine, type: CI Pipeline}, {name: oncall, match: {arnRegex: "oncall-("}, category: Human, type: On-call Engineer}]`,
+			err:   "rule 2 (oncall) has an invalid arnRegex",
+		},
+	}
+
+	for _, test := range tests {
+		t.Run(test.name, func(t *testing.T) {
+			rules, err := ParseClassificationRules([]byte(test.rules))
+			if test.err != "" {
+				if err == nil || !strings.Contains(err.Error(), test.err) {
+					t.Errorf("expected the error '%s', got %v", test.err, err)
+				}
+				return
+			}
+			if err != nil {
+				t.Fatal(err)
+			}
+			// The default rules are evaluated after the file's rules
+			if len(rules) < len(DefaultClassificationRules) || rules[len(rules)-1].Name != "application" {
+				t.Errorf("expected the rules to end with the default rules, got %v", rules)
+			}
+		})
+	}
+}
+
+func TestRulesClassifier(t *testing.T) {
+	rules, err := ParseClassificationRules([]byte(`
+rules:
+  - name: terraform
+    match: {sessionIssuer: "*:role/github-actions", userAgent: "*Terraform*"}
+    category: Machine
+    type: CI Pipeline
+    displayName: "terraform ({role})"
+  - name: ci
+    match: {sessionIssuer: "*:role/github-actions"}
+    category: Machine
+    type: CI Pipeline
+    displayName: "ci:{session}"
+  - name: oncall
+    match: {type: AssumedRole, arnRegex: "assumed-role/oncall-[a-z]+/"}
+    category: Human
+    type: On-call Engineer
+  - name: break-glass
+    match: {type: IAMUser, arn: "*:user/break-glass-?"}
+    category: Human
+    type: Break-glass User
+    displayName: "{user} ({arn})"
+`))
+	if err != nil {
+		t.Fatal(err)
+	}
+	classifier := NewRulesClassifier(rules)
+
+	tests := []struct {
+		name         string
+		userIdentity clients.AWSUserIdentity
+		userAgent    string
+		category     ConsumerCategory
+		consumerType string
+		consumerName string
+		classified   bool
+	}{
+		{
+			name:         "first matching rule",
+			userIdentity: testRoleSession("github-actions", "run-42"),
+			userAgent:    "APN/1.0 HashiCorp/1.0 Terraform/1.9.0",
+			category:     MachineConsumer,
+			consumerType: "CI Pipeline",
+			consumerName: "terraform (github-actions)",
+			classified:   true,
+		},
+		{
+			name:         "next matching rule",
+			userIdentity: testRoleSession("github-actions", "run-42"),
+			userAgent:    "aws-cli/2.17.0",
+			category:     MachineConsumer,
+			consumerType: "CI Pipeline",
+			consumerName: "ci:run-42",
+			classified:   true,
+		},
+		{
+			name:         "rule without a display name",
+			userIdentity: testRoleSession("oncall-alice", "alice"),
+			category:     HumanConsumer,
+			consumerType: "On-call Engineer",
+			consumerName: "alice",
+			classified:   true,
+		},
+		{
+			name:         "wildcard ARN",
+			userIdentity: testIAMUser("break-glass-1"),
+			category:     HumanConsumer,
+			consumerType: "Break-glass User",
+			consumerName: "break-glass-1 (arn:aws:iam::111111111111:user/break-glass-1)",
+			classified:   true,
+		},
+		{
+			name:         "default rules",
+			userIdentity: testIAMUser("break-glass-10"),
+			category:     HumanConsumer,
+			consumerType: "AWS IAM User",
+			consumerName: "break-glass-10",
+		},
+		{
+			name:         "default rules of role sessions",
+			userIdentity: testRoleSession("oncall-team1", "i-1"),
+			category:     MachineConsumer,
+			consumerType: "AWS EC2 Instance",
+			consumerName: "i-1",
+		},
+	}
+
+	for _, test := range tests {
+		t.Run(test.name, func(t *testing.T) {
+			event := testReadEvent(time.Date(2024, 10, 1, 10, 0, 0, 0, time.UTC), test.userIdentity, "10.0.0.1")
+			event.UserAgent = test.userAgent
+			consumer, err := extractResolvedConsumer(event, []ConsumerResolver{classifier})
+			if err != nil {
+				t.Fatal(err)
+			}
+			if consumer.Category != test.category || consumer.Type != test.consumerType || consumer.Name != test.consumerName {
+				t.Errorf("expected the %s consumer %s '%s', got the %s consumer %s '%s'",
+					test.category, test.consumerType, test.consumerName, consumer.Category, consumer.Type, consumer.Name)
+			}
+			if consumer.classified != test.classified {
+				t.Errorf("expected the consumer to be classified by a custom rule: %v", test.classified)
+			}
+		})
+	}
+}
@@ -0,0 +1,90 @@
+package engines
+
+import (
+	"strings"
+
+	"github.com/aws/aws-sdk-go-v2/aws/arn"
+)
+
+type ConsumersDiff struct {
+	Unused       []Consumer // Potential consumers that did not read the secret in the timeframe
+	Expected     []Consumer // Actual consumers that are allowed to read the secret
+	Unexplained  []Consumer // Actual consumers that according to the policies are not allowed to read the secret
+	Unattributed []Consumer // Reads that could not be attributed to a consumer, so they can't be matched with the policies
+}
+
+// DiffAWSConsumers joins the actual consumers of a secret with its potential consumers.
+// An actual consumer is matched with the IAM user or role behind it, or with an account (or any principal) the secret's resource policy allows.
+func DiffAWSConsumers(actualConsumers []Consumer, potentialConsumers []Consumer) ConsumersDiff {
+	potentialByPrincipal := map[string]int{}
+	potentialByAccount := map[string]int{}
+	anyPrincipalIndex := -1
+	for i, potentialConsumer := range potentialConsumers {
+		switch potentialConsumer.Type {
+		case "AWS Account":
+			potentialByAccount[potentialConsumer.ExternalId] = i
+		case "Any AWS Principal":
+			anyPrincipalIndex = i
+		default:
+			potentialByPrincipal[principalKey(potentialConsumer.ExternalResourceName)] = i
+		}
+	}
+
+	var diff ConsumersDiff
+	usedPotentialConsumers := map[int]bool{}
+	for _, actualConsumer := range actualConsumers {
+		if actualConsumer.Category == UnattributedConsumer {
+			diff.Unattributed = append(diff.Unattributed, actualConsumer)
+			continue
+		}
+		index, matched := potentialByPrincipal[principalKey(actualConsumer.ExternalResourceName)]
+		if !matched {
+			index, matched = potentialByAccount[accountIdOfArn(actualConsumer.ExternalResourceName)]
+		}
+		if !matched && anyPrincipalIndex != -1 {
+			index, matched = anyPrincipalIndex, true
+		}
+
+		if !matched {
+			diff.Unexplained = append(diff.Unexplained, actualConsumer)
+			continue
+		}
+
+		usedPotentialConsumers[index] = true
+		potentialConsumer := potentialConsumers[index]
+		actualConsumer.Access = potentialConsumer.Access
+		actualConsumer.AccessReason = potentialConsumer.AccessReason
+		if potentialConsumer.Access == BlockedByKMSAccess {
+			diff.Unexplained = append(diff.Unexplained, actualConsumer)
+		} else {
+			diff.Expected = append(diff.Expected, actualConsumer)
+		}
+	}
+
+	for i, potentialConsumer := range potentialConsumers {
+		if !usedPotentialConsumers[i] {
+			diff.Unused = append(diff.Unused, potentialConsumer)
+		}
+	}
+	return diff
+}
+
+// principalKey identifies the IAM user or role behind an ARN, so that a role session (arn:aws:sts::<account>:assumed-role/<role>/<session>)
+// matches the role it was issued for (arn:aws:iam::<account>:role/<path>/<role>).
+func principalKey(principalArn string) string {
+	parsedArn, err := arn.Parse(principalArn)
+	if err != nil {
+		return principalArn
+	}
+
+	resourceParts := strings.Split(parsedArn.Resource, "/")
+	switch resourceParts[0] {
+	case "assumed-role":
+		if len(resourceParts) > 1 {
+			return parsedArn.AccountID + ":role/" + resourceParts[1]
+		}
+	case "role", "user":
+		return parsedArn.AccountID + ":" + resourceParts[0] + "/" + resourceParts[len(resourceParts)-1]
+	}
+	return principalArn
+}
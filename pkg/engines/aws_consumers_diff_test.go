@@ -0,0 +1,107 @@
+package engines
+
+import (
+	"slices"
+	"testing"
+)
+
+func TestDiffAWSConsumers(t *testing.T) {
+	appRole := Consumer{Type: "AWS IAM Role", Name: "app", ExternalId: "AROAAPP", ExternalResourceName: "arn:aws:iam::111111111111:role/service/app", Access: AllowedAccess}
+	aliceUser := Consumer{Type: "AWS IAM User", Name: "alice", ExternalId: "AIDAALICE", ExternalResourceName: "arn:aws:iam::111111111111:user/alice", Access: AllowedAccess}
+	blockedRole := Consumer{Type: "AWS IAM Role", Name: "blocked", ExternalId: "AROABLOCKED", ExternalResourceName: "arn:aws:iam::111111111111:role/blocked", Access: BlockedByKMSAccess}
+	otherAccount := Consumer{Type: "AWS Account", Name: "222222222222", ExternalId: "222222222222", Access: ConditionalAccess}
+	anyPrincipal := Consumer{Type: "Any AWS Principal", Name: "Any AWS principal", ExternalId: "*", Access: ConditionalAccess}
+
+	appSession := Consumer{Name: "i-1", ExternalId: "AROAAPP:i-1", ExternalResourceName: "arn:aws:sts::111111111111:assumed-role/app/i-1"}
+	aliceRead := Consumer{Name: "alice", ExternalId: "AIDAALICE", ExternalResourceName: "arn:aws:iam::111111111111:user/alice"}
+	blockedSession := Consumer{Name: "s", ExternalId: "AROABLOCKED:s", ExternalResourceName: "arn:aws:sts::111111111111:assumed-role/blocked/s"}
+	otherAccountSession := Consumer{Name: "job", ExternalId: "AROAJOB:job", ExternalResourceName: "arn:aws:sts::222222222222:assumed-role/job/job"}
+	thirdAccountSession := Consumer{Name: "x", ExternalId: "AROAX:x", ExternalResourceName: "arn:aws:sts::333333333333:assumed-role/x/x"}
+	unattributedRead := Consumer{Category: UnattributedConsumer, Name: "Unattributed", EventId: "event-1"}
+
+	tests := []struct {
+		name         string
+		actual       []Consumer
+		potential    []Consumer
+		unused       []string
+		expected     []string
+		unexplained  []string
+		unattributed []string
+	}{
+		{
+			name:      "role session matches the role it was issued for",
+			actual:    []Consumer{appSession},
+			potential: []Consumer{appRole, aliceUser},
+			unused:    []string{"alice"},
+			expected:  []string{"i-1"},
+		},
+		{
+			name:        "read without a policy allowing it",
+			actual:      []Consumer{aliceRead, appSession},
+			potential:   []Consumer{aliceUser},
+			expected:    []string{"alice"},
+			unexplained: []string{"i-1"},
+		},
+		{
+			name:        "read of a consumer blocked by the KMS key",
+			actual:      []Consumer{blockedSession},
+			potential:   []Consumer{blockedRole},
+			unexplained: []string{"s"},
+		},
+		{
+			name:        "read of a principal of an allowed account",
+			actual:      []Consumer{otherAccountSession, thirdAccountSession},
+			potential:   []Consumer{otherAccount},
+			expected:    []string{"job"},
+			unexplained: []string{"x"},
+		},
+		{
+			name:      "read of any principal",
+			actual:    []Consumer{thirdAccountSession},
+			potential: []Consumer{appRole, anyPrincipal},
+			unused:    []string{"app"},
+			expected:  []string{"x"},
+		},
+		{
+			name:         "unattributed read",
+			actual:       []Consumer{unattributedRead},
+			potential:    []Consumer{anyPrincipal},
+			unused:       []string{"Any AWS principal"},
+			unattributed: []string{"Unattributed"},
+		},
+	}
+
+	for _, test := range tests {
+		t.Run(test.name, func(t *testing.T) {
+			diff := DiffAWSConsumers(test.actual, test.potential)
+			for _, group := range []struct {
+				name      string
+				consumers []Consumer
+				expected  []string
+			}{
+				{"unused", diff.Unused, test.unused},
+				{"expected", diff.Expected, test.expected},
+				{"unexplained", diff.Unexplained, test.unexplained},
+				{"unattributed", diff.Unattributed, test.unattributed},
+			} {
+				var names []string
+				for _, consumer := range group.consumers {
+					names = append(names, consumer.Name)
+				}
+				if !slices.Equal(names, group.expected) {
+					t.Errorf("expected %s consumers %v, got %v", group.name, group.expected, names)
+				}
+			}
+		})
+	}
+}
+
+func TestDiffAWSConsumersKeepsPotentialAccess(t *testing.T) {
+	conditionalRole := Consumer{Type: "AWS IAM Role", Name: "app", ExternalResourceName: "arn:aws:iam::111111111111:role/app", Access: ConditionalAccess, AccessReason: "depends on aws:SourceIp"}
+	session := Consumer{Name: "i-1", ExternalResourceName: "arn:aws:sts::111111111111:assumed-role/app/i-1"}
+
+	diff := DiffAWSConsumers([]Consumer{session}, []Consumer{conditionalRole})
+	if len(diff.Expected) != 1 || diff.Expected[0].Access != ConditionalAccess || diff.Expected[0].AccessReason != conditionalRole.AccessReason {
+		t.Errorf("expected the read to keep the conditional access of its role, got %+v", diff.Expected)
+	}
+}
@@ -0,0 +1,147 @@
+package engines
+
+import (
+	"fmt"
+	"os"
+	"strings"
+
+	"github.com/samber/lo"
+	"github.com/torchsecurity/torch-secret-analyzer/pkg/clients"
+	"github.com/torchsecurity/torch-secret-analyzer/pkg/utils/colors"
+)
+
+const serviceAccountSubjectPrefix = "system:serviceaccount:"
+
+type eksServiceAccount struct {
+	cluster        string
+	namespace      string
+	serviceAccount string
+	oidcProvider   string // The IAM OIDC provider of IRSA service accounts, empty for pod identity associations
+}
+
+func (s eksServiceAccount) name() string {
+	return fmt.Sprintf("eks:%s/%s/%s", s.cluster, s.namespace, s.serviceAccount)
+}
+
+// EKSResolver names the EKS service accounts behind role sessions, either issued with IRSA (IAM roles for service accounts)
+// or with EKS Pod Identity.
+type EKSResolver struct {
+	serviceAccountsByRole map[string][]eksServiceAccount // by principalKey of the role
+}
+
+// NewEKSResolver maps roles to the service accounts that can assume them: IRSA roles by the "sub" condition of their trust policy,
+// and pod identity roles by the associations of the clusters.
+func NewEKSResolver(clusters []clients.EKSCluster, authorizationDetails *clients.IAMAuthorizationDetails) *EKSResolver {
+	resolver := &EKSResolver{serviceAccountsByRole: map[string][]eksServiceAccount{}}
+
+	clustersByIssuer := map[string]string{}
+	for _, cluster := range clusters {
+		clustersByIssuer[strings.TrimPrefix(cluster.OidcIssuer, "https://")] = cluster.Name
+		for _, association := range cluster.PodIdentityAssociations {
+			roleKey := principalKey(association.RoleArn)
+			resolver.serviceAccountsByRole[roleKey] = append(resolver.serviceAccountsByRole[roleKey], eksServiceAccount{
+				cluster:        cluster.Name,
+				namespace:      association.Namespace,
+				serviceAccount: association.ServiceAccount,
+			})
+		}
+	}
+
+	if authorizationDetails == nil {
+		return resolver
+	}
+	for _, role := range authorizationDetails.Roles {
+		trustPolicy, err := parsePolicyDocument(role.AssumeRolePolicyDocument)
+		if err != nil {
+			fmt.Fprintf(os.Stderr, colors.Yellow("Could not parse trust policy of role %s: %v\n"), role.RoleName, err)
+			continue
+		}
+		roleKey := principalKey(role.Arn)
+		resolver.serviceAccountsByRole[roleKey] = append(resolver.serviceAccountsByRole[roleKey], irsaServiceAccounts(trustPolicy, clustersByIssuer)...)
+	}
+	return resolver
+}
+
+// irsaServiceAccounts returns the service accounts an IRSA trust policy allows, by its "<issuer>:sub" conditions.
+// Clusters that were not collected (e.g. of other regions) are named by the id of their OIDC issuer.
+func irsaServiceAccounts(trustPolicy *PolicyDocument, clustersByIssuer map[string]string) []eksServiceAccount {
+	var serviceAccounts []eksServiceAccount
+	for _, statement := range trustPolicy.Statement {
+		if statement.Principal == nil || !strings.EqualFold(statement.Effect, "Allow") {
+			continue
+		}
+		for _, federatedProvider := range statement.Principal.Federated {
+			_, issuer, found := strings.Cut(federatedProvider, ":oidc-provider/")
+			if !found || !strings.Contains(issuer, "oidc.eks.") {
+				continue
+			}
+			cluster, known := clustersByIssuer[issuer]
+			if !known {
+				cluster = issuer[strings.LastIndex(issuer, "/")+1:]
+			}
+
+			for _, conditions := range statement.Condition {
+				for key, values := range conditions {
+					if !strings.EqualFold(key, issuer+":sub") {
+						continue
+					}
+					for _, subject := range values {
+						namespace, serviceAccount, found := strings.Cut(strings.TrimPrefix(subject, serviceAccountSubjectPrefix), ":")
+						if !strings.HasPrefix(subject, serviceAccountSubjectPrefix) || !found {
+							continue
+						}
+						serviceAccounts = append(serviceAccounts, eksServiceAccount{
+							cluster:        cluster,
+							namespace:      namespace,
+							serviceAccount: serviceAccount,
+							oidcProvider:   federatedProvider,
+						})
+					}
+				}
+			}
+		}
+	}
+	return serviceAccounts
+}
+
+func (r *EKSResolver) ResolveConsumer(event clients.CloudtrailEvent, consumer *Consumer) {
+	sessionContext := event.UserIdentity.SessionContext
+	if sessionContext == nil || sessionContext.SessionIssuer == nil {
+		return
+	}
+	serviceAccounts := r.serviceAccountsByRole[principalKey(sessionContext.SessionIssuer.Arn)]
+	if len(serviceAccounts) == 0 {
+		return
+	}
+
+	sessionName := extractAssumingPrincipalId(event.UserIdentity.PrincipalId)
+	if sessionContext.WebIdFederationData != nil && strings.Contains(sessionContext.WebIdFederationData.FederatedProvider, "oidc.eks.") {
+		federatedProvider := sessionContext.WebIdFederationData.FederatedProvider
+		serviceAccounts = lo.Filter(serviceAccounts, func(serviceAccount eksServiceAccount, _ int) bool {
+			return serviceAccount.oidcProvider == federatedProvider
+		})
+	} else if strings.HasPrefix(sessionName, "eks-") {
+		// Pod identity sessions are named eks-<cluster>-<pod>-<id>
+		serviceAccounts = lo.Filter(serviceAccounts, func(serviceAccount eksServiceAccount, _ int) bool {
+			return serviceAccount.oidcProvider == ""
+		})
+		inCluster := lo.Filter(serviceAccounts, func(serviceAccount eksServiceAccount, _ int) bool {
+			return strings.HasPrefix(sessionName, "eks-"+serviceAccount.cluster+"-")
+		})
+		serviceAccounts = lo.Ternary(len(inCluster) > 0, inCluster, serviceAccounts)
+	} else {
+		return
+	}
+	if len(serviceAccounts) == 0 {
+		return
+	}
+
+	// A role shared by several service accounts can't be narrowed down to one of them, so we name all of them
+	names := lo.Uniq(lo.Map(serviceAccounts, func(serviceAccount eksServiceAccount, _ int) string {
+		return serviceAccount.name()
+	}))
+	consumer.Category = MachineConsumer
+	consumer.Type = "AWS EKS Service Account"
+	consumer.Name = strings.Join(names, ", ")
+	consumer.classified = true
+}
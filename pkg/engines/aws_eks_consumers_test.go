@@ -0,0 +1,128 @@
+package engines
+
+import (
+	"testing"
+	"time"
+
+	"github.com/torchsecurity/torch-secret-analyzer/pkg/clients"
+)
+
+func TestEKSResolver(t *testing.T) {
+	const (
+		issuer        = "oidc.eks.us-east-1.amazonaws.com/id/EXAMPLED539D4633E53DE1B71EXAMPLE"
+		otherIssuer   = "oidc.eks.eu-west-1.amazonaws.com/id/OTHERD539D4633E53DE1B71EXAMPLE"
+		oidcProvider  = "arn:aws:iam::111111111111:oidc-provider/" + issuer
+		otherProvider = "arn:aws:iam::111111111111:oidc-provider/" + otherIssuer
+	)
+	irsaStatement := func(provider string, issuer string, operator string, subjects string) string {
+		return `{"Effect": "Allow", "Principal": {"Federated": "` + provider + `"}, "Action": "sts:AssumeRoleWithWebIdentity",
+			"Condition": {"` + operator + `": {"` + issuer + `:sub": ` + subjects + `, "` + issuer + `:aud": "sts.amazonaws.com"}}}`
+	}
+	clusters := []clients.EKSCluster{
+		{
+			Name:       "prod",
+			OidcIssuer: "https://" + issuer,
+			PodIdentityAssociations: []clients.EKSPodIdentityAssociation{
+				{Namespace: "billing", ServiceAccount: "invoicer", RoleArn: "arn:aws:iam::111111111111:role/pod-identity"},
+			},
+		},
+		{
+			Name: "staging",
+			PodIdentityAssociations: []clients.EKSPodIdentityAssociation{
+				{Namespace: "billing", ServiceAccount: "invoicer", RoleArn: "arn:aws:iam::111111111111:role/pod-identity"},
+			},
+		},
+	}
+	authorizationDetails := &clients.IAMAuthorizationDetails{Roles: []clients.IAMRole{
+		{Arn: "arn:aws:iam::111111111111:role/irsa", RoleName: "irsa", AssumeRolePolicyDocument: testPolicy(
+			irsaStatement(oidcProvider, issuer, "StringEquals", `"system:serviceaccount:payments:api"`),
+			irsaStatement(otherProvider, otherIssuer, "StringLike", `["system:serviceaccount:payments:worker", "system:serviceaccount:*"]`),
+		)},
+		{Arn: "arn:aws:iam::111111111111:role/shared", RoleName: "shared", AssumeRolePolicyDocument: testPolicy(
+			irsaStatement(oidcProvider, issuer, "StringEquals", `["system:serviceaccount:payments:api", "system:serviceaccount:payments:cron"]`),
+		)},
+		{Arn: "arn:aws:iam::111111111111:role/denied", RoleName: "denied", AssumeRolePolicyDocument: testPolicy(
+			`{"Effect": "Deny", "Principal": {"Federated": "` + oidcProvider + `"}, "Action": "sts:AssumeRoleWithWebIdentity",
+				"Condition": {"StringEquals": {"` + issuer + `:sub": "system:serviceaccount:payments:api"}}}`,
+		)},
+		{Arn: "arn:aws:iam::111111111111:role/invalid", RoleName: "invalid", AssumeRolePolicyDocument: "{"},
+	}}
+	resolver := NewEKSResolver(clusters, authorizationDetails)
+
+	webIdentitySession := func(roleName string, provider string) clients.AWSUserIdentity {
+		userIdentity := testRoleSession(roleName, "botocore-session-1")
+		userIdentity.SessionContext.WebIdFederationData = &clients.AWSUserIdentitySessionContextWebIdFederationData{FederatedProvider: provider}
+		return userIdentity
+	}
+
+	tests := []struct {
+		name         string
+		userIdentity clients.AWSUserIdentity
+		consumerType string
+		consumerName string
+	}{
+		{
+			name:         "IRSA service account of a collected cluster",
+			userIdentity: webIdentitySession("irsa", oidcProvider),
+			consumerType: "AWS EKS Service Account",
+			consumerName: "eks:prod/payments/api",
+		},
+		{
+			name:         "IRSA service account of a cluster that was not collected",
+			userIdentity: webIdentitySession("irsa", otherProvider),
+			consumerType: "AWS EKS Service Account",
+			consumerName: "eks:OTHERD539D4633E53DE1B71EXAMPLE/payments/worker",
+		},
+		{
+			name:         "role shared by several service accounts",
+			userIdentity: webIdentitySession("shared", oidcProvider),
+			consumerType: "AWS EKS Service Account",
+			consumerName: "eks:prod/payments/api, eks:prod/payments/cron",
+		},
+		{
+			name:         "pod identity session of a cluster",
+			userIdentity: testRoleSession("pod-identity", "eks-staging-invoicer-7d9f-abcd"),
+			consumerType: "AWS EKS Service Account",
+			consumerName: "eks:staging/billing/invoicer",
+		},
+		{
+			name:         "pod identity session of an unknown cluster",
+			userIdentity: testRoleSession("pod-identity", "eks-dev-invoicer-7d9f-abcd"),
+			consumerType: "AWS EKS Service Account",
+			consumerName: "eks:prod/billing/invoicer, eks:staging/billing/invoicer",
+		},
+		{
+			name:         "session of an IRSA role that was not issued by EKS",
+			userIdentity: testRoleSession("irsa", "i-1"),
+			consumerType: "AWS EC2 Instance",
+			consumerName: "i-1",
+		},
+		{
+			name:         "denied service account",
+			userIdentity: webIdentitySession("denied", oidcProvider),
+			consumerType: "AWS EKS Service Account",
+			consumerName: "botocore-session-1",
+		},
+		{
+			name:         "role with an invalid trust policy",
+			userIdentity: webIdentitySession("invalid", oidcProvider),
+			consumerType: "AWS EKS Service Account",
+			consumerName: "botocore-session-1",
+		},
+		{
+			name:         "IAM user",
+			userIdentity: testIAMUser("alice"),
+			consumerType: "AWS IAM User",
+			consumerName: "alice",
+		},
+	}
+
+	for _, test := range tests {
+		t.Run(test.name, func(t *testing.T) {
+			consumer, _ := extractResolvedConsumer(testReadEvent(time.Date(2024, 10, 1, 10, 0, 0, 0, time.UTC), test.userIdentity, "10.0.0.1"), []ConsumerResolver{resolver})
+			if consumer.Type != test.consumerType || consumer.Name != test.consumerName {
+				t.Errorf("expected the consumer %s '%s', got %s '%s'", test.consumerType, test.consumerName, consumer.Type, consumer.Name)
+			}
+		})
+	}
+}
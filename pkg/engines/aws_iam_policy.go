@@ -0,0 +1,609 @@
+package engines
+
+import (
+	"bytes"
+	"encoding/json"
+	"fmt"
+	"regexp"
+	"sort"
+	"strings"
+
+	"github.com/aws/aws-sdk-go-v2/aws/arn"
+	"github.com/samber/lo"
+)
+
+type PolicyDocument struct {
+	Version   string           `json:"Version"`
+	Statement PolicyStatements `json:"Statement"`
+}
+
+type PolicyStatement struct {
+	Sid          string                             `json:"Sid"`
+	Effect       string                             `json:"Effect"`
+	Principal    *PolicyPrincipal                   `json:"Principal"`
+	NotPrincipal *PolicyPrincipal                   `json:"NotPrincipal"`
+	Action       PolicyValues                       `json:"Action"`
+	NotAction    PolicyValues                       `json:"NotAction"`
+	Resource     PolicyValues                       `json:"Resource"`
+	NotResource  PolicyValues                       `json:"NotResource"`
+	Condition    map[string]map[string]PolicyValues `json:"Condition"`
+}
+
+// A policy's Statement element can either be a single statement or a list of statements.
+type PolicyStatements []PolicyStatement
+
+func (s *PolicyStatements) UnmarshalJSON(data []byte) error {
+	if bytes.HasPrefix(bytes.TrimSpace(data), []byte("[")) {
+		var statements []PolicyStatement
+		if err := json.Unmarshal(data, &statements); err != nil {
+			return err
+		}
+		*s = statements
+		return nil
+	}
+
+	var statement PolicyStatement
+	if err := json.Unmarshal(data, &statement); err != nil {
+		return err
+	}
+	*s = PolicyStatements{statement}
+	return nil
+}
+
+// Policy elements (Action, Resource, condition values...) can either be a single value or a list of values.
+// Condition values are not necessarily strings (e.g. "aws:MultiFactorAuthPresent": true), so we normalize them into strings.
+type PolicyValues []string
+
+func (v *PolicyValues) UnmarshalJSON(data []byte) error {
+	var raw interface{}
+	if err := json.Unmarshal(data, &raw); err != nil {
+		return err
+	}
+
+	switch value := raw.(type) {
+	case nil:
+		*v = nil
+	case []interface{}:
+		values := make(PolicyValues, 0, len(value))
+		for _, item := range value {
+			values = append(values, fmt.Sprint(item))
+		}
+		*v = values
+	default:
+		*v = PolicyValues{fmt.Sprint(value)}
+	}
+	return nil
+}
+
+// A statement's Principal element can either be "*" or a map of principal types ("AWS", "Service", "Federated") to values.
+type PolicyPrincipal struct {
+	All       bool
+	AWS       PolicyValues
+	Service   PolicyValues
+	Federated PolicyValues
+}
+
+func (p *PolicyPrincipal) UnmarshalJSON(data []byte) error {
+	var wildcard string
+	if err := json.Unmarshal(data, &wildcard); err == nil {
+		p.All = wildcard == "*"
+		return nil
+	}
+
+	var principals map[string]PolicyValues
+	if err := json.Unmarshal(data, &principals); err != nil {
+		return err
+	}
+	p.AWS = principals["AWS"]
+	p.Service = principals["Service"]
+	p.Federated = principals["Federated"]
+	p.All = lo.Contains(p.AWS, "*")
+	return nil
+}
+
+func parsePolicyDocument(document string) (*PolicyDocument, error) {
+	var policyDocument PolicyDocument
+	if err := json.Unmarshal([]byte(document), &policyDocument); err != nil {
+		return nil, fmt.Errorf("could not parse policy document: %v", err)
+	}
+	return &policyDocument, nil
+}
+
+type conditionResult int
+
+const (
+	conditionUnknown conditionResult = iota
+	conditionTrue
+	conditionFalse
+)
+
+// authorizationRequest describes the request we evaluate policies against.
+// Condition keys we know the value of are kept in values, and keys starting with one of the knownPrefixes are known to be absent
+// when they are not in values (e.g. we know all the tags of a resource, so a missing aws:ResourceTag/<key> is really missing).
+// Any other key is unknown to us, and a condition on it can't be resolved.
+type authorizationRequest struct {
+	action        string
+	resource      string
+	values        map[string][]string
+	knownPrefixes []string
+}
+
+func newAuthorizationRequest(action string, resource string) *authorizationRequest {
+	return &authorizationRequest{
+		action:   action,
+		resource: resource,
+		values:   map[string][]string{},
+	}
+}
+
+func (r *authorizationRequest) withValue(key string, values ...string) *authorizationRequest {
+	r.values[strings.ToLower(key)] = values
+	return r
+}
+
+func (r *authorizationRequest) withKnownPrefix(prefix string) *authorizationRequest {
+	r.knownPrefixes = append(r.knownPrefixes, strings.ToLower(prefix))
+	return r
+}
+
+func (r *authorizationRequest) withTags(prefix string, tags map[string]string) *authorizationRequest {
+	r.withKnownPrefix(prefix)
+	for key, value := range tags {
+		r.withValue(prefix+key, value)
+	}
+	return r
+}
+
+func (r *authorizationRequest) lookup(key string) (values []string, known bool) {
+	key = strings.ToLower(key)
+	if values, exists := r.values[key]; exists {
+		return values, true
+	}
+	for _, prefix := range r.knownPrefixes {
+		if strings.HasPrefix(key, prefix) {
+			return nil, true
+		}
+	}
+	return nil, false
+}
+
+// policyEvaluation accumulates the statements that apply to a request across a set of policies.
+// Statements that apply only under conditions we can't resolve are tracked separately, along with the condition keys they depend on.
+type policyEvaluation struct {
+	allow            bool
+	conditionalAllow bool
+	deny             bool
+	conditionalDeny  bool
+	// The keys of conditions we could not resolve, of the allow and deny statements that apply conditionally
+	unresolvedAllowKeys []string
+	unresolvedDenyKeys  []string
+}
+
+func evaluatePolicies(documents []*PolicyDocument, request *authorizationRequest) policyEvaluation {
+	var evaluation policyEvaluation
+	for _, document := range documents {
+		for _, statement := range document.Statement {
+			evaluation.add(statement, request)
+		}
+	}
+	return evaluation
+}
+
+func (e *policyEvaluation) add(statement PolicyStatement, request *authorizationRequest) {
+	result, unresolvedKeys := statement.appliesTo(request)
+	if result == conditionFalse {
+		return
+	}
+
+	isDeny := strings.EqualFold(statement.Effect, "Deny")
+	switch {
+	case result == conditionTrue && isDeny:
+		e.deny = true
+	case result == conditionTrue:
+		e.allow = true
+	case isDeny:
+		e.conditionalDeny = true
+		e.unresolvedDenyKeys = lo.Uniq(append(e.unresolvedDenyKeys, unresolvedKeys...))
+	default:
+		e.conditionalAllow = true
+		e.unresolvedAllowKeys = lo.Uniq(append(e.unresolvedAllowKeys, unresolvedKeys...))
+	}
+}
+
+// unresolvedKeys returns the keys of the conditions the decision depends on.
+// Once a statement allows the request unconditionally, the conditions of other allow statements don't matter anymore.
+func (e policyEvaluation) unresolvedKeys() []string {
+	if e.allow {
+		return e.unresolvedDenyKeys
+	}
+	return lo.Uniq(append(append([]string{}, e.unresolvedDenyKeys...), e.unresolvedAllowKeys...))
+}
+
+func (e policyEvaluation) relevantAllowKeys() []string {
+	if e.allow {
+		return nil
+	}
+	return e.unresolvedAllowKeys
+}
+
+// intersect combines evaluations of policies that must all allow the request (e.g. identity-based policies and a permissions boundary).
+func (e policyEvaluation) intersect(other policyEvaluation) policyEvaluation {
+	allow := e.allow && other.allow
+	return policyEvaluation{
+		allow:               allow,
+		conditionalAllow:    !allow && (e.allow || e.conditionalAllow) && (other.allow || other.conditionalAllow),
+		deny:                e.deny || other.deny,
+		conditionalDeny:     e.conditionalDeny || other.conditionalDeny,
+		unresolvedAllowKeys: lo.Uniq(append(append([]string{}, e.relevantAllowKeys()...), other.relevantAllowKeys()...)),
+		unresolvedDenyKeys:  lo.Uniq(append(append([]string{}, e.unresolvedDenyKeys...), other.unresolvedDenyKeys...)),
+	}
+}
+
+// union combines evaluations of policies where either one may allow the request (e.g. identity-based and resource-based policies in the same account).
+func (e policyEvaluation) union(other policyEvaluation) policyEvaluation {
+	return policyEvaluation{
+		allow:               e.allow || other.allow,
+		conditionalAllow:    e.conditionalAllow || other.conditionalAllow,
+		deny:                e.deny || other.deny,
+		conditionalDeny:     e.conditionalDeny || other.conditionalDeny,
+		unresolvedAllowKeys: lo.Uniq(append(append([]string{}, e.unresolvedAllowKeys...), other.unresolvedAllowKeys...)),
+		unresolvedDenyKeys:  lo.Uniq(append(append([]string{}, e.unresolvedDenyKeys...), other.unresolvedDenyKeys...)),
+	}
+}
+
+type accessDecision int
+
+const (
+	accessDenied accessDecision = iota
+	accessConditional
+	accessAllowed
+)
+
+func (e policyEvaluation) decision() accessDecision {
+	if e.deny {
+		return accessDenied
+	}
+	if e.allow && !e.conditionalDeny {
+		return accessAllowed
+	}
+	if e.allow || e.conditionalAllow {
+		return accessConditional
+	}
+	return accessDenied
+}
+
+// requestPrincipal identifies the principal making a request, in order to match it against the Principal element of resource-based policies.
+type requestPrincipal struct {
+	arn       string
+	id        string
+	accountId string
+}
+
+type principalMatch int
+
+const (
+	principalNotMatched principalMatch = iota
+	principalMatchedByAccount
+	principalMatched
+)
+
+// evaluateResourcePolicy evaluates the statements of a resource-based policy that refer to the principal.
+// A statement that allows the principal's whole account delegates the decision to the account's identity-based policies.
+// For a principal of the resource's own account such a statement grants nothing by itself, so it's skipped.
+func evaluateResourcePolicy(document *PolicyDocument, principal requestPrincipal, sameAccount bool, request *authorizationRequest) policyEvaluation {
+	var evaluation policyEvaluation
+	if document == nil {
+		return evaluation
+	}
+
+	for _, statement := range document.Statement {
+		match := statement.matchesPrincipal(principal)
+		if match == principalNotMatched {
+			continue
+		}
+		if match == principalMatchedByAccount && sameAccount && !strings.EqualFold(statement.Effect, "Deny") {
+			continue
+		}
+		evaluation.add(statement, request)
+	}
+	return evaluation
+}
+
+func (s PolicyStatement) matchesPrincipal(principal requestPrincipal) principalMatch {
+	if s.NotPrincipal != nil {
+		if s.NotPrincipal.refersTo(principal) != principalNotMatched {
+			return principalNotMatched
+		}
+		return principalMatched
+	}
+	if s.Principal == nil {
+		return principalNotMatched
+	}
+	return s.Principal.refersTo(principal)
+}
+
+func (p *PolicyPrincipal) refersTo(principal requestPrincipal) principalMatch {
+	if p.All {
+		return principalMatched
+	}
+
+	match := principalNotMatched
+	for _, value := range p.AWS {
+		if value == principal.arn || (principal.id != "" && value == principal.id) {
+			return principalMatched
+		}
+		if principal.accountId != "" && accountIdOfPrincipal(value) == principal.accountId {
+			match = principalMatchedByAccount
+		}
+	}
+	return match
+}
+
+// accountIdOfPrincipal returns the account id if the principal refers to a whole account (either "123456789012" or "arn:aws:iam::123456789012:root").
+func accountIdOfPrincipal(principal string) string {
+	if principalArn, err := arn.Parse(principal); err == nil {
+		if principalArn.Resource == "root" {
+			return principalArn.AccountID
+		}
+		return ""
+	}
+	if accountIdRegex.MatchString(principal) {
+		return principal
+	}
+	return ""
+}
+
+var accountIdRegex = regexp.MustCompile(`^\d{12}$`)
+
+func (s PolicyStatement) appliesTo(request *authorizationRequest) (result conditionResult, unresolvedKeys []string) {
+	if !s.matchesAction(request.action) {
+		return conditionFalse, nil
+	}
+
+	resourceResult, resourceUnresolvedKeys := s.matchesResource(request)
+	if resourceResult == conditionFalse {
+		return conditionFalse, nil
+	}
+
+	conditionsResult, conditionsUnresolvedKeys := evaluateConditions(s.Condition, request)
+	if conditionsResult == conditionFalse {
+		return conditionFalse, nil
+	}
+
+	unresolvedKeys = append(resourceUnresolvedKeys, conditionsUnresolvedKeys...)
+	if len(unresolvedKeys) > 0 {
+		return conditionUnknown, unresolvedKeys
+	}
+	return conditionTrue, nil
+}
+
+// Actions are case-insensitive, and might contain wildcards (e.g. "secretsmanager:Get*").
+func (s PolicyStatement) matchesAction(action string) bool {
+	if len(s.Action) > 0 {
+		return matchesAnyPattern(s.Action, action, true)
+	}
+	if len(s.NotAction) > 0 {
+		return !matchesAnyPattern(s.NotAction, action, true)
+	}
+	return false
+}
+
+func (s PolicyStatement) matchesResource(request *authorizationRequest) (conditionResult, []string) {
+	patterns := s.Resource
+	negate := false
+	if len(patterns) == 0 && len(s.NotResource) > 0 {
+		patterns = s.NotResource
+		negate = true
+	}
+	if len(patterns) == 0 {
+		// Resource-based policies may omit the resource, in which case the statement applies to the resource the policy is attached to.
+		return conditionTrue, nil
+	}
+
+	var unresolvedKeys []string
+	matched := false
+	for _, pattern := range patterns {
+		resolvedPattern, unresolvedKey := resolvePolicyVariables(pattern, request)
+		if unresolvedKey != "" {
+			unresolvedKeys = append(unresolvedKeys, unresolvedKey)
+			continue
+		}
+		if matchesPattern(resolvedPattern, request.resource, false) {
+			matched = true
+			break
+		}
+	}
+
+	switch {
+	case matched:
+		return toConditionResult(!negate), nil
+	case len(unresolvedKeys) > 0:
+		return conditionUnknown, unresolvedKeys
+	default:
+		return toConditionResult(negate), nil
+	}
+}
+
+var policyVariableRegex = regexp.MustCompile(`\$\{([^}]+)\}`)
+
+// Policy variables (e.g. "arn:aws:secretsmanager:*:*:secret:${aws:username}/*") are replaced with the request's values, in resources and condition values.
+// If a variable can't be resolved, the key it refers to is returned.
+func resolvePolicyVariables(pattern string, request *authorizationRequest) (resolvedPattern string, unresolvedKey string) {
+	resolvedPattern = policyVariableRegex.ReplaceAllStringFunc(pattern, func(variable string) string {
+		key := policyVariableRegex.FindStringSubmatch(variable)[1]
+		switch key {
+		case "*", "?", "$":
+			return key
+		}
+		values, known := request.lookup(key)
+		if !known || len(values) != 1 {
+			unresolvedKey = key
+			return variable
+		}
+		return values[0]
+	})
+	return resolvedPattern, unresolvedKey
+}
+
+// Each condition operator, and each key within it, must be satisfied for the statement to apply (a logical AND).
+func evaluateConditions(conditions map[string]map[string]PolicyValues, request *authorizationRequest) (conditionResult, []string) {
+	var unresolvedKeys []string
+	for operator, keysToValues := range conditions {
+		for key, expectedValues := range keysToValues {
+			// Like resources, condition values may refer to policy variables (e.g. "${aws:PrincipalTag/team}")
+			resolvedValues := make(PolicyValues, 0, len(expectedValues))
+			unresolvedKey := ""
+			for _, expectedValue := range expectedValues {
+				resolvedValue, unresolvedValueKey := resolvePolicyVariables(expectedValue, request)
+				unresolvedKey = lo.CoalesceOrEmpty(unresolvedKey, unresolvedValueKey)
+				resolvedValues = append(resolvedValues, resolvedValue)
+			}
+			if unresolvedKey != "" {
+				unresolvedKeys = append(unresolvedKeys, unresolvedKey)
+				continue
+			}
+
+			switch evaluateCondition(operator, key, resolvedValues, request) {
+			case conditionFalse:
+				return conditionFalse, nil
+			case conditionUnknown:
+				unresolvedKeys = append(unresolvedKeys, key)
+			}
+		}
+	}
+	if len(unresolvedKeys) > 0 {
+		sort.Strings(unresolvedKeys)
+		return conditionUnknown, unresolvedKeys
+	}
+	return conditionTrue, nil
+}
+
+func evaluateCondition(operator string, key string, expectedValues PolicyValues, request *authorizationRequest) conditionResult {
+	setOperator := ""
+	for _, prefix := range []string{"ForAnyValue:", "ForAllValues:"} {
+		if strings.HasPrefix(operator, prefix) {
+			setOperator = prefix
+			operator = strings.TrimPrefix(operator, prefix)
+		}
+	}
+	ifExists := strings.HasSuffix(operator, "IfExists")
+	operator = strings.TrimSuffix(operator, "IfExists")
+
+	values, known := request.lookup(key)
+	if !known {
+		return conditionUnknown
+	}
+
+	if operator == "Null" {
+		expectAbsent := len(expectedValues) > 0 && strings.EqualFold(expectedValues[0], "true")
+		return toConditionResult((len(values) == 0) == expectAbsent)
+	}
+
+	matches, negated, supported := conditionOperatorMatcher(operator)
+	if !supported {
+		return conditionUnknown
+	}
+
+	if len(values) == 0 {
+		// A missing key satisfies "...IfExists" operators, ForAllValues and negated operators, but nothing else.
+		return toConditionResult(ifExists || setOperator == "ForAllValues:" || negated)
+	}
+
+	matchesExpected := func(value string) bool {
+		for _, expectedValue := range expectedValues {
+			if matches(expectedValue, value) {
+				return true
+			}
+		}
+		return false
+	}
+
+	if setOperator == "ForAllValues:" {
+		for _, value := range values {
+			if matchesExpected(value) == negated {
+				return conditionFalse
+			}
+		}
+		return conditionTrue
+	}
+
+	for _, value := range values {
+		if matchesExpected(value) != negated {
+			return conditionTrue
+		}
+	}
+	return conditionFalse
+}
+
+func conditionOperatorMatcher(operator string) (matches func(expected string, actual string) bool, negated bool, supported bool) {
+	exact := func(expected, actual string) bool { return expected == actual }
+	ignoreCase := func(expected, actual string) bool { return strings.EqualFold(expected, actual) }
+	wildcard := func(expected, actual string) bool { return matchesPattern(expected, actual, false) }
+
+	switch operator {
+	case "StringEquals":
+		return exact, false, true
+	case "StringNotEquals":
+		return exact, true, true
+	case "StringEqualsIgnoreCase", "Bool":
+		return ignoreCase, false, true
+	case "StringNotEqualsIgnoreCase":
+		return ignoreCase, true, true
+	case "StringLike", "ArnEquals", "ArnLike":
+		return wildcard, false, true
+	case "StringNotLike", "ArnNotEquals", "ArnNotLike":
+		return wildcard, true, true
+	}
+	return nil, false, false
+}
+
+func matchesAnyPattern(patterns []string, value string, ignoreCase bool) bool {
+	for _, pattern := range patterns {
+		if matchesPattern(pattern, value, ignoreCase) {
+			return true
+		}
+	}
+	return false
+}
+
+// Policy patterns support the '*' (any sequence of characters) and '?' (any single character) wildcards.
+// On a mismatch, only the last '*' seen needs to consume another character, since any match of an earlier '*' can be shifted to it.
+func matchesPattern(pattern string, value string, ignoreCase bool) bool {
+	if pattern == "*" {
+		return true
+	}
+	if ignoreCase {
+		pattern = strings.ToLower(pattern)
+		value = strings.ToLower(value)
+	}
+
+	patternChars, valueChars := []rune(pattern), []rune(value)
+	p, v := 0, 0
+	lastStar, lastStarMatchEnd := -1, 0
+	for v < len(valueChars) {
+		switch {
+		case p < len(patternChars) && patternChars[p] == '*':
+			lastStar, lastStarMatchEnd = p, v
+			p++
+		case p < len(patternChars) && (patternChars[p] == '?' || patternChars[p] == valueChars[v]):
+			p++
+			v++
+		case lastStar != -1:
+			lastStarMatchEnd++
+			p, v = lastStar+1, lastStarMatchEnd
+		default:
+			return false
+		}
+	}
+	for p < len(patternChars) && patternChars[p] == '*' {
+		p++
+	}
+	return p == len(patternChars)
+}
+
+func toConditionResult(value bool) conditionResult {
+	if value {
+		return conditionTrue
+	}
+	return conditionFalse
+}
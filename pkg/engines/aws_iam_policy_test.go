@@ -0,0 +1,264 @@
+package engines
+
+import (
+	"testing"
+
+	"github.com/torchsecurity/torch-secret-analyzer/pkg/clients"
+	"github.com/torchsecurity/torch-secret-analyzer/pkg/collectors/aws_secretsmanager"
+)
+
+const (
+	testSecretArn      = "arn:aws:secretsmanager:us-east-1:111111111111:secret:prod/db-AbCdEf"
+	testOtherSecretArn = "arn:aws:secretsmanager:us-east-1:111111111111:secret:prod/other-GhIjKl"
+	testKeyArn         = "arn:aws:kms:us-east-1:111111111111:key/1234abcd-12ab-34cd-56ef-1234567890ab"
+	testBoundaryArn    = "arn:aws:iam::111111111111:policy/boundary"
+	testExternalRole   = "arn:aws:iam::222222222222:role/app"
+)
+
+func TestMatchesPattern(t *testing.T) {
+	tests := []struct {
+		pattern    string
+		value      string
+		ignoreCase bool
+		matches    bool
+	}{
+		{pattern: "*", value: "anything", matches: true},
+		{pattern: "*", value: "", matches: true},
+		{pattern: "secretsmanager:GetSecretValue", value: "secretsmanager:GetSecretValue", matches: true},
+		{pattern: "secretsmanager:Get*", value: "secretsmanager:GetSecretValue", matches: true},
+		{pattern: "secretsmanager:get*", value: "secretsmanager:GetSecretValue", matches: false},
+		{pattern: "secretsmanager:get*", value: "secretsmanager:GetSecretValue", ignoreCase: true, matches: true},
+		{pattern: "secretsmanager:*Value", value: "secretsmanager:GetSecretValue", matches: true},
+		{pattern: "secretsmanager:*Value", value: "secretsmanager:GetSecretValues", matches: false},
+		{pattern: "arn:aws:secretsmanager:*:*:secret:prod/*", value: testSecretArn, matches: true},
+		{pattern: "arn:aws:secretsmanager:*:*:secret:dev/*", value: testSecretArn, matches: false},
+		{pattern: "arn:aws:secretsmanager:us-east-1:111111111111:secret:prod/db-??????", value: testSecretArn, matches: true},
+		{pattern: "arn:aws:secretsmanager:us-east-1:111111111111:secret:prod/db-?????", value: testSecretArn, matches: false},
+		{pattern: "*db*db*", value: "db-db", matches: true},
+		{pattern: "*db*db*", value: "dbd", matches: false},
+		{pattern: "a*b*c", value: "aXbXbXc", matches: true},
+		{pattern: "a*b*c", value: "aXbXcX", matches: false},
+		{pattern: "a**", value: "a", matches: true},
+		{pattern: "a.c", value: "abc", matches: false},
+		{pattern: "prod/(db)", value: "prod/(db)", matches: true},
+		{pattern: "", value: "", matches: true},
+		{pattern: "", value: "a", matches: false},
+		{pattern: "ünï*", value: "ünïcode", matches: true},
+	}
+
+	for _, test := range tests {
+		if matches := matchesPattern(test.pattern, test.value, test.ignoreCase); matches != test.matches {
+			t.Errorf("matchesPattern(%q, %q, %v) = %v, expected %v", test.pattern, test.value, test.ignoreCase, matches, test.matches)
+		}
+	}
+}
+
+func TestGetAWSPotentialConsumers(t *testing.T) {
+	allowRead := `{"Effect": "Allow", "Action": "secretsmanager:GetSecretValue", "Resource": "*"}`
+	denyRead := `{"Effect": "Deny", "Action": "secretsmanager:*", "Resource": "` + testSecretArn + `"}`
+
+	tests := []struct {
+		name           string
+		user           clients.IAMUser
+		managedPolicy  string // The permissions boundary of the user, when set
+		resourcePolicy string
+		encryptionKey  *aws_secretsmanager.EncryptionKeyDetails
+		expected       map[string]ConsumerAccess // By consumer name, absent when the consumer can't read the secret
+	}{
+		{
+			name:     "identity-based allow",
+			user:     testUser(allowRead),
+			expected: map[string]ConsumerAccess{"alice": AllowedAccess},
+		},
+		{
+			name:     "no statement allows",
+			user:     testUser(`{"Effect": "Allow", "Action": "secretsmanager:ListSecrets", "Resource": "*"}`),
+			expected: map[string]ConsumerAccess{},
+		},
+		{
+			name:     "explicit deny beats allow",
+			user:     testUser(allowRead, denyRead),
+			expected: map[string]ConsumerAccess{},
+		},
+		{
+			name:           "resource policy deny beats identity-based allow",
+			user:           testUser(allowRead),
+			resourcePolicy: testPolicy(`{"Effect": "Deny", "Principal": {"AWS": "arn:aws:iam::111111111111:user/alice"}, "Action": "secretsmanager:GetSecretValue"}`),
+			expected:       map[string]ConsumerAccess{},
+		},
+		{
+			name:           "resource policy allow of a principal of the same account",
+			user:           testUser(),
+			resourcePolicy: testPolicy(`{"Effect": "Allow", "Principal": {"AWS": "arn:aws:iam::111111111111:user/alice"}, "Action": "secretsmanager:GetSecretValue"}`),
+			expected:       map[string]ConsumerAccess{"alice": AllowedAccess},
+		},
+		{
+			name:           "resource policy allow of the same account delegates to identity-based policies",
+			user:           testUser(),
+			resourcePolicy: testPolicy(`{"Effect": "Allow", "Principal": {"AWS": "arn:aws:iam::111111111111:root"}, "Action": "secretsmanager:GetSecretValue"}`),
+			expected:       map[string]ConsumerAccess{},
+		},
+		{
+			name:     "NotResource excluding another secret",
+			user:     testUser(`{"Effect": "Allow", "Action": "secretsmanager:GetSecretValue", "NotResource": "` + testOtherSecretArn + `"}`),
+			expected: map[string]ConsumerAccess{"alice": AllowedAccess},
+		},
+		{
+			name:     "NotResource excluding the secret",
+			user:     testUser(`{"Effect": "Allow", "Action": "secretsmanager:GetSecretValue", "NotResource": "arn:aws:secretsmanager:*:*:secret:prod/*"}`),
+			expected: map[string]ConsumerAccess{},
+		},
+		{
+			name:     "NotAction excluding another action",
+			user:     testUser(`{"Effect": "Allow", "NotAction": "secretsmanager:Delete*", "Resource": "*"}`),
+			expected: map[string]ConsumerAccess{"alice": AllowedAccess},
+		},
+		{
+			name:     "deny with NotResource excluding the secret",
+			user:     testUser(allowRead, `{"Effect": "Deny", "Action": "*", "NotResource": "`+testSecretArn+`"}`),
+			expected: map[string]ConsumerAccess{"alice": AllowedAccess},
+		},
+		{
+			name:          "permissions boundary allowing the read",
+			user:          withBoundary(testUser(allowRead)),
+			managedPolicy: testPolicy(`{"Effect": "Allow", "Action": "secretsmanager:Get*", "Resource": "*"}`),
+			expected:      map[string]ConsumerAccess{"alice": AllowedAccess},
+		},
+		{
+			name:          "permissions boundary not allowing the read",
+			user:          withBoundary(testUser(allowRead)),
+			managedPolicy: testPolicy(`{"Effect": "Allow", "Action": "s3:*", "Resource": "*"}`),
+			expected:      map[string]ConsumerAccess{},
+		},
+		{
+			name:          "permissions boundary alone grants nothing",
+			user:          withBoundary(testUser()),
+			managedPolicy: testPolicy(allowRead),
+			expected:      map[string]ConsumerAccess{},
+		},
+		{
+			name:           "permissions boundary doesn't limit resource policy grants to the principal",
+			user:           withBoundary(testUser()),
+			managedPolicy:  testPolicy(`{"Effect": "Allow", "Action": "s3:*", "Resource": "*"}`),
+			resourcePolicy: testPolicy(`{"Effect": "Allow", "Principal": {"AWS": "arn:aws:iam::111111111111:user/alice"}, "Action": "secretsmanager:GetSecretValue"}`),
+			expected:       map[string]ConsumerAccess{"alice": AllowedAccess},
+		},
+		{
+			name:     "unknown permissions boundary",
+			user:     withBoundary(testUser(allowRead)),
+			expected: map[string]ConsumerAccess{"alice": ConditionalAccess},
+		},
+		{
+			name:     "condition on a key we can't resolve",
+			user:     testUser(`{"Effect": "Allow", "Action": "secretsmanager:GetSecretValue", "Resource": "*", "Condition": {"IpAddress": {"aws:SourceIp": "10.0.0.0/8"}}}`),
+			expected: map[string]ConsumerAccess{"alice": ConditionalAccess},
+		},
+		{
+			name:     "condition on a resource tag matching a principal tag",
+			user:     testUser(`{"Effect": "Allow", "Action": "secretsmanager:GetSecretValue", "Resource": "*", "Condition": {"StringEquals": {"secretsmanager:ResourceTag/team": "${aws:PrincipalTag/team}"}}}`),
+			expected: map[string]ConsumerAccess{"alice": AllowedAccess},
+		},
+		{
+			name:     "condition on a resource tag not matching a principal tag",
+			user:     withTeam(testUser(`{"Effect": "Allow", "Action": "secretsmanager:GetSecretValue", "Resource": "*", "Condition": {"StringEquals": {"secretsmanager:ResourceTag/team": "${aws:PrincipalTag/team}"}}}`), "payments"),
+			expected: map[string]ConsumerAccess{},
+		},
+		{
+			name:     "policy variable in the resource",
+			user:     testUser(`{"Effect": "Allow", "Action": "secretsmanager:GetSecretValue", "Resource": "arn:aws:secretsmanager:*:*:secret:${aws:PrincipalTag/env}/*"}`),
+			expected: map[string]ConsumerAccess{"alice": AllowedAccess},
+		},
+		{
+			name:           "cross-account allow requires the other account's identity-based policies",
+			user:           testUser(),
+			resourcePolicy: testPolicy(`{"Effect": "Allow", "Principal": {"AWS": "` + testExternalRole + `"}, "Action": "secretsmanager:GetSecretValue"}`),
+			encryptionKey:  testEncryptionKey(testPolicy(`{"Effect": "Allow", "Principal": {"AWS": "` + testExternalRole + `"}, "Action": "kms:Decrypt", "Resource": "*"}`)),
+			expected:       map[string]ConsumerAccess{"role/app": ConditionalAccess},
+		},
+		{
+			name:           "cross-account allow with a key policy that doesn't allow the principal",
+			user:           testUser(),
+			resourcePolicy: testPolicy(`{"Effect": "Allow", "Principal": {"AWS": "` + testExternalRole + `"}, "Action": "secretsmanager:GetSecretValue"}`),
+			encryptionKey:  testEncryptionKey(testPolicy(`{"Effect": "Allow", "Principal": {"AWS": "arn:aws:iam::111111111111:root"}, "Action": "kms:*", "Resource": "*"}`)),
+			expected:       map[string]ConsumerAccess{"role/app": BlockedByKMSAccess},
+		},
+		{
+			name:           "cross-account allow of a secret encrypted with the AWS managed key",
+			user:           testUser(),
+			resourcePolicy: testPolicy(`{"Effect": "Allow", "Principal": {"AWS": "` + testExternalRole + `"}, "Action": "secretsmanager:GetSecretValue"}`),
+			expected:       map[string]ConsumerAccess{"role/app": BlockedByKMSAccess},
+		},
+		{
+			name:           "cross-account allow denied by the resource policy",
+			user:           testUser(),
+			resourcePolicy: testPolicy(`{"Effect": "Allow", "Principal": {"AWS": "`+testExternalRole+`"}, "Action": "secretsmanager:GetSecretValue"}`, `{"Effect": "Deny", "Principal": {"AWS": "222222222222"}, "Action": "*"}`),
+			expected:       map[string]ConsumerAccess{},
+		},
+	}
+
+	for _, test := range tests {
+		t.Run(test.name, func(t *testing.T) {
+			authorizationDetails := &clients.IAMAuthorizationDetails{Users: []clients.IAMUser{test.user}, Policies: map[string]clients.IAMManagedPolicy{}}
+			if test.managedPolicy != "" {
+				authorizationDetails.Policies[testBoundaryArn] = clients.IAMManagedPolicy{Arn: testBoundaryArn, PolicyName: "boundary", PolicyDocument: test.managedPolicy}
+			}
+			secretDetails := &aws_secretsmanager.SecretDetails{
+				Secret:         clients.Secret{Arn: testSecretArn, Name: "prod/db", Tags: map[string]string{"team": "platform"}},
+				ResourcePolicy: test.resourcePolicy,
+				EncryptionKey:  test.encryptionKey,
+			}
+
+			consumers := GetAWSPotentialConsumers(authorizationDetails, secretDetails, nil)
+			if len(consumers) != len(test.expected) {
+				t.Fatalf("expected %d consumers, got %+v", len(test.expected), consumers)
+			}
+			for _, consumer := range consumers {
+				if expectedAccess, exists := test.expected[consumer.Name]; !exists || consumer.Access != expectedAccess {
+					t.Errorf("expected %s to have %q access, got %q (%s)", consumer.Name, expectedAccess, consumer.Access, consumer.AccessReason)
+				}
+			}
+		})
+	}
+}
+
+func testPolicy(statements ...string) string {
+	policy := `{"Version": "2012-10-17", "Statement": [`
+	for i, statement := range statements {
+		if i > 0 {
+			policy += ", "
+		}
+		policy += statement
+	}
+	return policy + "]}"
+}
+
+func testUser(statements ...string) clients.IAMUser {
+	user := clients.IAMUser{
+		Arn:      "arn:aws:iam::111111111111:user/alice",
+		UserId:   "AIDAALICE",
+		UserName: "alice",
+		Tags:     map[string]string{"team": "platform", "env": "prod"},
+	}
+	if len(statements) > 0 {
+		user.InlinePolicies = []clients.IAMInlinePolicy{{PolicyName: "inline", PolicyDocument: testPolicy(statements...)}}
+	}
+	return user
+}
+
+func withBoundary(user clients.IAMUser) clients.IAMUser {
+	user.PermissionsBoundaryArn = testBoundaryArn
+	return user
+}
+
+func withTeam(user clients.IAMUser, team string) clients.IAMUser {
+	user.Tags = map[string]string{"team": team}
+	return user
+}
+
+func testEncryptionKey(keyPolicy string, grants ...clients.KMSGrant) *aws_secretsmanager.EncryptionKeyDetails {
+	return &aws_secretsmanager.EncryptionKeyDetails{
+		Key:       clients.KMSKey{Arn: testKeyArn, KeyId: "1234abcd-12ab-34cd-56ef-1234567890ab", KeyManager: "CUSTOMER"},
+		KeyPolicy: keyPolicy,
+		Grants:    grants,
+	}
+}
@@ -0,0 +1,113 @@
+package engines
+
+import (
+	"encoding/json"
+	"time"
+
+	"github.com/samber/lo"
+	"github.com/torchsecurity/torch-secret-analyzer/pkg/clients"
+	"github.com/torchsecurity/torch-secret-analyzer/pkg/collectors/aws_cloudtrail"
+)
+
+// IdentityLink is an identity that assumed a role on the way to a consumer's session.
+type IdentityLink struct {
+	Type        string    `json:"type" yaml:"type"`
+	Arn         string    `json:"arn" yaml:"arn"` // The identity's ARN, or its principal id for SAML and web identity users which have none
+	AccessKeyId string    `json:"accessKeyId,omitempty" yaml:"accessKeyId,omitempty"`
+	AssumedRole string    `json:"assumedRole" yaml:"assumedRole"`
+	EventName   string    `json:"eventName" yaml:"eventName"`
+	EventTime   time.Time `json:"eventTime" yaml:"eventTime"`
+}
+
+type assumeRoleResponse struct {
+	Credentials *struct {
+		AccessKeyId string `json:"accessKeyId"`
+	} `json:"credentials"`
+}
+
+type assumeRoleRequest struct {
+	RoleArn string `json:"roleArn"`
+}
+
+// IdentityChainResolver follows role sessions back to the identity that originally assumed a role, through the AssumeRole* events
+// that issued the access key of each session in the chain.
+type IdentityChainResolver struct {
+	eventsByIssuedAccessKey map[string]clients.CloudtrailEvent
+}
+
+func NewIdentityChainResolver(assumeRoleEvents aws_cloudtrail.EventsByName) *IdentityChainResolver {
+	resolver := &IdentityChainResolver{eventsByIssuedAccessKey: map[string]clients.CloudtrailEvent{}}
+	for _, eventName := range aws_cloudtrail.AssumeRoleEvents {
+		for _, event := range assumeRoleEvents[eventName] {
+			var response assumeRoleResponse
+			if err := json.Unmarshal([]byte(event.ResponseElements), &response); err != nil || response.Credentials == nil {
+				continue
+			}
+			resolver.eventsByIssuedAccessKey[response.Credentials.AccessKeyId] = event
+		}
+	}
+	return resolver
+}
+
+// ResolveConsumer attaches the chain of identities behind a session to its consumer, starting with the originating identity,
+// and categorizes the consumer by that identity (e.g. a human behind a shared role).
+func (r *IdentityChainResolver) ResolveConsumer(event clients.CloudtrailEvent, consumer *Consumer) {
+	var chain []IdentityLink
+	var originIdentity clients.AWSUserIdentity
+	visitedAccessKeys := map[string]bool{}
+	accessKeyId := event.UserIdentity.AccessKeyId
+	for accessKeyId != "" && !visitedAccessKeys[accessKeyId] {
+		visitedAccessKeys[accessKeyId] = true
+		assumeRoleEvent, found := r.eventsByIssuedAccessKey[accessKeyId]
+		if !found {
+			break
+		}
+
+		var request assumeRoleRequest
+		_ = json.Unmarshal([]byte(assumeRoleEvent.RequestParameters), &request)
+		caller := assumeRoleEvent.UserIdentity
+		link := IdentityLink{
+			Type:        caller.Type,
+			Arn:         caller.Arn,
+			AccessKeyId: caller.AccessKeyId,
+			AssumedRole: request.RoleArn,
+			EventName:   assumeRoleEvent.EventName,
+			EventTime:   assumeRoleEvent.EventTime,
+		}
+		if link.Arn == "" {
+			link.Arn = caller.PrincipalId
+		}
+		chain = append([]IdentityLink{link}, chain...)
+		originIdentity = caller
+		accessKeyId = caller.AccessKeyId
+	}
+	if len(chain) == 0 {
+		return
+	}
+
+	consumer.IdentityChain = chain
+	if consumer.classified {
+		return
+	}
+	switch originIdentity.Type {
+	// A session whose issuing event was not collected is not the originating identity, so it doesn't tell who is behind the chain.
+	// An AWS service (e.g. Lambda, ECS or EC2) assumes a role on behalf of the workload the session already tells about.
+	case "AssumedRole", "AWSService":
+		return
+	}
+	consumer.Category, consumer.Type = classifyAssumingConsumer(federatedIdentity(originIdentity))
+}
+
+// federatedIdentity fills in the identity provider of a web identity user, which the AssumeRoleWithWebIdentity event only has
+// outside of the session context that the sessions it issues have (e.g. to tell EKS service accounts apart from other web identities).
+func federatedIdentity(userIdentity clients.AWSUserIdentity) clients.AWSUserIdentity {
+	if userIdentity.Type != "WebIdentityUser" || userIdentity.SessionContext != nil {
+		return userIdentity
+	}
+	userIdentity.SessionContext = &clients.AWSUserIdentitySessionContext{
+		WebIdFederationData: &clients.AWSUserIdentitySessionContextWebIdFederationData{
+			FederatedProvider: lo.CoalesceOrEmpty(userIdentity.IdentityProvider, userIdentity.PrincipalId),
+		},
+	}
+	return userIdentity
+}
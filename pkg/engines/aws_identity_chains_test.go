@@ -0,0 +1,135 @@
+package engines
+
+import (
+	"slices"
+	"testing"
+	"time"
+
+	"github.com/torchsecurity/torch-secret-analyzer/pkg/clients"
+	"github.com/torchsecurity/torch-secret-analyzer/pkg/collectors/aws_cloudtrail"
+)
+
+func TestIdentityChainResolver(t *testing.T) {
+	eventTime := time.Date(2024, 10, 1, 10, 0, 0, 0, time.UTC)
+	withAccessKey := func(userIdentity clients.AWSUserIdentity, accessKeyId string) clients.AWSUserIdentity {
+		userIdentity.AccessKeyId = accessKeyId
+		return userIdentity
+	}
+	assumeRole := func(eventName string, caller clients.AWSUserIdentity, roleArn string, issuedAccessKeyId string) clients.CloudtrailEvent {
+		return clients.CloudtrailEvent{
+			EventName:         eventName,
+			EventTime:         eventTime,
+			UserIdentity:      caller,
+			RequestParameters: `{"roleArn":"` + roleArn + `"}`,
+			ResponseElements:  `{"credentials":{"accessKeyId":"` + issuedAccessKeyId + `"}}`,
+		}
+	}
+	appRole := "arn:aws:iam::111111111111:role/app"
+	adminRole := "arn:aws:iam::111111111111:role/admin"
+
+	tests := []struct {
+		name             string
+		session          clients.AWSUserIdentity
+		assumeRoleEvents []clients.CloudtrailEvent
+		classified       bool
+		chain            []string // The ARNs of the identities in the chain, starting with the originating identity
+		category         ConsumerCategory
+		identityType     string
+	}{
+		{
+			name:    "user behind a role",
+			session: withAccessKey(testRoleSession("app", "alice"), "ASIAAPP"),
+			assumeRoleEvents: []clients.CloudtrailEvent{
+				assumeRole(aws_cloudtrail.AssumeRoleEvent, withAccessKey(testIAMUser("alice"), "AKIAALICE"), appRole, "ASIAAPP"),
+			},
+			chain:        []string{"arn:aws:iam::111111111111:user/alice"},
+			category:     HumanConsumer,
+			identityType: "AWS IAM User",
+		},
+		{
+			name:    "user behind a chain of roles",
+			session: withAccessKey(testRoleSession("app", "alice"), "ASIAAPP"),
+			assumeRoleEvents: []clients.CloudtrailEvent{
+				assumeRole(aws_cloudtrail.AssumeRoleEvent, withAccessKey(testIAMUser("alice"), "AKIAALICE"), adminRole, "ASIAADMIN"),
+				assumeRole(aws_cloudtrail.AssumeRoleEvent, withAccessKey(testRoleSession("admin", "alice"), "ASIAADMIN"), appRole, "ASIAAPP"),
+			},
+			chain:        []string{"arn:aws:iam::111111111111:user/alice", "arn:aws:sts::111111111111:assumed-role/admin/alice"},
+			category:     HumanConsumer,
+			identityType: "AWS IAM User",
+		},
+		{
+			name:    "SAML user behind a role",
+			session: withAccessKey(testRoleSession("app", "alice"), "ASIAAPP"),
+			assumeRoleEvents: []clients.CloudtrailEvent{
+				assumeRole(aws_cloudtrail.AssumeRoleWithSAMLEvent, clients.AWSUserIdentity{Type: "SAMLUser", PrincipalId: "idp:alice"}, appRole, "ASIAAPP"),
+			},
+			chain:        []string{"idp:alice"},
+			category:     HumanConsumer,
+			identityType: "AWS SAML User",
+		},
+		{
+			name:    "AWS service assuming the role of a workload",
+			session: withAccessKey(testRoleSession("app", "i-1"), "ASIAAPP"),
+			assumeRoleEvents: []clients.CloudtrailEvent{
+				assumeRole(aws_cloudtrail.AssumeRoleEvent, clients.AWSUserIdentity{Type: "AWSService", InvokedBy: "ec2.amazonaws.com"}, appRole, "ASIAAPP"),
+			},
+			chain:        []string{""},
+			category:     MachineConsumer,
+			identityType: "AWS EC2 Instance",
+		},
+		{
+			name:    "session whose issuing event was not collected",
+			session: withAccessKey(testRoleSession("app", "alice"), "ASIAAPP"),
+			assumeRoleEvents: []clients.CloudtrailEvent{
+				assumeRole(aws_cloudtrail.AssumeRoleEvent, withAccessKey(testRoleSession("admin", "alice"), "ASIAADMIN"), appRole, "ASIAAPP"),
+			},
+			chain:        []string{"arn:aws:sts::111111111111:assumed-role/admin/alice"},
+			category:     MachineConsumer,
+			identityType: "Application",
+		},
+		{
+			name:    "consumer classified by a custom rule",
+			session: withAccessKey(testRoleSession("app", "alice"), "ASIAAPP"),
+			assumeRoleEvents: []clients.CloudtrailEvent{
+				assumeRole(aws_cloudtrail.AssumeRoleEvent, withAccessKey(testIAMUser("alice"), "AKIAALICE"), appRole, "ASIAAPP"),
+			},
+			classified:   true,
+			chain:        []string{"arn:aws:iam::111111111111:user/alice"},
+			category:     MachineConsumer,
+			identityType: "Application",
+		},
+		{
+			name:         "session without an issuing event",
+			session:      withAccessKey(testRoleSession("app", "alice"), "ASIAAPP"),
+			category:     MachineConsumer,
+			identityType: "Application",
+		},
+	}
+
+	for _, test := range tests {
+		t.Run(test.name, func(t *testing.T) {
+			events := aws_cloudtrail.EventsByName{}
+			for _, event := range test.assumeRoleEvents {
+				events[event.EventName] = append(events[event.EventName], event)
+			}
+			event := testReadEvent(eventTime.Add(time.Hour), test.session, "10.0.0.1")
+			consumer, err := extractConsumerFromEvent(event)
+			if err != nil {
+				t.Fatal(err)
+			}
+			consumer.classified = test.classified
+
+			NewIdentityChainResolver(events).ResolveConsumer(event, &consumer)
+			var chain []string
+			for _, link := range consumer.IdentityChain {
+				chain = append(chain, link.Arn)
+			}
+			if !slices.Equal(chain, test.chain) {
+				t.Errorf("expected the chain %v, got %+v", test.chain, consumer.IdentityChain)
+			}
+			if consumer.Category != test.category || consumer.Type != test.identityType {
+				t.Errorf("expected a %s consumer of type %s, got %s of type %s", test.category, test.identityType, consumer.Category, consumer.Type)
+			}
+		})
+	}
+}
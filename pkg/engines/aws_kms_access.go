@@ -0,0 +1,157 @@
+package engines
+
+import (
+	"fmt"
+	"os"
+	"strings"
+
+	"github.com/samber/lo"
+	"github.com/torchsecurity/torch-secret-analyzer/pkg/clients"
+	"github.com/torchsecurity/torch-secret-analyzer/pkg/collectors/aws_secretsmanager"
+	"github.com/torchsecurity/torch-secret-analyzer/pkg/utils/colors"
+)
+
+const kmsDecryptAction = "kms:Decrypt"
+
+// keyAccess holds what's needed to evaluate whether principals can decrypt a secret with its KMS key.
+type keyAccess struct {
+	secret        clients.Secret
+	encryptionKey *aws_secretsmanager.EncryptionKeyDetails
+	keyPolicy     *PolicyDocument
+}
+
+func newKeyAccess(secretDetails *aws_secretsmanager.SecretDetails) keyAccess {
+	access := keyAccess{secret: secretDetails.Secret, encryptionKey: secretDetails.EncryptionKey}
+	if access.isCustomerManaged() {
+		document, err := parsePolicyDocument(access.encryptionKey.KeyPolicy)
+		if err != nil {
+			fmt.Fprintf(os.Stderr, colors.Yellow("Could not parse the key policy of %s: %v\n"), access.encryptionKey.Key.Arn, err)
+		}
+		access.keyPolicy = document
+	}
+	return access
+}
+
+// Secrets encrypted with the default aws/secretsmanager key (or any other AWS managed key) can be decrypted by any principal of the account
+// that can read them, since Secrets Manager uses the key on the principal's behalf.
+func (k keyAccess) isCustomerManaged() bool {
+	return k.encryptionKey != nil && k.encryptionKey.Key.KeyManager != "AWS"
+}
+
+func (k keyAccess) keyArn() string {
+	if k.encryptionKey == nil {
+		return "aws/secretsmanager"
+	}
+	return k.encryptionKey.Key.Arn
+}
+
+// newKeyRequest builds the kms:Decrypt request Secrets Manager makes on behalf of a principal when it reads the secret.
+func (k keyAccess) newKeyRequest(callerAccountId string) *authorizationRequest {
+	secretArn := k.secret.Arn
+	request := newAuthorizationRequest(kmsDecryptAction, k.keyArn()).
+		withValue("kms:ViaService", fmt.Sprintf("secretsmanager.%s.amazonaws.com", regionOfArn(secretArn))).
+		withValue("kms:EncryptionContext:SecretARN", secretArn).
+		withValue("kms:EncryptionContextKeys", "SecretARN", "SecretVersionId").
+		withValue("aws:ResourceAccount", accountIdOfArn(k.keyArn()))
+	if callerAccountId != "" {
+		request.withValue("kms:CallerAccount", callerAccountId)
+	}
+	return request
+}
+
+// evaluate evaluates whether an IAM principal of the secret's account can decrypt the secret with its key.
+// Unlike other resources, identity-based policies only apply to a KMS key when its key policy allows the whole account to use it.
+// Besides the key policy, a grant may allow the principal to decrypt with the key as well.
+func (k keyAccess) evaluate(principal iamPrincipal, managedPolicies map[string]*PolicyDocument, organization *clients.Organization) policyEvaluation {
+	if !k.isCustomerManaged() {
+		return policyEvaluation{allow: true}
+	}
+
+	request := k.newKeyRequest(principal.accountId)
+	addPrincipalValues(request, principal, organization)
+
+	keyPolicyEvaluation := evaluateResourcePolicy(k.keyPolicy, principal.requestPrincipal(), true, request)
+	accountPrincipal := requestPrincipal{arn: fmt.Sprintf("arn:aws:iam::%s:root", principal.accountId), accountId: principal.accountId}
+	accountEvaluation := evaluateResourcePolicy(k.keyPolicy, accountPrincipal, false, request)
+	identityEvaluation := evaluateIdentityAccess(principal, request, managedPolicies).intersect(accountEvaluation)
+
+	return keyPolicyEvaluation.union(identityEvaluation).union(k.evaluateGrants(principal.arn))
+}
+
+// evaluateExternal evaluates whether a principal outside the secret's account can decrypt the secret with its key.
+// Only the key policy and grants are evaluated, as the principal's identity-based policies are not available to us.
+func (k keyAccess) evaluateExternal(principal requestPrincipal) policyEvaluation {
+	if !k.isCustomerManaged() {
+		// AWS managed keys can't be used from other accounts
+		return policyEvaluation{}
+	}
+
+	request := k.newKeyRequest(principal.accountId)
+	if principal.arn != "" {
+		request.withValue("aws:PrincipalArn", principal.arn)
+	}
+	return evaluateResourcePolicy(k.keyPolicy, principal, false, request).union(k.evaluateGrants(principal.arn))
+}
+
+func (k keyAccess) evaluateGrants(granteePrincipal string) policyEvaluation {
+	var evaluation policyEvaluation
+	if granteePrincipal == "" {
+		return evaluation
+	}
+
+	for _, grant := range k.encryptionKey.Grants {
+		if grant.GranteePrincipal != granteePrincipal || !lo.Contains(grant.Operations, "Decrypt") {
+			continue
+		}
+		switch k.matchesGrantConstraints(grant) {
+		case conditionTrue:
+			evaluation.allow = true
+		case conditionUnknown:
+			evaluation.conditionalAllow = true
+			evaluation.unresolvedAllowKeys = append(evaluation.unresolvedAllowKeys, fmt.Sprintf("the encryption context constraints of grant %s", grant.GrantId))
+		}
+	}
+	return evaluation
+}
+
+// Secrets Manager encrypts each version of a secret with an encryption context of the secret's ARN and the version id.
+// We know the ARN, but a constraint on the version id depends on the version being read.
+func (k keyAccess) matchesGrantConstraints(grant clients.KMSGrant) conditionResult {
+	if len(grant.EncryptionContextEquals) > 0 && len(grant.EncryptionContextEquals) != 2 {
+		return conditionFalse
+	}
+
+	result := conditionTrue
+	for _, constraint := range []map[string]string{grant.EncryptionContextEquals, grant.EncryptionContextSubset} {
+		for key, value := range constraint {
+			switch key {
+			case "SecretARN":
+				if value != k.secret.Arn {
+					return conditionFalse
+				}
+			case "SecretVersionId":
+				result = conditionUnknown
+			default:
+				return conditionFalse
+			}
+		}
+	}
+	return result
+}
+
+// withKeyAccess marks a consumer that may read the secret, but can't decrypt it with the secret's KMS key.
+func (k keyAccess) withKeyAccess(consumer Consumer, keyEvaluation policyEvaluation) Consumer {
+	switch keyEvaluation.decision() {
+	case accessDenied:
+		consumer.Access = BlockedByKMSAccess
+		consumer.AccessReason = fmt.Sprintf("not allowed to kms:Decrypt with %s", k.keyArn())
+		if !k.isCustomerManaged() {
+			consumer.AccessReason = "secrets encrypted with an AWS managed key can't be read from other accounts"
+		}
+	case accessConditional:
+		consumer.Access = ConditionalAccess
+		reasons := lo.Compact([]string{consumer.AccessReason, fmt.Sprintf("kms:Decrypt %s", describeUnresolvedKeys(keyEvaluation.unresolvedKeys()))})
+		consumer.AccessReason = strings.Join(reasons, "; ")
+	}
+	return consumer
+}
@@ -0,0 +1,128 @@
+package engines
+
+import (
+	"testing"
+
+	"github.com/torchsecurity/torch-secret-analyzer/pkg/clients"
+	"github.com/torchsecurity/torch-secret-analyzer/pkg/collectors/aws_secretsmanager"
+)
+
+func TestKeyAccess(t *testing.T) {
+	allowRead := `{"Effect": "Allow", "Action": "secretsmanager:GetSecretValue", "Resource": "*"}`
+	allowDecrypt := `{"Effect": "Allow", "Action": "kms:Decrypt", "Resource": "*"}`
+	delegateToAccount := `{"Effect": "Allow", "Principal": {"AWS": "arn:aws:iam::111111111111:root"}, "Action": "kms:*", "Resource": "*"}`
+	aliceGrant := func(encryptionContextEquals map[string]string, encryptionContextSubset map[string]string) clients.KMSGrant {
+		return clients.KMSGrant{
+			GrantId:                 "grant-1",
+			GranteePrincipal:        "arn:aws:iam::111111111111:user/alice",
+			Operations:              []string{"Decrypt"},
+			EncryptionContextEquals: encryptionContextEquals,
+			EncryptionContextSubset: encryptionContextSubset,
+		}
+	}
+
+	tests := []struct {
+		name          string
+		user          clients.IAMUser
+		encryptionKey *aws_secretsmanager.EncryptionKeyDetails
+		access        ConsumerAccess
+	}{
+		{
+			name:   "AWS managed key",
+			user:   testUser(allowRead),
+			access: AllowedAccess,
+		},
+		{
+			name:          "key policy delegating to the account's identity-based policies",
+			user:          testUser(allowRead, allowDecrypt),
+			encryptionKey: testEncryptionKey(testPolicy(delegateToAccount)),
+			access:        AllowedAccess,
+		},
+		{
+			name:          "key policy delegating to the account without an identity-based allow",
+			user:          testUser(allowRead),
+			encryptionKey: testEncryptionKey(testPolicy(delegateToAccount)),
+			access:        BlockedByKMSAccess,
+		},
+		{
+			name:          "identity-based allow without a key policy delegating to the account",
+			user:          testUser(allowRead, allowDecrypt),
+			encryptionKey: testEncryptionKey(testPolicy(`{"Effect": "Allow", "Principal": {"AWS": "arn:aws:iam::111111111111:role/admin"}, "Action": "kms:*", "Resource": "*"}`)),
+			access:        BlockedByKMSAccess,
+		},
+		{
+			name:          "key policy allowing the principal",
+			user:          testUser(allowRead),
+			encryptionKey: testEncryptionKey(testPolicy(`{"Effect": "Allow", "Principal": {"AWS": "arn:aws:iam::111111111111:user/alice"}, "Action": "kms:Decrypt", "Resource": "*"}`)),
+			access:        AllowedAccess,
+		},
+		{
+			name: "key policy allowing the principal only through Secrets Manager",
+			user: testUser(allowRead),
+			encryptionKey: testEncryptionKey(testPolicy(`{"Effect": "Allow", "Principal": {"AWS": "arn:aws:iam::111111111111:user/alice"}, "Action": "kms:Decrypt", "Resource": "*",
+				"Condition": {"StringEquals": {"kms:ViaService": "secretsmanager.us-east-1.amazonaws.com"}}}`)),
+			access: AllowedAccess,
+		},
+		{
+			name: "key policy allowing the principal only through another service",
+			user: testUser(allowRead),
+			encryptionKey: testEncryptionKey(testPolicy(`{"Effect": "Allow", "Principal": {"AWS": "arn:aws:iam::111111111111:user/alice"}, "Action": "kms:Decrypt", "Resource": "*",
+				"Condition": {"StringEquals": {"kms:ViaService": "s3.us-east-1.amazonaws.com"}}}`)),
+			access: BlockedByKMSAccess,
+		},
+		{
+			name:          "key policy denying the principal",
+			user:          testUser(allowRead, allowDecrypt),
+			encryptionKey: testEncryptionKey(testPolicy(delegateToAccount, `{"Effect": "Deny", "Principal": {"AWS": "arn:aws:iam::111111111111:user/alice"}, "Action": "kms:Decrypt", "Resource": "*"}`)),
+			access:        BlockedByKMSAccess,
+		},
+		{
+			name:          "grant without constraints",
+			user:          testUser(allowRead),
+			encryptionKey: testEncryptionKey(testPolicy(delegateToAccount), aliceGrant(nil, nil)),
+			access:        AllowedAccess,
+		},
+		{
+			name:          "grant constrained to the secret",
+			user:          testUser(allowRead),
+			encryptionKey: testEncryptionKey(testPolicy(delegateToAccount), aliceGrant(nil, map[string]string{"SecretARN": testSecretArn})),
+			access:        AllowedAccess,
+		},
+		{
+			name:          "grant constrained to another secret",
+			user:          testUser(allowRead),
+			encryptionKey: testEncryptionKey(testPolicy(delegateToAccount), aliceGrant(nil, map[string]string{"SecretARN": testOtherSecretArn})),
+			access:        BlockedByKMSAccess,
+		},
+		{
+			name:          "grant constrained to a version of the secret",
+			user:          testUser(allowRead),
+			encryptionKey: testEncryptionKey(testPolicy(delegateToAccount), aliceGrant(map[string]string{"SecretARN": testSecretArn, "SecretVersionId": "v1"}, nil)),
+			access:        ConditionalAccess,
+		},
+		{
+			name:          "grant of another operation",
+			user:          testUser(allowRead),
+			encryptionKey: testEncryptionKey(testPolicy(delegateToAccount), clients.KMSGrant{GrantId: "grant-1", GranteePrincipal: "arn:aws:iam::111111111111:user/alice", Operations: []string{"Encrypt"}}),
+			access:        BlockedByKMSAccess,
+		},
+	}
+
+	for _, test := range tests {
+		t.Run(test.name, func(t *testing.T) {
+			authorizationDetails := &clients.IAMAuthorizationDetails{Users: []clients.IAMUser{test.user}, Policies: map[string]clients.IAMManagedPolicy{}}
+			secretDetails := &aws_secretsmanager.SecretDetails{
+				Secret:        clients.Secret{Arn: testSecretArn, Name: "prod/db"},
+				EncryptionKey: test.encryptionKey,
+			}
+
+			consumers := GetAWSPotentialConsumers(authorizationDetails, secretDetails, nil)
+			if len(consumers) != 1 {
+				t.Fatalf("expected a single consumer, got %+v", consumers)
+			}
+			if consumers[0].Access != test.access {
+				t.Errorf("expected %q access, got %q (%s)", test.access, consumers[0].Access, consumers[0].AccessReason)
+			}
+		})
+	}
+}
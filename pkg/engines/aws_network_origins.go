@@ -0,0 +1,146 @@
+package engines
+
+import (
+	"fmt"
+	"net"
+	"net/netip"
+
+	"github.com/samber/lo"
+	"github.com/torchsecurity/torch-secret-analyzer/pkg/clients"
+	"gopkg.in/yaml.v3"
+)
+
+// NetworkKind describes where a read came from.
+type NetworkKind string
+
+const (
+	AWSServiceNetwork     NetworkKind = "AWS Service"
+	VPCEndpointNetwork    NetworkKind = "VPC Endpoint"
+	InternalNetwork       NetworkKind = "Internal Network" // One of our own CIDR ranges, or a private IP address
+	PublicInternetNetwork NetworkKind = "Public Internet"
+)
+
+// NetworkOrigin is a network a consumer read a secret from, and how many of its reads came from it.
+type NetworkOrigin struct {
+	Kind           NetworkKind `json:"kind" yaml:"kind"`
+	Source         string      `json:"source" yaml:"source"` // The AWS service, the VPC endpoint id, the name of the internal network or the public IP address
+	Country        string      `json:"country,omitempty" yaml:"country,omitempty"`
+	ASN            uint        `json:"asn,omitempty" yaml:"asn,omitempty"`
+	ASOrganization string      `json:"asOrganization,omitempty" yaml:"asOrganization,omitempty"`
+	Reads          int         `json:"reads" yaml:"reads"`
+}
+
+// NamedNetwork is one of our own networks (e.g. a VPC or an office), by its CIDR ranges.
+type NamedNetwork struct {
+	Name  string   `yaml:"name"`
+	Cidrs []string `yaml:"cidrs"`
+
+	prefixes []netip.Prefix
+}
+
+type networksFile struct {
+	Networks []NamedNetwork `yaml:"networks"`
+}
+
+// ParseNetworks parses a YAML networks file ({"networks": [{"name": ..., "cidrs": [...]}]}).
+func ParseNetworks(data []byte) ([]NamedNetwork, error) {
+	var file networksFile
+	if err := yaml.Unmarshal(data, &file); err != nil {
+		return nil, fmt.Errorf("could not parse networks: %v", err)
+	}
+
+	for i := range file.Networks {
+		network := &file.Networks[i]
+		if network.Name == "" {
+			return nil, fmt.Errorf("network %d is missing a name", i+1)
+		}
+		for _, cidr := range network.Cidrs {
+			prefix, err := netip.ParsePrefix(cidr)
+			if err != nil {
+				return nil, fmt.Errorf("network %s has an invalid CIDR: %v", network.Name, err)
+			}
+			network.prefixes = append(network.prefixes, prefix.Masked())
+		}
+	}
+	return file.Networks, nil
+}
+
+// NetworkResolver annotates consumers with the networks their reads came from.
+type NetworkResolver struct {
+	networks []NamedNetwork
+	geoIP    *clients.GeoIPClient // Optional, looks up the country and ASN of public IP addresses
+}
+
+func NewNetworkResolver(networks []NamedNetwork, geoIP *clients.GeoIPClient) *NetworkResolver {
+	return &NetworkResolver{networks: networks, geoIP: geoIP}
+}
+
+func (r *NetworkResolver) ResolveConsumer(event clients.CloudtrailEvent, consumer *Consumer) {
+	if origin, found := r.networkOrigin(event); found {
+		consumer.NetworkOrigins = []NetworkOrigin{origin}
+	}
+}
+
+func (r *NetworkResolver) networkOrigin(event clients.CloudtrailEvent) (NetworkOrigin, bool) {
+	origin := NetworkOrigin{Reads: 1}
+	ip, err := netip.ParseAddr(event.SourceIpAddress)
+	switch {
+	// AWS services that call on behalf of a principal are logged by their service principal (e.g. lambda.amazonaws.com) instead of an IP address
+	case err != nil:
+		if event.SourceIpAddress == "" {
+			return origin, false
+		}
+		origin.Kind, origin.Source = AWSServiceNetwork, event.SourceIpAddress
+	case event.VpcEndpointId != "":
+		origin.Kind, origin.Source = VPCEndpointNetwork, event.VpcEndpointId
+	default:
+		ip = ip.Unmap()
+		if network, found := r.namedNetworkOf(ip); found {
+			origin.Kind, origin.Source = InternalNetwork, network
+		} else if ip.IsPrivate() || ip.IsLoopback() {
+			origin.Kind, origin.Source = InternalNetwork, ip.String()
+		} else {
+			origin.Kind, origin.Source = PublicInternetNetwork, ip.String()
+			if r.geoIP != nil {
+				// A failed lookup only means the origin is not enriched
+				record, _ := r.geoIP.Lookup(net.IP(ip.AsSlice()))
+				origin.Country, origin.ASN, origin.ASOrganization = record.Country, record.ASN, record.ASOrganization
+			}
+		}
+	}
+	return origin, true
+}
+
+func (r *NetworkResolver) namedNetworkOf(ip netip.Addr) (string, bool) {
+	for _, network := range r.networks {
+		for _, prefix := range network.prefixes {
+			if prefix.Contains(ip) {
+				return network.Name, true
+			}
+		}
+	}
+	return "", false
+}
+
+// mergeNetworkOrigins adds up the reads of the same network origins.
+func mergeNetworkOrigins(origins []NetworkOrigin, otherOrigins []NetworkOrigin) []NetworkOrigin {
+	merged := append([]NetworkOrigin{}, origins...)
+	for _, otherOrigin := range otherOrigins {
+		_, index, found := lo.FindIndexOf(merged, func(origin NetworkOrigin) bool {
+			return origin.Kind == otherOrigin.Kind && origin.Source == otherOrigin.Source
+		})
+		if found {
+			merged[index].Reads += otherOrigin.Reads
+		} else {
+			merged = append(merged, otherOrigin)
+		}
+	}
+	return lo.Ternary(len(merged) == 0, nil, merged)
+}
+
+// HasPublicInternetReads tells whether a consumer read the secret from outside of our networks and AWS.
+func HasPublicInternetReads(consumer Consumer) bool {
+	return lo.ContainsBy(consumer.NetworkOrigins, func(origin NetworkOrigin) bool {
+		return origin.Kind == PublicInternetNetwork
+	})
+}
@@ -0,0 +1,195 @@
+package engines
+
+import (
+	"slices"
+	"strings"
+	"testing"
+	"time"
+)
+
+func TestParseNetworks(t *testing.T) {
+	tests := []struct {
+		name     string
+		networks string
+		names    []string
+		err      string
+	}{
+		{
+			name: "valid networks",
+			networks: `
+networks:
+  - name: prod-vpc
+    cidrs: ["10.0.0.0/16", "2001:db8::/32"]
+  - name: office
+    cidrs: ["203.0.113.7/24"]
+`,
+			names: []string{"prod-vpc", "office"},
+		},
+		{
+			name:     "invalid YAML",
+			networks: `networks: [`,
+			err:      "could not parse networks",
+		},
+		{
+			name:     "missing name",
+			networks: `networks: [{name: prod-vpc, cidrs: ["10.0.0.0/16"]}, {cidrs: ["10.1.0.0/16"]}]`,
+			err:      "network 2 is missing a name",
+		},
+		{
+			name:     "invalid CIDR",
+			networks: `networks: [{name: prod-vpc, cidrs: ["10.0.0.0"]}]`,
+			err:      "network prod-vpc has an invalid CIDR",
+		},
+	}
+
+	for _, test := range tests {
+		t.Run(test.name, func(t *testing.T) {
+			networks, err := ParseNetworks([]byte(test.networks))
+			if test.err != "" {
+				if err == nil || !strings.Contains(err.Error(), test.err) {
+					t.Errorf("expected the error '%s', got %v", test.err, err)
+				}
+				return
+			}
+			if err != nil {
+				t.Fatal(err)
+			}
+			var names []string
+			for _, network := range networks {
+				names = append(names, network.Name)
+			}
+			if !slices.Equal(names, test.names) {
+				t.Errorf("expected the networks %v, got %v", test.names, names)
+			}
+		})
+	}
+}
+
+func TestNetworkResolver(t *testing.T) {
+	networks, err := ParseNetworks([]byte(`
+networks:
+  - name: prod-vpc
+    cidrs: ["10.0.0.0/16", "2001:db8::/32"]
+  - name: office
+    cidrs: ["203.0.113.7/24"]
+`))
+	if err != nil {
+		t.Fatal(err)
+	}
+	resolver := NewNetworkResolver(networks, nil)
+
+	tests := []struct {
+		name          string
+		sourceIp      string
+		vpcEndpointId string
+		origins       []NetworkOrigin
+	}{
+		{
+			name:     "AWS service",
+			sourceIp: "lambda.amazonaws.com",
+			origins:  []NetworkOrigin{{Kind: AWSServiceNetwork, Source: "lambda.amazonaws.com", Reads: 1}},
+		},
+		{
+			name:          "VPC endpoint",
+			sourceIp:      "10.0.1.5",
+			vpcEndpointId: "vpce-0abc",
+			origins:       []NetworkOrigin{{Kind: VPCEndpointNetwork, Source: "vpce-0abc", Reads: 1}},
+		},
+		{
+			name:     "named network",
+			sourceIp: "10.0.1.5",
+			origins:  []NetworkOrigin{{Kind: InternalNetwork, Source: "prod-vpc", Reads: 1}},
+		},
+		{
+			name:     "named network of an IPv6 address",
+			sourceIp: "2001:db8::1",
+			origins:  []NetworkOrigin{{Kind: InternalNetwork, Source: "prod-vpc", Reads: 1}},
+		},
+		{
+			name:     "named network of an IPv4-mapped IPv6 address",
+			sourceIp: "::ffff:10.0.1.5",
+			origins:  []NetworkOrigin{{Kind: InternalNetwork, Source: "prod-vpc", Reads: 1}},
+		},
+		{
+			name:     "named network of a CIDR with host bits",
+			sourceIp: "203.0.113.200",
+			origins:  []NetworkOrigin{{Kind: InternalNetwork, Source: "office", Reads: 1}},
+		},
+		{
+			name:     "private IP address",
+			sourceIp: "192.168.1.1",
+			origins:  []NetworkOrigin{{Kind: InternalNetwork, Source: "192.168.1.1", Reads: 1}},
+		},
+		{
+			name:     "loopback IP address",
+			sourceIp: "127.0.0.1",
+			origins:  []NetworkOrigin{{Kind: InternalNetwork, Source: "127.0.0.1", Reads: 1}},
+		},
+		{
+			name:     "public IP address",
+			sourceIp: "198.51.100.1",
+			origins:  []NetworkOrigin{{Kind: PublicInternetNetwork, Source: "198.51.100.1", Reads: 1}},
+		},
+		{
+			name: "missing source IP address",
+		},
+	}
+
+	for _, test := range tests {
+		t.Run(test.name, func(t *testing.T) {
+			event := testReadEvent(time.Date(2024, 10, 1, 10, 0, 0, 0, time.UTC), testRoleSession("app", "i-1"), test.sourceIp)
+			event.VpcEndpointId = test.vpcEndpointId
+			consumer, err := extractResolvedConsumer(event, []ConsumerResolver{resolver})
+			if err != nil {
+				t.Fatal(err)
+			}
+			if !slices.Equal(consumer.NetworkOrigins, test.origins) {
+				t.Errorf("expected the network origins %v, got %v", test.origins, consumer.NetworkOrigins)
+			}
+			if HasPublicInternetReads(consumer) != (len(test.origins) > 0 && test.origins[0].Kind == PublicInternetNetwork) {
+				t.Errorf("expected public internet reads only from public IP addresses, got %v", consumer.NetworkOrigins)
+			}
+		})
+	}
+}
+
+func TestMergeNetworkOrigins(t *testing.T) {
+	vpc := NetworkOrigin{Kind: InternalNetwork, Source: "prod-vpc", Reads: 2}
+	public := NetworkOrigin{Kind: PublicInternetNetwork, Source: "198.51.100.1", Reads: 1}
+	vpcEndpoint := NetworkOrigin{Kind: VPCEndpointNetwork, Source: "prod-vpc", Reads: 3}
+
+	tests := []struct {
+		name         string
+		origins      []NetworkOrigin
+		otherOrigins []NetworkOrigin
+		merged       []NetworkOrigin
+	}{
+		{
+			name: "no origins",
+		},
+		{
+			name:         "same origins add up",
+			origins:      []NetworkOrigin{vpc, public},
+			otherOrigins: []NetworkOrigin{public},
+			merged:       []NetworkOrigin{vpc, {Kind: PublicInternetNetwork, Source: "198.51.100.1", Reads: 2}},
+		},
+		{
+			name:         "origins of another kind are kept apart",
+			origins:      []NetworkOrigin{vpc},
+			otherOrigins: []NetworkOrigin{vpcEndpoint},
+			merged:       []NetworkOrigin{vpc, vpcEndpoint},
+		},
+	}
+
+	for _, test := range tests {
+		t.Run(test.name, func(t *testing.T) {
+			merged := mergeNetworkOrigins(test.origins, test.otherOrigins)
+			if !slices.Equal(merged, test.merged) {
+				t.Errorf("expected the network origins %v, got %v", test.merged, merged)
+			}
+			if len(test.origins) > 0 && test.origins[0].Reads != vpc.Reads {
+				t.Errorf("expected the merged origins not to change the consumer's origins, got %v", test.origins)
+			}
+		})
+	}
+}
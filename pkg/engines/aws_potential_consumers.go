@@ -0,0 +1,394 @@
+package engines
+
+import (
+	"fmt"
+	"os"
+	"strings"
+
+	"github.com/aws/aws-sdk-go-v2/aws/arn"
+	"github.com/samber/lo"
+	"github.com/torchsecurity/torch-secret-analyzer/pkg/clients"
+	"github.com/torchsecurity/torch-secret-analyzer/pkg/collectors/aws_secretsmanager"
+	"github.com/torchsecurity/torch-secret-analyzer/pkg/utils/colors"
+)
+
+const getSecretValueAction = "secretsmanager:GetSecretValue"
+
+// iamPrincipal is an IAM user or role, along with every identity-based policy that applies to it.
+type iamPrincipal struct {
+	consumer               Consumer
+	arn                    string
+	accountId              string
+	principalType          string // The aws:PrincipalType the principal would have when calling AWS
+	userName               string
+	tags                   map[string]string
+	policies               []*PolicyDocument
+	permissionsBoundaryArn string
+}
+
+// GetAWSPotentialConsumers evaluates the IAM policies of every user and role in the account along with the secret's resource policy,
+// and returns the principals that are allowed to read the secret's value.
+func GetAWSPotentialConsumers(authorizationDetails *clients.IAMAuthorizationDetails, secretDetails *aws_secretsmanager.SecretDetails, organization *clients.Organization) []Consumer {
+	managedPolicies := parseManagedPolicies(authorizationDetails.Policies)
+	resourcePolicy := parseResourcePolicy(secretDetails)
+	keyAccess := newKeyAccess(secretDetails)
+
+	var consumers []Consumer
+	for _, principal := range getIAMPrincipals(authorizationDetails, managedPolicies) {
+		request := newSecretAccessRequest(secretDetails.Secret, principal, organization)
+		// Within the same account, either an identity-based policy or the resource policy may grant access, and an explicit deny in any of them wins.
+		evaluation := evaluateIdentityAccess(principal, request, managedPolicies).
+			union(evaluateResourcePolicy(resourcePolicy, principal.requestPrincipal(), true, request))
+		if consumer, allowed := toPotentialConsumer(principal.consumer, evaluation, ""); allowed {
+			consumers = append(consumers, keyAccess.withKeyAccess(consumer, keyAccess.evaluate(principal, managedPolicies, organization)))
+		}
+	}
+
+	consumers = append(consumers, getExternalConsumers(resourcePolicy, secretDetails.Secret, keyAccess)...)
+	return consumers
+}
+
+func toPotentialConsumer(consumer Consumer, evaluation policyEvaluation, requirement string) (Consumer, bool) {
+	decision := evaluation.decision()
+	if decision == accessDenied {
+		return consumer, false
+	}
+
+	consumer.Access = AllowedAccess
+	if decision == accessConditional || requirement != "" {
+		consumer.Access = ConditionalAccess
+		reasons := lo.Compact([]string{requirement, describeUnresolvedKeys(evaluation.unresolvedKeys())})
+		consumer.AccessReason = strings.Join(reasons, "; ")
+	}
+	return consumer, true
+}
+
+// newSecretAccessRequest builds a GetSecretValue request of the principal, with every condition key we are able to resolve without the actual request.
+func newSecretAccessRequest(secret clients.Secret, principal iamPrincipal, organization *clients.Organization) *authorizationRequest {
+	return addPrincipalValues(newSecretRequest(secret), principal, organization)
+}
+
+func addPrincipalValues(request *authorizationRequest, principal iamPrincipal, organization *clients.Organization) *authorizationRequest {
+	request.
+		withValue("aws:PrincipalArn", principal.arn).
+		withValue("aws:PrincipalAccount", principal.accountId).
+		withValue("aws:PrincipalType", principal.principalType).
+		withValue("aws:PrincipalIsAWSService", "false").
+		withTags("aws:PrincipalTag/", principal.tags)
+
+	if principal.userName != "" {
+		request.withValue("aws:username", principal.userName)
+	}
+	if organization != nil {
+		if organization.Id != "" {
+			request.withValue("aws:PrincipalOrgID", organization.Id)
+		} else {
+			request.withKnownPrefix("aws:PrincipalOrgID")
+		}
+	}
+	return request
+}
+
+func newSecretRequest(secret clients.Secret) *authorizationRequest {
+	return newAuthorizationRequest(getSecretValueAction, secret.Arn).
+		withValue("secretsmanager:SecretId", secret.Arn).
+		withValue("aws:ResourceAccount", accountIdOfArn(secret.Arn)).
+		withValue("aws:RequestedRegion", regionOfArn(secret.Arn)).
+		withTags("aws:ResourceTag/", secret.Tags).
+		withTags("secretsmanager:ResourceTag/", secret.Tags)
+}
+
+// A principal's effective permissions are the intersection of its identity-based policies and its permissions boundary (if it has one).
+func evaluateIdentityAccess(principal iamPrincipal, request *authorizationRequest, managedPolicies map[string]*PolicyDocument) policyEvaluation {
+	identityEvaluation := evaluatePolicies(principal.policies, request)
+	if principal.permissionsBoundaryArn == "" {
+		return identityEvaluation
+	}
+
+	permissionsBoundary, exists := managedPolicies[principal.permissionsBoundaryArn]
+	if !exists {
+		// AWS managed policies that are only used as a permissions boundary are not returned by the authorization details.
+		return identityEvaluation.intersect(policyEvaluation{
+			conditionalAllow:    true,
+			unresolvedAllowKeys: []string{fmt.Sprintf("permissions boundary %s", principal.permissionsBoundaryArn)},
+		})
+	}
+	return identityEvaluation.intersect(evaluatePolicies([]*PolicyDocument{permissionsBoundary}, request))
+}
+
+// getExternalConsumers returns the principals outside the secret's account that the resource policy allows to read the secret.
+// They also need an identity-based policy in their own account (which we can't see), so their access is always conditional.
+func getExternalConsumers(resourcePolicy *PolicyDocument, secret clients.Secret, keyAccess keyAccess) []Consumer {
+	if resourcePolicy == nil {
+		return nil
+	}
+	secretAccountId := accountIdOfArn(secret.Arn)
+
+	var consumers []Consumer
+	seenPrincipals := map[string]bool{}
+	for _, statement := range resourcePolicy.Statement {
+		if !strings.EqualFold(statement.Effect, "Allow") || statement.Principal == nil {
+			continue
+		}
+
+		principals := lo.Without(statement.Principal.AWS, "*")
+		if statement.Principal.All {
+			principals = append(principals, "*")
+		}
+		for _, principalValue := range principals {
+			if seenPrincipals[principalValue] {
+				continue
+			}
+			seenPrincipals[principalValue] = true
+
+			principal, consumer := describeExternalPrincipal(principalValue, statement)
+			if principalValue != "*" && principal.accountId == secretAccountId {
+				// Principals of the secret's account are evaluated along with their identity-based policies
+				continue
+			}
+
+			request := newSecretRequest(secret)
+			if principal.accountId != "" {
+				request.withValue("aws:PrincipalAccount", principal.accountId)
+			}
+			if principal.arn != "" {
+				request.withValue("aws:PrincipalArn", principal.arn)
+			}
+			evaluation := evaluateResourcePolicy(resourcePolicy, principal, false, request)
+			requirement := "requires an identity-based policy in the principal's account"
+			if principal.accountId != "" {
+				requirement = fmt.Sprintf("requires an identity-based policy in account %s", principal.accountId)
+			}
+			if consumer, allowed := toPotentialConsumer(consumer, evaluation, requirement); allowed {
+				consumers = append(consumers, keyAccess.withKeyAccess(consumer, keyAccess.evaluateExternal(principal)))
+			}
+		}
+	}
+	return consumers
+}
+
+func describeExternalPrincipal(principalValue string, statement PolicyStatement) (requestPrincipal, Consumer) {
+	if principalValue == "*" {
+		name := "Any AWS principal"
+		if orgIds := conditionValues(statement, "StringEquals", "aws:PrincipalOrgID"); len(orgIds) > 0 {
+			name = fmt.Sprintf("Any principal in organization %s", strings.Join(orgIds, ", "))
+		}
+		return requestPrincipal{}, Consumer{Category: MachineConsumer, Type: "Any AWS Principal", Name: name, ExternalId: principalValue}
+	}
+
+	if accountId := accountIdOfPrincipal(principalValue); accountId != "" {
+		return requestPrincipal{accountId: accountId}, Consumer{
+			Category:             MachineConsumer,
+			Type:                 "AWS Account",
+			Name:                 accountId,
+			ExternalId:           accountId,
+			ExternalResourceName: fmt.Sprintf("arn:aws:iam::%s:root", accountId),
+		}
+	}
+
+	principalArn, err := arn.Parse(principalValue)
+	if err != nil {
+		// A unique id of a principal which no longer exists
+		return requestPrincipal{id: principalValue}, Consumer{Category: MachineConsumer, Type: "Unknown Principal", Name: principalValue, ExternalId: principalValue}
+	}
+
+	consumer := Consumer{
+		Category:             MachineConsumer,
+		Type:                 "AWS IAM Role",
+		Name:                 principalArn.Resource,
+		ExternalId:           principalValue,
+		ExternalResourceName: principalValue,
+	}
+	if strings.HasPrefix(principalArn.Resource, "user/") {
+		consumer.Category = HumanConsumer
+		consumer.Type = "AWS IAM User"
+	}
+	return requestPrincipal{arn: principalValue, accountId: principalArn.AccountID}, consumer
+}
+
+// conditionValues returns the values of a condition key under a condition operator (both are case-insensitive).
+func conditionValues(statement PolicyStatement, operator string, key string) []string {
+	var values []string
+	for statementOperator, keysToValues := range statement.Condition {
+		if !strings.EqualFold(statementOperator, operator) {
+			continue
+		}
+		for statementKey, statementValues := range keysToValues {
+			if strings.EqualFold(statementKey, key) {
+				values = append(values, statementValues...)
+			}
+		}
+	}
+	return values
+}
+
+func parseResourcePolicy(secretDetails *aws_secretsmanager.SecretDetails) *PolicyDocument {
+	if secretDetails.ResourcePolicy == "" {
+		return nil
+	}
+	document, err := parsePolicyDocument(secretDetails.ResourcePolicy)
+	if err != nil {
+		fmt.Fprintf(os.Stderr, colors.Yellow("Could not parse the resource policy of secret %s: %v\n"), secretDetails.Secret.Arn, err)
+		return nil
+	}
+	return document
+}
+
+func describeUnresolvedKeys(unresolvedKeys []string) string {
+	if len(unresolvedKeys) == 0 {
+		return ""
+	}
+	return fmt.Sprintf("depends on %s", strings.Join(unresolvedKeys, ", "))
+}
+
+func (p iamPrincipal) requestPrincipal() requestPrincipal {
+	return requestPrincipal{arn: p.arn, id: p.consumer.ExternalId, accountId: p.accountId}
+}
+
+func getIAMPrincipals(authorizationDetails *clients.IAMAuthorizationDetails, managedPolicies map[string]*PolicyDocument) []iamPrincipal {
+	groups := lo.KeyBy(authorizationDetails.Groups, func(group clients.IAMGroup) string {
+		return group.GroupName
+	})
+
+	var principals []iamPrincipal
+	for _, user := range authorizationDetails.Users {
+		inlinePolicies := user.InlinePolicies
+		attachedPolicyArns := user.AttachedPolicyArns
+		// Users inherit the policies of the groups they are members of
+		for _, groupName := range user.GroupNames {
+			if group, exists := groups[groupName]; exists {
+				inlinePolicies = append(inlinePolicies, group.InlinePolicies...)
+				attachedPolicyArns = append(attachedPolicyArns, group.AttachedPolicyArns...)
+			}
+		}
+
+		principals = append(principals, iamPrincipal{
+			consumer: Consumer{
+				Category:             HumanConsumer,
+				Type:                 "AWS IAM User",
+				Name:                 user.UserName,
+				ExternalId:           user.UserId,
+				ExternalResourceName: user.Arn,
+			},
+			arn:                    user.Arn,
+			accountId:              accountIdOfArn(user.Arn),
+			principalType:          "User",
+			userName:               user.UserName,
+			tags:                   user.Tags,
+			policies:               collectPolicyDocuments(user.Arn, inlinePolicies, attachedPolicyArns, managedPolicies),
+			permissionsBoundaryArn: user.PermissionsBoundaryArn,
+		})
+	}
+
+	for _, role := range authorizationDetails.Roles {
+		category, identityType := classifyIAMRole(role)
+		principals = append(principals, iamPrincipal{
+			consumer: Consumer{
+				Category:             category,
+				Type:                 identityType,
+				Name:                 role.RoleName,
+				ExternalId:           role.RoleId,
+				ExternalResourceName: role.Arn,
+			},
+			arn:                    role.Arn,
+			accountId:              accountIdOfArn(role.Arn),
+			principalType:          "AssumedRole",
+			tags:                   role.Tags,
+			policies:               collectPolicyDocuments(role.Arn, role.InlinePolicies, role.AttachedPolicyArns, managedPolicies),
+			permissionsBoundaryArn: role.PermissionsBoundaryArn,
+		})
+	}
+
+	return principals
+}
+
+func accountIdOfArn(resourceArn string) string {
+	parsedArn, err := arn.Parse(resourceArn)
+	if err != nil {
+		return ""
+	}
+	return parsedArn.AccountID
+}
+
+func regionOfArn(resourceArn string) string {
+	parsedArn, err := arn.Parse(resourceArn)
+	if err != nil {
+		return ""
+	}
+	return parsedArn.Region
+}
+
+func collectPolicyDocuments(principalArn string, inlinePolicies []clients.IAMInlinePolicy, attachedPolicyArns []string, managedPolicies map[string]*PolicyDocument) []*PolicyDocument {
+	var documents []*PolicyDocument
+	for _, inlinePolicy := range inlinePolicies {
+		document, err := parsePolicyDocument(inlinePolicy.PolicyDocument)
+		if err != nil {
+			fmt.Fprintf(os.Stderr, colors.Yellow("Could not parse inline policy %s of %s: %v\n"), inlinePolicy.PolicyName, principalArn, err)
+			continue
+		}
+		documents = append(documents, document)
+	}
+	for _, policyArn := range attachedPolicyArns {
+		if document, exists := managedPolicies[policyArn]; exists {
+			documents = append(documents, document)
+		}
+	}
+	return documents
+}
+
+func parseManagedPolicies(policies map[string]clients.IAMManagedPolicy) map[string]*PolicyDocument {
+	documents := map[string]*PolicyDocument{}
+	for policyArn, policy := range policies {
+		document, err := parsePolicyDocument(policy.PolicyDocument)
+		if err != nil {
+			fmt.Fprintf(os.Stderr, colors.Yellow("Could not parse managed policy %s: %v\n"), policyArn, err)
+			continue
+		}
+		documents[policyArn] = document
+	}
+	return documents
+}
+
+// A role's consumer is whoever is trusted to assume it, so we classify roles by their trust policy.
+func classifyIAMRole(role clients.IAMRole) (category ConsumerCategory, identityType string) {
+	if strings.HasPrefix(role.Path, "/aws-service-role/") {
+		return MachineConsumer, "AWS Service"
+	}
+	if strings.HasPrefix(role.RoleName, "AWSReservedSSO_") {
+		return HumanConsumer, "AWS SAML User"
+	}
+
+	trustPolicy, err := parsePolicyDocument(role.AssumeRolePolicyDocument)
+	if err != nil {
+		return MachineConsumer, "AWS IAM Role"
+	}
+
+	var federatedProviders, services []string
+	for _, statement := range trustPolicy.Statement {
+		if statement.Principal != nil && strings.EqualFold(statement.Effect, "Allow") {
+			federatedProviders = append(federatedProviders, statement.Principal.Federated...)
+			services = append(services, statement.Principal.Service...)
+		}
+	}
+
+	for _, federatedProvider := range federatedProviders {
+		if strings.Contains(federatedProvider, "oidc.eks.") {
+			return MachineConsumer, "AWS EKS Service Account"
+		}
+	}
+	for _, federatedProvider := range federatedProviders {
+		if strings.Contains(federatedProvider, ":saml-provider/") {
+			return HumanConsumer, "AWS SAML User"
+		}
+	}
+	if len(federatedProviders) > 0 {
+		return HumanConsumer, "Web Identity User"
+	}
+	if lo.Contains(services, "pods.eks.amazonaws.com") {
+		return MachineConsumer, "AWS EKS Service Account"
+	}
+	if lo.Contains(services, "ec2.amazonaws.com") {
+		return MachineConsumer, "AWS EC2 Instance"
+	}
+	return MachineConsumer, "AWS IAM Role"
+}
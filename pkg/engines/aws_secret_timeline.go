@@ -0,0 +1,80 @@
+package engines
+
+import (
+	"sort"
+	"time"
+
+	"github.com/samber/lo"
+	"github.com/torchsecurity/torch-secret-analyzer/pkg/collectors/aws_cloudtrail"
+)
+
+// TimelineEvent is a single read or write event of a secret. Unlike consumers, timeline events are never collapsed.
+type TimelineEvent struct {
+	EventId         string    `json:"eventId" yaml:"eventId"`
+	EventName       string    `json:"eventName" yaml:"eventName"`
+	EventTime       time.Time `json:"eventTime" yaml:"eventTime"`
+	Principal       Consumer  `json:"principal" yaml:"principal"`
+	SourceIpAddress string    `json:"sourceIpAddress" yaml:"sourceIpAddress"`
+	UserAgent       string    `json:"userAgent" yaml:"userAgent"`
+	Client          string    `json:"client,omitempty" yaml:"client,omitempty"` // The client identified by the user agent
+}
+
+// TimelineBucket counts the events of a secret in a period of time (e.g. an hour or a day).
+type TimelineBucket struct {
+	Start  time.Time `json:"start" yaml:"start"`
+	Reads  int       `json:"reads" yaml:"reads"`
+	Writes int       `json:"writes" yaml:"writes"`
+}
+
+// GetAWSSecretTimeline lists every read and write event of a secret, in chronological order.
+func GetAWSSecretTimeline(cloudtrailEvents aws_cloudtrail.EventsByName, secretId string, resolvers ...ConsumerResolver) []TimelineEvent {
+	var timeline []TimelineEvent
+	for _, eventName := range aws_cloudtrail.SupportedEvents {
+		for _, event := range filterEventsBySecret(cloudtrailEvents[eventName], secretId) {
+			// Events that can't be attributed to a consumer are kept, with their unattributed principal
+			principal, _ := extractResolvedConsumer(event, resolvers)
+			timeline = append(timeline, TimelineEvent{
+				EventId:         event.ExternalId,
+				EventName:       eventName,
+				EventTime:       event.EventTime,
+				Principal:       principal,
+				SourceIpAddress: event.SourceIpAddress,
+				UserAgent:       event.UserAgent,
+				Client:          ParseUserAgent(event.UserAgent),
+			})
+		}
+	}
+
+	sort.SliceStable(timeline, func(i, j int) bool {
+		return timeline[i].EventTime.Before(timeline[j].EventTime)
+	})
+	return timeline
+}
+
+// BucketAWSSecretTimeline counts the read and write events of a timeline per period of the given size, in UTC.
+// Periods without events are omitted.
+func BucketAWSSecretTimeline(timeline []TimelineEvent, bucketSize time.Duration) []TimelineBucket {
+	bucketsByStart := map[time.Time]*TimelineBucket{}
+	for _, event := range timeline {
+		start := event.EventTime.UTC().Truncate(bucketSize)
+		bucket, exists := bucketsByStart[start]
+		if !exists {
+			bucket = &TimelineBucket{Start: start}
+			bucketsByStart[start] = bucket
+		}
+		if lo.Contains(aws_cloudtrail.ReadEvents, event.EventName) {
+			bucket.Reads++
+		} else {
+			bucket.Writes++
+		}
+	}
+
+	var buckets []TimelineBucket
+	for _, bucket := range bucketsByStart {
+		buckets = append(buckets, *bucket)
+	}
+	sort.Slice(buckets, func(i, j int) bool {
+		return buckets[i].Start.Before(buckets[j].Start)
+	})
+	return buckets
+}
@@ -0,0 +1,79 @@
+package engines
+
+import (
+	"slices"
+	"testing"
+	"time"
+
+	"github.com/torchsecurity/torch-secret-analyzer/pkg/clients"
+	"github.com/torchsecurity/torch-secret-analyzer/pkg/collectors/aws_cloudtrail"
+)
+
+func TestGetAWSSecretTimeline(t *testing.T) {
+	eventOf := func(eventName string, eventId string, eventTime time.Time) clients.CloudtrailEvent {
+		event := testReadEvent(eventTime, testRoleSession("app", "i-1"), "10.0.0.1")
+		event.EventName = eventName
+		event.ExternalId = eventId
+		return event
+	}
+	otherSecretRead := eventOf(aws_cloudtrail.GetSecretValueEvent, "other", time.Date(2024, 10, 1, 10, 0, 0, 0, time.UTC))
+	otherSecretRead.Resources = []clients.CloudTrailEventResource{{ResourceType: "AWS::SecretsManager::Secret", ResourceName: testOtherSecretArn}}
+
+	events := aws_cloudtrail.EventsByName{
+		aws_cloudtrail.GetSecretValueEvent: {
+			eventOf(aws_cloudtrail.GetSecretValueEvent, "read-2", time.Date(2024, 10, 1, 10, 45, 0, 0, time.UTC)),
+			eventOf(aws_cloudtrail.GetSecretValueEvent, "read-1", time.Date(2024, 10, 1, 10, 5, 0, 0, time.UTC)),
+			eventOf(aws_cloudtrail.GetSecretValueEvent, "read-3", time.Date(2024, 10, 2, 9, 0, 0, 0, time.UTC)),
+			otherSecretRead,
+		},
+		aws_cloudtrail.PutSecretValueEvent: {
+			eventOf(aws_cloudtrail.PutSecretValueEvent, "write-1", time.Date(2024, 10, 1, 10, 30, 0, 0, time.UTC)),
+			eventOf(aws_cloudtrail.PutSecretValueEvent, "write-2", time.Date(2024, 10, 1, 12, 0, 0, 0, time.UTC)),
+		},
+	}
+	timeline := GetAWSSecretTimeline(events, "prod/db")
+
+	var eventIds []string
+	for _, event := range timeline {
+		eventIds = append(eventIds, event.EventId)
+		if event.Principal.Name != "i-1" || event.Client != "AWS SDK for Go v2 1.30.0" {
+			t.Errorf("expected the event %s by i-1 through the AWS SDK for Go v2 1.30.0, got %s through %s", event.EventId, event.Principal.Name, event.Client)
+		}
+	}
+	if expected := []string{"read-1", "write-1", "read-2", "write-2", "read-3"}; !slices.Equal(eventIds, expected) {
+		t.Errorf("expected the events %v, got %v", expected, eventIds)
+	}
+
+	tests := []struct {
+		name       string
+		bucketSize time.Duration
+		buckets    []TimelineBucket
+	}{
+		{
+			name:       "hourly",
+			bucketSize: time.Hour,
+			buckets: []TimelineBucket{
+				{Start: time.Date(2024, 10, 1, 10, 0, 0, 0, time.UTC), Reads: 2, Writes: 1},
+				{Start: time.Date(2024, 10, 1, 12, 0, 0, 0, time.UTC), Writes: 1},
+				{Start: time.Date(2024, 10, 2, 9, 0, 0, 0, time.UTC), Reads: 1},
+			},
+		},
+		{
+			name:       "daily",
+			bucketSize: 24 * time.Hour,
+			buckets: []TimelineBucket{
+				{Start: time.Date(2024, 10, 1, 0, 0, 0, 0, time.UTC), Reads: 2, Writes: 2},
+				{Start: time.Date(2024, 10, 2, 0, 0, 0, 0, time.UTC), Reads: 1},
+			},
+		},
+	}
+
+	for _, test := range tests {
+		t.Run(test.name, func(t *testing.T) {
+			buckets := BucketAWSSecretTimeline(timeline, test.bucketSize)
+			if !slices.Equal(buckets, test.buckets) {
+				t.Errorf("expected the buckets %v, got %v", test.buckets, buckets)
+			}
+		})
+	}
+}
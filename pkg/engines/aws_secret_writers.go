@@ -0,0 +1,68 @@
+package engines
+
+import (
+	"sort"
+	"time"
+
+	"github.com/torchsecurity/torch-secret-analyzer/pkg/collectors/aws_cloudtrail"
+)
+
+// SecretWriteAction describes what a write event did to a secret.
+type SecretWriteAction string
+
+const (
+	CreatedAction        SecretWriteAction = "created"
+	ModifiedAction       SecretWriteAction = "modified"
+	RotatedAction        SecretWriteAction = "rotated"
+	DeletedAction        SecretWriteAction = "deleted"
+	RestoredAction       SecretWriteAction = "restored"
+	RepermissionedAction SecretWriteAction = "re-permissioned"
+)
+
+var secretWriteActions = map[string]SecretWriteAction{
+	aws_cloudtrail.CreateSecretEvent:      CreatedAction,
+	aws_cloudtrail.PutSecretValueEvent:    ModifiedAction,
+	aws_cloudtrail.UpdateSecretEvent:      ModifiedAction,
+	aws_cloudtrail.RotateSecretEvent:      RotatedAction,
+	aws_cloudtrail.DeleteSecretEvent:      DeletedAction,
+	aws_cloudtrail.RestoreSecretEvent:     RestoredAction,
+	aws_cloudtrail.PutResourcePolicyEvent: RepermissionedAction,
+}
+
+// SecretWrite is a single lifecycle event of a secret, and the consumer that triggered it.
+type SecretWrite struct {
+	EventName string            `json:"eventName" yaml:"eventName"`
+	Action    SecretWriteAction `json:"action" yaml:"action"`
+	EventTime time.Time         `json:"eventTime" yaml:"eventTime"`
+	ErrorCode string            `json:"errorCode,omitempty" yaml:"errorCode,omitempty"` // Set when the write failed (e.g. AccessDenied), so the action didn't happen
+	Writer    Consumer          `json:"writer" yaml:"writer"`
+}
+
+// Failed tells whether the write was attempted but failed, leaving the secret as it was.
+func (w SecretWrite) Failed() bool {
+	return w.ErrorCode != ""
+}
+
+// GetAWSSecretWriters lists who created, modified, rotated, deleted, restored or re-permissioned a secret, in chronological order.
+// Failed writes are kept with their error code, as attempts to tamper with a secret are worth knowing about.
+func GetAWSSecretWriters(cloudtrailEvents aws_cloudtrail.EventsByName, secretId string, resolvers ...ConsumerResolver) []SecretWrite {
+	var writes []SecretWrite
+	for _, eventName := range aws_cloudtrail.WriteEvents {
+		for _, event := range filterEventsBySecret(cloudtrailEvents[eventName], secretId) {
+			// Events that can't be attributed to a consumer are kept, with their unattributed principal
+			writer, _ := extractResolvedConsumer(event, resolvers)
+			writes = append(writes, SecretWrite{
+				EventName: eventName,
+				Action:    secretWriteActions[eventName],
+				EventTime: event.EventTime,
+				ErrorCode: event.ErrorCode,
+				Writer:    writer,
+			})
+		}
+	}
+
+	sort.SliceStable(writes, func(i, j int) bool {
+		return writes[i].EventTime.Before(writes[j].EventTime)
+	})
+	return writes
+}
@@ -0,0 +1,91 @@
+package engines
+
+import (
+	"slices"
+	"testing"
+	"time"
+
+	"github.com/torchsecurity/torch-secret-analyzer/pkg/clients"
+	"github.com/torchsecurity/torch-secret-analyzer/pkg/collectors/aws_cloudtrail"
+)
+
+func TestGetAWSSecretWriters(t *testing.T) {
+	write := func(eventName string, day int, userIdentity clients.AWSUserIdentity) clients.CloudtrailEvent {
+		event := testReadEvent(time.Date(2024, 10, day, 10, 0, 0, 0, time.UTC), userIdentity, "10.0.0.1")
+		event.EventName = eventName
+		return event
+	}
+	failedWrite := func(eventName string, day int, userIdentity clients.AWSUserIdentity) clients.CloudtrailEvent {
+		event := write(eventName, day, userIdentity)
+		event.ErrorCode = "AccessDenied"
+		return event
+	}
+	otherSecretWrite := write(aws_cloudtrail.DeleteSecretEvent, 1, testIAMUser("alice"))
+	otherSecretWrite.Resources = []clients.CloudTrailEventResource{{ResourceType: "AWS::SecretsManager::Secret", ResourceName: testOtherSecretArn}}
+	sessionWithoutContext := testRoleSession("app", "i-1")
+	sessionWithoutContext.SessionContext = nil
+
+	tests := []struct {
+		name       string
+		writes     []clients.CloudtrailEvent
+		actions    []SecretWriteAction
+		writers    []string
+		errorCodes []string
+	}{
+		{
+			name: "lifecycle of a secret in chronological order",
+			writes: []clients.CloudtrailEvent{
+				write(aws_cloudtrail.RotateSecretEvent, 3, testRoleSession("rotation", "SecretsManagerRotation")),
+				write(aws_cloudtrail.CreateSecretEvent, 1, testIAMUser("alice")),
+				write(aws_cloudtrail.PutResourcePolicyEvent, 2, testIAMUser("bob")),
+				write(aws_cloudtrail.PutSecretValueEvent, 4, testIAMUser("alice")),
+				write(aws_cloudtrail.DeleteSecretEvent, 5, testIAMUser("alice")),
+				write(aws_cloudtrail.RestoreSecretEvent, 6, testIAMUser("bob")),
+			},
+			actions:    []SecretWriteAction{CreatedAction, RepermissionedAction, RotatedAction, ModifiedAction, DeletedAction, RestoredAction},
+			writers:    []string{"alice", "bob", "SecretsManagerRotation", "alice", "alice", "bob"},
+			errorCodes: []string{"", "", "", "", "", ""},
+		},
+		{
+			name:       "failed writes are flagged",
+			writes:     []clients.CloudtrailEvent{failedWrite(aws_cloudtrail.DeleteSecretEvent, 1, testIAMUser("mallory")), write(aws_cloudtrail.UpdateSecretEvent, 2, testIAMUser("alice"))},
+			actions:    []SecretWriteAction{DeletedAction, ModifiedAction},
+			writers:    []string{"mallory", "alice"},
+			errorCodes: []string{"AccessDenied", ""},
+		},
+		{
+			name:       "unattributed writers are kept",
+			writes:     []clients.CloudtrailEvent{write(aws_cloudtrail.PutSecretValueEvent, 1, sessionWithoutContext)},
+			actions:    []SecretWriteAction{ModifiedAction},
+			writers:    []string{"AROAapp:i-1"},
+			errorCodes: []string{""},
+		},
+		{
+			name:   "writes of other secrets",
+			writes: []clients.CloudtrailEvent{otherSecretWrite},
+		},
+	}
+
+	for _, test := range tests {
+		t.Run(test.name, func(t *testing.T) {
+			events := aws_cloudtrail.EventsByName{}
+			for _, event := range test.writes {
+				events[event.EventName] = append(events[event.EventName], event)
+			}
+			var actions []SecretWriteAction
+			var writers []string
+			var errorCodes []string
+			for _, write := range GetAWSSecretWriters(events, "prod/db") {
+				actions = append(actions, write.Action)
+				writers = append(writers, write.Writer.Name)
+				errorCodes = append(errorCodes, write.ErrorCode)
+				if write.Failed() != (write.ErrorCode != "") {
+					t.Errorf("expected a write with the error code '%s' to be failed: %v", write.ErrorCode, write.ErrorCode != "")
+				}
+			}
+			if !slices.Equal(actions, test.actions) || !slices.Equal(writers, test.writers) || !slices.Equal(errorCodes, test.errorCodes) {
+				t.Errorf("expected the writes %v by %v (errors: %v), got %v by %v (errors: %v)", test.actions, test.writers, test.errorCodes, actions, writers, errorCodes)
+			}
+		})
+	}
+}
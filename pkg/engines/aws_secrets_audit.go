@@ -0,0 +1,228 @@
+package engines
+
+import (
+	"encoding/json"
+	"fmt"
+	"sort"
+	"strings"
+	"time"
+
+	"github.com/samber/lo"
+	"github.com/torchsecurity/torch-secret-analyzer/pkg/clients"
+	"github.com/torchsecurity/torch-secret-analyzer/pkg/collectors/aws_cloudtrail"
+	"github.com/torchsecurity/torch-secret-analyzer/pkg/collectors/aws_secretsmanager"
+	timeutil "github.com/torchsecurity/torch-secret-analyzer/pkg/utils/time"
+)
+
+type FindingSeverity string
+
+const (
+	HighSeverity   FindingSeverity = "high"
+	MediumSeverity FindingSeverity = "medium"
+	LowSeverity    FindingSeverity = "low"
+)
+
+// AuditRuleId identifies the rule behind a finding, so that it can be suppressed.
+type AuditRuleId string
+
+const (
+	UnusedSecretRule                  AuditRuleId = "unused-secret"
+	RotationDisabledRule              AuditRuleId = "rotation-disabled"
+	RotationOverdueRule               AuditRuleId = "rotation-overdue"
+	DefaultKmsKeyRule                 AuditRuleId = "default-kms-key"
+	NoResourcePolicyRule              AuditRuleId = "no-resource-policy"
+	TooManyHumanReadersRule           AuditRuleId = "too-many-human-readers"
+	DeprecatedVersionReadRule         AuditRuleId = "deprecated-version-read"
+	ReadWhileScheduledForDeletionRule AuditRuleId = "read-while-scheduled-for-deletion"
+)
+
+// AuditRules are the severities of the audit rules.
+var AuditRules = map[AuditRuleId]FindingSeverity{
+	UnusedSecretRule:                  LowSeverity,
+	RotationDisabledRule:              MediumSeverity,
+	RotationOverdueRule:               HighSeverity,
+	DefaultKmsKeyRule:                 LowSeverity,
+	NoResourcePolicyRule:              LowSeverity,
+	TooManyHumanReadersRule:           MediumSeverity,
+	DeprecatedVersionReadRule:         MediumSeverity,
+	ReadWhileScheduledForDeletionRule: HighSeverity,
+}
+
+var severityRanks = map[FindingSeverity]int{HighSeverity: 0, MediumSeverity: 1, LowSeverity: 2}
+
+const previousVersionStage = "AWSPREVIOUS"
+
+// SecretFinding is a hygiene issue of a secret.
+type SecretFinding struct {
+	RuleId     AuditRuleId     `json:"ruleId" yaml:"ruleId"`
+	Severity   FindingSeverity `json:"severity" yaml:"severity"`
+	SecretName string          `json:"secretName" yaml:"secretName"`
+	SecretArn  string          `json:"secretArn" yaml:"secretArn"`
+	Reason     string          `json:"reason" yaml:"reason"`
+}
+
+type AuditOptions struct {
+	Now             time.Time
+	UnusedDays      int      // A secret not read in that many days is unused
+	MaxHumanReaders int      // Zero allows any number of human readers
+	Suppressions    []string // Rule ids (e.g. "default-kms-key"), optionally of the secrets matching a pattern (e.g. "no-resource-policy:dev/*")
+}
+
+// ValidateSuppression tells whether a suppression refers to an existing rule.
+func ValidateSuppression(suppression string) error {
+	ruleId, _, _ := strings.Cut(suppression, ":")
+	if _, exists := AuditRules[AuditRuleId(ruleId)]; !exists {
+		ruleIds := lo.Keys(AuditRules)
+		sort.Slice(ruleIds, func(i, j int) bool { return ruleIds[i] < ruleIds[j] })
+		return fmt.Errorf("unknown rule '%s' in suppression '%s', expected one of %v", ruleId, suppression, ruleIds)
+	}
+	return nil
+}
+
+// AuditAWSSecrets checks the hygiene of secrets against their configuration and their reads in the timeframe, sorted by severity then secret name.
+// Secrets scheduled for deletion are only checked for reads, as the rest of their configuration no longer matters.
+// Secrets Manager refuses to return the value of a secret scheduled for deletion, so its reads are attempts that failed,
+// while the other rules only count the reads that succeeded.
+func AuditAWSSecrets(secrets []aws_secretsmanager.SecretDetails, cloudtrailEvents aws_cloudtrail.EventsByName, options AuditOptions, resolvers ...ConsumerResolver) []SecretFinding {
+	plainSecrets := lo.Map(secrets, func(secretDetails aws_secretsmanager.SecretDetails, _ int) clients.Secret {
+		return secretDetails.Secret
+	})
+	secretIndexes := map[string]int{}
+	for i, secret := range plainSecrets {
+		secretIndexes[secret.Arn] = i
+		secretIndexes[secret.Name] = i
+	}
+	secretsReadAttempts := make([][]clients.CloudtrailEvent, len(secrets))
+	for _, event := range cloudtrailEvents[aws_cloudtrail.GetSecretValueEvent] {
+		if index, found := findEventSecret(event, plainSecrets, secretIndexes); found {
+			secretsReadAttempts[index] = append(secretsReadAttempts[index], event)
+		}
+	}
+
+	var findings []SecretFinding
+	for i, secretDetails := range secrets {
+		secret := secretDetails.Secret
+		finding := func(ruleId AuditRuleId, reason string) {
+			if isSuppressed(options.Suppressions, ruleId, secret.Name) {
+				return
+			}
+			findings = append(findings, SecretFinding{RuleId: ruleId, Severity: AuditRules[ruleId], SecretName: secret.Name, SecretArn: secret.Arn, Reason: reason})
+		}
+		readAttempts := secretsReadAttempts[i]
+		reads := lo.Reject(readAttempts, func(event clients.CloudtrailEvent, _ int) bool { return isFailedRead(event) })
+
+		if !secret.DeletedDate.IsZero() {
+			deletionReadAttempts := lo.Filter(readAttempts, func(event clients.CloudtrailEvent, _ int) bool {
+				return event.EventTime.After(secret.DeletedDate)
+			})
+			if len(deletionReadAttempts) > 0 {
+				finding(ReadWhileScheduledForDeletionRule, fmt.Sprintf("%d attempted reads since it was scheduled for deletion on %s, last on %s, whose callers will break once it's deleted",
+					len(deletionReadAttempts), timeutil.FormatTime(secret.DeletedDate), timeutil.FormatTime(lastEventTime(deletionReadAttempts))))
+			}
+			continue
+		}
+
+		// Secrets Manager only keeps the date of the last access, so the reads in the timeframe are more accurate
+		lastReadAt := secret.LastAccessedDate
+		if len(reads) > 0 && lastEventTime(reads).After(lastReadAt) {
+			lastReadAt = lastEventTime(reads)
+		}
+		unusedSince := options.Now.AddDate(0, 0, -options.UnusedDays)
+		if options.UnusedDays > 0 && lastReadAt.Before(unusedSince) && secret.CreatedDate.Before(unusedSince) {
+			finding(UnusedSecretRule, lo.Ternary(lastReadAt.IsZero(),
+				fmt.Sprintf("never read, and created %d days ago", wholeDays(options.Now.Sub(secret.CreatedDate))),
+				fmt.Sprintf("not read in %d days, last on %s", wholeDays(options.Now.Sub(lastReadAt)), timeutil.FormatTime(lastReadAt))))
+		}
+
+		if !secret.RotationEnabled {
+			finding(RotationDisabledRule, "automatic rotation is disabled"+lo.Ternary(secret.LastRotatedDate.IsZero(),
+				", and the secret was never rotated", fmt.Sprintf(", last rotated on %s", timeutil.FormatTime(secret.LastRotatedDate))))
+		} else if dueAt := rotationDueAt(secret); !dueAt.IsZero() && dueAt.Before(options.Now) {
+			finding(RotationOverdueRule, fmt.Sprintf("rotation was due on %s, last rotated on %s", timeutil.FormatTime(dueAt), formatOptionalDate(secret.LastRotatedDate)))
+		}
+
+		if isDefaultKmsKey(secret.KmsKeyId) {
+			finding(DefaultKmsKeyRule, "encrypted with the AWS managed key aws/secretsmanager, whose key policy can't restrict who decrypts the secret")
+		}
+
+		if secretDetails.ResourcePolicy == "" {
+			finding(NoResourcePolicyRule, "has no resource policy, so any principal of the account whose IAM policies allow it can read the secret")
+		}
+
+		humanReaders := lo.Uniq(lo.FilterMap(getConsumers(reads, resolvers), func(consumer Consumer, _ int) (string, bool) {
+			return consumer.Name, consumer.Category == HumanConsumer
+		}))
+		if options.MaxHumanReaders > 0 && len(humanReaders) > options.MaxHumanReaders {
+			sort.Strings(humanReaders)
+			finding(TooManyHumanReadersRule, fmt.Sprintf("read by %d humans, more than %d: %s", len(humanReaders), options.MaxHumanReaders, strings.Join(humanReaders, ", ")))
+		}
+
+		previousVersionReads := lo.Filter(reads, func(event clients.CloudtrailEvent, _ int) bool {
+			return readVersionStage(event) == previousVersionStage
+		})
+		if len(previousVersionReads) > 0 {
+			finding(DeprecatedVersionReadRule, fmt.Sprintf("its %s version was read %d times, last on %s", previousVersionStage,
+				len(previousVersionReads), timeutil.FormatTime(lastEventTime(previousVersionReads))))
+		}
+	}
+
+	sort.SliceStable(findings, func(i, j int) bool {
+		if findings[i].Severity != findings[j].Severity {
+			return severityRanks[findings[i].Severity] < severityRanks[findings[j].Severity]
+		}
+		return findings[i].SecretName < findings[j].SecretName
+	})
+	return findings
+}
+
+func isSuppressed(suppressions []string, ruleId AuditRuleId, secretName string) bool {
+	return lo.ContainsBy(suppressions, func(suppression string) bool {
+		suppressedRuleId, secretPattern, found := strings.Cut(suppression, ":")
+		return AuditRuleId(suppressedRuleId) == ruleId && (!found || matchesPattern(secretPattern, secretName, false))
+	})
+}
+
+// isFailedRead tells whether a read failed (e.g. with AccessDenied, or with InvalidRequestException for a secret scheduled for deletion),
+// in which case the caller never got the secret's value.
+func isFailedRead(event clients.CloudtrailEvent) bool {
+	return event.ErrorCode != ""
+}
+
+// rotationDueAt is when a secret was due to be rotated, by its schedule or, when it's missing, its rotation interval.
+func rotationDueAt(secret clients.Secret) time.Time {
+	if !secret.NextRotationDate.IsZero() {
+		return secret.NextRotationDate
+	}
+	if secret.RotationInterval == 0 {
+		return time.Time{}
+	}
+	lastRotatedAt := lo.Ternary(secret.LastRotatedDate.IsZero(), secret.CreatedDate, secret.LastRotatedDate)
+	return lastRotatedAt.AddDate(0, 0, int(secret.RotationInterval))
+}
+
+func isDefaultKmsKey(kmsKeyId string) bool {
+	return kmsKeyId == "" || strings.HasSuffix(kmsKeyId, "alias/aws/secretsmanager")
+}
+
+// readVersionStage is the staging label a read asked for, empty when it read the AWSCURRENT version by default.
+func readVersionStage(event clients.CloudtrailEvent) string {
+	var request struct {
+		VersionStage string `json:"versionStage"`
+	}
+	_ = json.Unmarshal([]byte(event.RequestParameters), &request)
+	return request.VersionStage
+}
+
+func lastEventTime(events []clients.CloudtrailEvent) time.Time {
+	return lo.MaxBy(events, func(a clients.CloudtrailEvent, b clients.CloudtrailEvent) bool {
+		return a.EventTime.After(b.EventTime)
+	}).EventTime
+}
+
+func wholeDays(period time.Duration) int {
+	return int(period.Hours() / 24)
+}
+
+func formatOptionalDate(t time.Time) string {
+	return lo.Ternary(t.IsZero(), "never", timeutil.FormatTime(t))
+}
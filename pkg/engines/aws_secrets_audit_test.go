@@ -0,0 +1,231 @@
+package engines
+
+import (
+	"slices"
+	"sort"
+	"testing"
+	"time"
+
+	"github.com/torchsecurity/torch-secret-analyzer/pkg/clients"
+	"github.com/torchsecurity/torch-secret-analyzer/pkg/collectors/aws_cloudtrail"
+	"github.com/torchsecurity/torch-secret-analyzer/pkg/collectors/aws_secretsmanager"
+)
+
+func TestAuditAWSSecrets(t *testing.T) {
+	now := time.Date(2024, 11, 1, 0, 0, 0, 0, time.UTC)
+	recently := now.AddDate(0, 0, -1)
+	// A secret that follows every rule, which each test breaks
+	healthySecret := func() aws_secretsmanager.SecretDetails {
+		return aws_secretsmanager.SecretDetails{
+			Secret: clients.Secret{
+				Arn:              testSecretArn,
+				Name:             "prod/db",
+				KmsKeyId:         testKeyArn,
+				RotationEnabled:  true,
+				RotationInterval: 30,
+				LastRotatedDate:  now.AddDate(0, 0, -10),
+				NextRotationDate: now.AddDate(0, 0, 20),
+				LastAccessedDate: recently,
+				CreatedDate:      now.AddDate(-1, 0, 0),
+			},
+			ResourcePolicy: testPolicy(`{"Effect": "Deny", "Principal": "*", "Action": "secretsmanager:DeleteSecret", "Resource": "*"}`),
+		}
+	}
+	read := func(eventTime time.Time, userIdentity clients.AWSUserIdentity) clients.CloudtrailEvent {
+		return testReadEvent(eventTime, userIdentity, "10.0.0.1")
+	}
+	previousVersionRead := read(recently, testRoleSession("app", "i-1"))
+	previousVersionRead.RequestParameters = `{"secretId":"prod/db","versionStage":"AWSPREVIOUS"}`
+	// Secrets Manager refuses to return the value of a secret scheduled for deletion
+	failedRead := read(recently, testRoleSession("app", "i-2"))
+	failedRead.ErrorCode = "InvalidRequestException"
+
+	tests := []struct {
+		name    string
+		secret  func(secret *aws_secretsmanager.SecretDetails)
+		reads   []clients.CloudtrailEvent
+		options func(options *AuditOptions)
+		ruleIds []AuditRuleId
+	}{
+		{
+			name:  "healthy secret",
+			reads: []clients.CloudtrailEvent{read(recently, testRoleSession("app", "i-1"))},
+		},
+		{
+			name: "not read in the timeframe",
+			secret: func(secret *aws_secretsmanager.SecretDetails) {
+				secret.Secret.LastAccessedDate = now.AddDate(0, 0, -60)
+			},
+			ruleIds: []AuditRuleId{UnusedSecretRule},
+		},
+		{
+			name:    "never read",
+			secret:  func(secret *aws_secretsmanager.SecretDetails) { secret.Secret.LastAccessedDate = time.Time{} },
+			ruleIds: []AuditRuleId{UnusedSecretRule},
+		},
+		{
+			name: "never read, but created recently",
+			secret: func(secret *aws_secretsmanager.SecretDetails) {
+				secret.Secret.LastAccessedDate = time.Time{}
+				secret.Secret.CreatedDate = now.AddDate(0, 0, -5)
+			},
+		},
+		{
+			name:    "unused check disabled",
+			secret:  func(secret *aws_secretsmanager.SecretDetails) { secret.Secret.LastAccessedDate = time.Time{} },
+			options: func(options *AuditOptions) { options.UnusedDays = 0 },
+		},
+		{
+			name:    "rotation disabled",
+			secret:  func(secret *aws_secretsmanager.SecretDetails) { secret.Secret.RotationEnabled = false },
+			ruleIds: []AuditRuleId{RotationDisabledRule},
+		},
+		{
+			name:    "rotation overdue",
+			secret:  func(secret *aws_secretsmanager.SecretDetails) { secret.Secret.NextRotationDate = now.AddDate(0, 0, -2) },
+			ruleIds: []AuditRuleId{RotationOverdueRule},
+		},
+		{
+			name: "rotation overdue by its interval",
+			secret: func(secret *aws_secretsmanager.SecretDetails) {
+				secret.Secret.NextRotationDate = time.Time{}
+				secret.Secret.LastRotatedDate = now.AddDate(0, 0, -45)
+			},
+			ruleIds: []AuditRuleId{RotationOverdueRule},
+		},
+		{
+			name:    "default KMS key",
+			secret:  func(secret *aws_secretsmanager.SecretDetails) { secret.Secret.KmsKeyId = "" },
+			ruleIds: []AuditRuleId{DefaultKmsKeyRule},
+		},
+		{
+			name:    "no resource policy",
+			secret:  func(secret *aws_secretsmanager.SecretDetails) { secret.ResourcePolicy = "" },
+			ruleIds: []AuditRuleId{NoResourcePolicyRule},
+		},
+		{
+			name: "too many human readers",
+			reads: []clients.CloudtrailEvent{
+				read(recently, testIAMUser("alice")),
+				read(recently, testIAMUser("bob")),
+				read(recently, testIAMUser("carol")),
+				read(recently, testRoleSession("app", "i-1")),
+			},
+			options: func(options *AuditOptions) { options.MaxHumanReaders = 2 },
+			ruleIds: []AuditRuleId{TooManyHumanReadersRule},
+		},
+		{
+			name:    "human readers within the limit",
+			reads:   []clients.CloudtrailEvent{read(recently, testIAMUser("alice")), read(recently, testIAMUser("alice"))},
+			options: func(options *AuditOptions) { options.MaxHumanReaders = 1 },
+		},
+		{
+			name:    "deprecated version read",
+			reads:   []clients.CloudtrailEvent{previousVersionRead},
+			ruleIds: []AuditRuleId{DeprecatedVersionReadRule},
+		},
+		{
+			name: "read while scheduled for deletion",
+			secret: func(secret *aws_secretsmanager.SecretDetails) {
+				secret.Secret.DeletedDate = now.AddDate(0, 0, -3)
+				secret.ResourcePolicy = ""
+			},
+			reads:   []clients.CloudtrailEvent{read(now.AddDate(0, 0, -5), testRoleSession("app", "i-1")), read(recently, testRoleSession("app", "i-2"))},
+			ruleIds: []AuditRuleId{ReadWhileScheduledForDeletionRule},
+		},
+		{
+			name: "attempted read while scheduled for deletion",
+			secret: func(secret *aws_secretsmanager.SecretDetails) {
+				secret.Secret.DeletedDate = now.AddDate(0, 0, -3)
+			},
+			reads:   []clients.CloudtrailEvent{failedRead},
+			ruleIds: []AuditRuleId{ReadWhileScheduledForDeletionRule},
+		},
+		{
+			name: "failed reads don't count as reads",
+			secret: func(secret *aws_secretsmanager.SecretDetails) {
+				secret.Secret.LastAccessedDate = now.AddDate(0, 0, -60)
+			},
+			reads:   []clients.CloudtrailEvent{failedRead},
+			ruleIds: []AuditRuleId{UnusedSecretRule},
+		},
+		{
+			name: "not read since it was scheduled for deletion",
+			secret: func(secret *aws_secretsmanager.SecretDetails) {
+				secret.Secret.DeletedDate = now.AddDate(0, 0, -3)
+			},
+			reads: []clients.CloudtrailEvent{read(now.AddDate(0, 0, -5), testRoleSession("app", "i-1"))},
+		},
+		{
+			name: "suppressed rules",
+			secret: func(secret *aws_secretsmanager.SecretDetails) {
+				secret.Secret.KmsKeyId = "alias/aws/secretsmanager"
+				secret.Secret.RotationEnabled = false
+				secret.ResourcePolicy = ""
+			},
+			options: func(options *AuditOptions) {
+				options.Suppressions = []string{"default-kms-key", "no-resource-policy:prod/*", "rotation-disabled:dev/*"}
+			},
+			ruleIds: []AuditRuleId{RotationDisabledRule},
+		},
+	}
+
+	for _, test := range tests {
+		t.Run(test.name, func(t *testing.T) {
+			secret := healthySecret()
+			if test.secret != nil {
+				test.secret(&secret)
+			}
+			options := AuditOptions{Now: now, UnusedDays: 30}
+			if test.options != nil {
+				test.options(&options)
+			}
+
+			events := aws_cloudtrail.EventsByName{aws_cloudtrail.GetSecretValueEvent: test.reads}
+			findings := AuditAWSSecrets([]aws_secretsmanager.SecretDetails{secret}, events, options)
+			var ruleIds []AuditRuleId
+			for _, finding := range findings {
+				ruleIds = append(ruleIds, finding.RuleId)
+			}
+			sort.Slice(ruleIds, func(i, j int) bool { return ruleIds[i] < ruleIds[j] })
+			if !slices.Equal(ruleIds, test.ruleIds) {
+				t.Errorf("expected findings %v, got %+v", test.ruleIds, findings)
+			}
+		})
+	}
+}
+
+func TestAuditAWSSecretsSortsFindingsBySeverity(t *testing.T) {
+	now := time.Date(2024, 11, 1, 0, 0, 0, 0, time.UTC)
+	secrets := []aws_secretsmanager.SecretDetails{
+		{Secret: clients.Secret{Arn: "arn:aws:secretsmanager:us-east-1:111111111111:secret:b-AbCdEf", Name: "b", RotationEnabled: true, CreatedDate: now}},
+		{Secret: clients.Secret{Arn: "arn:aws:secretsmanager:us-east-1:111111111111:secret:a-AbCdEf", Name: "a", RotationEnabled: true, NextRotationDate: now.AddDate(0, 0, -1), CreatedDate: now}},
+	}
+
+	findings := AuditAWSSecrets(secrets, aws_cloudtrail.EventsByName{}, AuditOptions{Now: now})
+	var severities []FindingSeverity
+	var secretNames []string
+	for _, finding := range findings {
+		severities = append(severities, finding.Severity)
+		secretNames = append(secretNames, finding.SecretName)
+	}
+	if !slices.Equal(severities, []FindingSeverity{HighSeverity, LowSeverity, LowSeverity, LowSeverity, LowSeverity}) {
+		t.Errorf("expected findings sorted by severity, got %+v", findings)
+	}
+	if !slices.Equal(secretNames[1:], []string{"a", "a", "b", "b"}) {
+		t.Errorf("expected findings of the same severity sorted by secret name, got %+v", findings)
+	}
+}
+
+func TestValidateSuppression(t *testing.T) {
+	for suppression, valid := range map[string]bool{
+		"unused-secret":              true,
+		"no-resource-policy:dev/*":   true,
+		"no-such-rule":               false,
+		"no-such-rule:unused-secret": false,
+	} {
+		if err := ValidateSuppression(suppression); (err == nil) != valid {
+			t.Errorf("ValidateSuppression(%q) = %v, expected valid: %v", suppression, err, valid)
+		}
+	}
+}
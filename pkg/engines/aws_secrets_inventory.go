@@ -0,0 +1,58 @@
+package engines
+
+import (
+	"sort"
+	"time"
+
+	"github.com/torchsecurity/torch-secret-analyzer/pkg/clients"
+	"github.com/torchsecurity/torch-secret-analyzer/pkg/collectors/aws_cloudtrail"
+)
+
+type SecretUsage struct {
+	Secret     clients.Secret
+	ReadCount  int       // Number of read events in the timeframe
+	LastReadAt time.Time // Zero when the secret was not read in the timeframe
+}
+
+// GetAWSSecretsInventory joins the secrets of an account with the number of times each of them was read in the timeframe, sorted by name.
+func GetAWSSecretsInventory(secrets []clients.Secret, cloudtrailEvents aws_cloudtrail.EventsByName) []SecretUsage {
+	inventory := make([]SecretUsage, len(secrets))
+	secretIndexes := map[string]int{}
+	for i, secret := range secrets {
+		inventory[i] = SecretUsage{Secret: secret}
+		secretIndexes[secret.Arn] = i
+		secretIndexes[secret.Name] = i
+	}
+
+	for _, event := range cloudtrailEvents[aws_cloudtrail.GetSecretValueEvent] {
+		index, found := findEventSecret(event, secrets, secretIndexes)
+		if !found {
+			continue
+		}
+		inventory[index].ReadCount++
+		if event.EventTime.After(inventory[index].LastReadAt) {
+			inventory[index].LastReadAt = event.EventTime
+		}
+	}
+
+	sort.Slice(inventory, func(i, j int) bool {
+		return inventory[i].Secret.Name < inventory[j].Secret.Name
+	})
+	return inventory
+}
+
+// findEventSecret returns the index of the secret an event refers to.
+// Most events refer to the secret by its full ARN or name, so we only fall back to matching partial ARNs when a lookup fails.
+func findEventSecret(event clients.CloudtrailEvent, secrets []clients.Secret, secretIndexes map[string]int) (int, bool) {
+	for _, resource := range event.Resources {
+		if index, found := secretIndexes[resource.ResourceName]; found {
+			return index, true
+		}
+		for i, secret := range secrets {
+			if isResourceMatchingSecret(resource.ResourceName, secret.Name) {
+				return i, true
+			}
+		}
+	}
+	return 0, false
+}
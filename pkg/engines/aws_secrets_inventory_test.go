@@ -0,0 +1,72 @@
+package engines
+
+import (
+	"testing"
+	"time"
+
+	"github.com/torchsecurity/torch-secret-analyzer/pkg/clients"
+	"github.com/torchsecurity/torch-secret-analyzer/pkg/collectors/aws_cloudtrail"
+)
+
+func TestGetAWSSecretsInventory(t *testing.T) {
+	firstRead := time.Date(2024, 10, 1, 10, 0, 0, 0, time.UTC)
+	lastRead := time.Date(2024, 10, 2, 10, 0, 0, 0, time.UTC)
+	readOf := func(eventTime time.Time, resourceName string) clients.CloudtrailEvent {
+		event := testReadEvent(eventTime, testRoleSession("app", "i-1"), "10.0.0.1")
+		event.Resources = []clients.CloudTrailEventResource{{ResourceType: "AWS::SecretsManager::Secret", ResourceName: resourceName}}
+		return event
+	}
+	secrets := []clients.Secret{
+		{Arn: testOtherSecretArn, Name: "prod/other"},
+		{Arn: testSecretArn, Name: "prod/db"},
+		{Arn: "arn:aws:secretsmanager:us-east-1:111111111111:secret:prod/unused-MnOpQr", Name: "prod/unused"},
+	}
+
+	tests := []struct {
+		name       string
+		reads      []clients.CloudtrailEvent
+		readCounts map[string]int
+		lastReadAt map[string]time.Time
+	}{
+		{
+			name:       "no reads",
+			readCounts: map[string]int{"prod/db": 0, "prod/other": 0, "prod/unused": 0},
+		},
+		{
+			name:       "reads by ARN and name",
+			reads:      []clients.CloudtrailEvent{readOf(lastRead, testSecretArn), readOf(firstRead, "prod/db"), readOf(firstRead, "prod/other")},
+			readCounts: map[string]int{"prod/db": 2, "prod/other": 1, "prod/unused": 0},
+			lastReadAt: map[string]time.Time{"prod/db": lastRead, "prod/other": firstRead},
+		},
+		{
+			name:       "reads of a replica",
+			reads:      []clients.CloudtrailEvent{readOf(firstRead, "arn:aws:secretsmanager:eu-west-1:111111111111:secret:prod/db-AbCdEf")},
+			readCounts: map[string]int{"prod/db": 1, "prod/other": 0, "prod/unused": 0},
+			lastReadAt: map[string]time.Time{"prod/db": firstRead},
+		},
+		{
+			name:       "reads of other secrets",
+			reads:      []clients.CloudtrailEvent{readOf(firstRead, "dev/db")},
+			readCounts: map[string]int{"prod/db": 0, "prod/other": 0, "prod/unused": 0},
+		},
+	}
+
+	for _, test := range tests {
+		t.Run(test.name, func(t *testing.T) {
+			inventory := GetAWSSecretsInventory(secrets, aws_cloudtrail.EventsByName{aws_cloudtrail.GetSecretValueEvent: test.reads})
+			var names []string
+			for _, usage := range inventory {
+				names = append(names, usage.Secret.Name)
+				if usage.ReadCount != test.readCounts[usage.Secret.Name] {
+					t.Errorf("expected %d reads of %s, got %d", test.readCounts[usage.Secret.Name], usage.Secret.Name, usage.ReadCount)
+				}
+				if !usage.LastReadAt.Equal(test.lastReadAt[usage.Secret.Name]) {
+					t.Errorf("expected the last read of %s at %s, got %s", usage.Secret.Name, test.lastReadAt[usage.Secret.Name], usage.LastReadAt)
+				}
+			}
+			if len(names) != 3 || names[0] != "prod/db" || names[1] != "prod/other" || names[2] != "prod/unused" {
+				t.Errorf("expected the secrets sorted by name, got %v", names)
+			}
+		})
+	}
+}
@@ -0,0 +1,50 @@
+package engines
+
+import (
+	"strings"
+
+	"github.com/samber/lo"
+	"github.com/torchsecurity/torch-secret-analyzer/pkg/clients"
+)
+
+// IdentityStoreResolver enriches SSO users with their display name and groups in the IAM Identity Center identity store.
+type IdentityStoreResolver struct {
+	usersByName map[string]clients.IdentityStoreUser // by user name and emails, in lower case
+	userGroups  map[string][]string                  // group display names by user id
+}
+
+func NewIdentityStoreResolver(users []clients.IdentityStoreUser, groups []clients.IdentityStoreGroup) *IdentityStoreResolver {
+	resolver := &IdentityStoreResolver{
+		usersByName: map[string]clients.IdentityStoreUser{},
+		userGroups:  map[string][]string{},
+	}
+	for _, user := range users {
+		resolver.usersByName[strings.ToLower(user.UserName)] = user
+		for _, email := range user.Emails {
+			resolver.usersByName[strings.ToLower(email)] = user
+		}
+	}
+	for _, group := range groups {
+		for _, memberId := range group.MemberIds {
+			resolver.userGroups[memberId] = append(resolver.userGroups[memberId], group.DisplayName)
+		}
+	}
+	return resolver
+}
+
+func (r *IdentityStoreResolver) ResolveConsumer(event clients.CloudtrailEvent, consumer *Consumer) {
+	if len(consumer.PermissionSets) == 0 {
+		return
+	}
+	// The session of an SSO user is named after its user name, which is usually its email
+	user, found := r.usersByName[strings.ToLower(extractAssumingPrincipalId(event.UserIdentity.PrincipalId))]
+	if !found {
+		return
+	}
+
+	consumer.DisplayName = user.DisplayName
+	consumer.Groups = r.userGroups[user.UserId]
+	if consumer.Email == "" && len(user.Emails) > 0 {
+		consumer.Email = lo.FirstOrEmpty(user.Emails)
+	}
+}
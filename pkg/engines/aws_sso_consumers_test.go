@@ -0,0 +1,84 @@
+package engines
+
+import (
+	"slices"
+	"testing"
+	"time"
+
+	"github.com/torchsecurity/torch-secret-analyzer/pkg/clients"
+)
+
+func TestIdentityStoreResolver(t *testing.T) {
+	resolver := NewIdentityStoreResolver(
+		[]clients.IdentityStoreUser{
+			{UserId: "u-alice", UserName: "alice@example.com", DisplayName: "Alice Smith", Emails: []string{"alice@example.com"}},
+			{UserId: "u-bob", UserName: "bob", DisplayName: "Bob Jones", Emails: []string{"bob@example.com", "bob.jones@example.com"}},
+		},
+		[]clients.IdentityStoreGroup{
+			{GroupId: "g-admins", DisplayName: "Admins", MemberIds: []string{"u-alice"}},
+			{GroupId: "g-developers", DisplayName: "Developers", MemberIds: []string{"u-alice", "u-bob"}},
+		},
+	)
+
+	tests := []struct {
+		name           string
+		userIdentity   clients.AWSUserIdentity
+		consumerType   string
+		permissionSets []string
+		email          string
+		displayName    string
+		groups         []string
+	}{
+		{
+			name:           "SSO user named by its email",
+			userIdentity:   testRoleSession("AWSReservedSSO_AdministratorAccess_0123456789abcdef", "Alice@example.com"),
+			consumerType:   "AWS SAML User",
+			permissionSets: []string{"AdministratorAccess"},
+			email:          "Alice@example.com",
+			displayName:    "Alice Smith",
+			groups:         []string{"Admins", "Developers"},
+		},
+		{
+			name:           "SSO user named by its user name",
+			userIdentity:   testRoleSession("AWSReservedSSO_Read_Only_Access_0123456789abcdef", "bob"),
+			consumerType:   "AWS SAML User",
+			permissionSets: []string{"Read_Only_Access"},
+			email:          "bob@example.com",
+			displayName:    "Bob Jones",
+			groups:         []string{"Developers"},
+		},
+		{
+			name:           "SSO user missing from the identity store",
+			userIdentity:   testRoleSession("AWSReservedSSO_AdministratorAccess_0123456789abcdef", "carol@example.com"),
+			consumerType:   "AWS SAML User",
+			permissionSets: []string{"AdministratorAccess"},
+			email:          "carol@example.com",
+		},
+		{
+			name:         "role session named after an SSO user",
+			userIdentity: testRoleSession("app", "bob"),
+			consumerType: "Application",
+		},
+		{
+			name:         "IAM user named after an SSO user",
+			userIdentity: testIAMUser("bob"),
+			consumerType: "AWS IAM User",
+		},
+	}
+
+	for _, test := range tests {
+		t.Run(test.name, func(t *testing.T) {
+			consumer, err := extractResolvedConsumer(testReadEvent(time.Date(2024, 10, 1, 10, 0, 0, 0, time.UTC), test.userIdentity, "10.0.0.1"), []ConsumerResolver{resolver})
+			if err != nil {
+				t.Fatal(err)
+			}
+			if consumer.Type != test.consumerType || !slices.Equal(consumer.PermissionSets, test.permissionSets) || consumer.Email != test.email {
+				t.Errorf("expected the %s with the permission sets %v and the email '%s', got the %s with %v and '%s'",
+					test.consumerType, test.permissionSets, test.email, consumer.Type, consumer.PermissionSets, consumer.Email)
+			}
+			if consumer.DisplayName != test.displayName || !slices.Equal(consumer.Groups, test.groups) {
+				t.Errorf("expected the display name '%s' and the groups %v, got '%s' and %v", test.displayName, test.groups, consumer.DisplayName, consumer.Groups)
+			}
+		})
+	}
+}
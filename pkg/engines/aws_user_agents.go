@@ -0,0 +1,67 @@
+package engines
+
+import (
+	"regexp"
+	"strings"
+
+	"github.com/samber/lo"
+)
+
+type userAgentClient struct {
+	name    string
+	pattern *regexp.Regexp // Its first group, if any, details the client (usually its version)
+}
+
+// Tools embed the user agent of the SDK they are built with, so they are matched before the SDKs.
+var userAgentClients = []userAgentClient{
+	{"AWS Parameters and Secrets Lambda Extension", regexp.MustCompile(`(?i)AWS-Parameters-and-Secrets-Lambda-Extension(?:/([\w.-]+))?`)},
+	{"External Secrets Operator", regexp.MustCompile(`(?i)external-secrets(?:/v?([\w.-]+))?`)},
+	{"Secrets Store CSI Driver", regexp.MustCompile(`(?i)secrets-store-csi-driver(?:-provider-aws)?(?:/v?([\w.-]+))?`)},
+	{"AWS Secrets Manager Caching Client", regexp.MustCompile(`(?i)AwsSecretCache(?:/([\w.-]+))?`)},
+	{"Terraform", regexp.MustCompile(`Terraform/([\w.-]+)`)},
+	{"Pulumi", regexp.MustCompile(`(?i)pulumi(?:/v?([\w.-]+))?`)},
+	{"AWS CDK", regexp.MustCompile(`aws-cdk/([\w.-]+)`)},
+	{"AWS CLI", regexp.MustCompile(`aws-cli/([\w.-]+)`)},
+	{"AWS Tools for PowerShell", regexp.MustCompile(`AWSPowerShell(?:\.\w+)?/([\w.-]+)`)},
+	{"AWS Console", regexp.MustCompile(`^(?:console|signin)\.amazonaws\.com$|console\.aws\.amazon\.com`)},
+	{"boto3", regexp.MustCompile(`Boto3/([\w.-]+)`)},
+	{"botocore", regexp.MustCompile(`Botocore/([\w.-]+)`)},
+	{"AWS SDK for Go v2", regexp.MustCompile(`aws-sdk-go-v2/([\w.-]+)`)},
+	{"AWS SDK for Go", regexp.MustCompile(`aws-sdk-go/([\w.-]+)`)},
+	{"AWS SDK for Java", regexp.MustCompile(`aws-sdk-java/([\w.-]+)`)},
+	{"AWS SDK for JavaScript", regexp.MustCompile(`aws-sdk-(?:js|nodejs)/([\w.-]+)`)},
+	{"AWS SDK for .NET", regexp.MustCompile(`aws-sdk-dotnet[\w-]*/([\w.-]+)`)},
+	{"AWS SDK for Ruby", regexp.MustCompile(`aws-sdk-ruby\d*/([\w.-]+)`)},
+	{"AWS SDK for PHP", regexp.MustCompile(`aws-sdk-php/([\w.-]+)`)},
+	{"AWS SDK for Rust", regexp.MustCompile(`aws-sdk-rust/([\w.-]+)`)},
+	{"AWS SDK for C++", regexp.MustCompile(`aws-sdk-cpp/([\w.-]+)`)},
+	{"AWS SDK for Kotlin", regexp.MustCompile(`aws-sdk-kotlin/([\w.-]+)`)},
+	{"AWS SDK for Swift", regexp.MustCompile(`aws-sdk-swift/([\w.-]+)`)},
+	{"AWS Internal", regexp.MustCompile(`^AWS Internal$`)},
+	// AWS services that call on behalf of a principal are logged by their service principal (e.g. cloudformation.amazonaws.com)
+	{"AWS Service", regexp.MustCompile(`^([\w.-]+\.amazonaws\.com)$`)},
+}
+
+// ParseUserAgent identifies the client that sent a request by its user agent (e.g. "AWS CLI 2.15.30" or "boto3 1.34.0").
+// Unknown user agents are identified by their first product token (e.g. "curl").
+func ParseUserAgent(userAgent string) string {
+	userAgent = strings.TrimSpace(userAgent)
+	if userAgent == "" {
+		return ""
+	}
+
+	for _, client := range userAgentClients {
+		matches := client.pattern.FindStringSubmatch(userAgent)
+		if matches == nil {
+			continue
+		}
+		if len(matches) > 1 && matches[1] != "" {
+			return client.name + " " + matches[1]
+		}
+		return client.name
+	}
+
+	product := strings.Fields(userAgent)[0]
+	product = product[:strings.IndexAny(product+"/", "/(")]
+	return lo.CoalesceOrEmpty(product, "Unknown")
+}
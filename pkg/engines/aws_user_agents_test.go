@@ -0,0 +1,48 @@
+package engines
+
+import "testing"
+
+func TestParseUserAgent(t *testing.T) {
+	tests := []struct {
+		userAgent string
+		client    string
+	}{
+		{userAgent: "", client: ""},
+		{userAgent: "  ", client: ""},
+		{userAgent: "aws-cli/2.15.30 Python/3.11.8 Darwin/23.4.0 exe/x86_64 prompt/off command/secretsmanager.get-secret-value", client: "AWS CLI 2.15.30"},
+		{userAgent: "Boto3/1.34.0 md/Botocore#1.34.0 ua/2.0 os/linux#5.10 lang/python#3.12.0 Botocore/1.34.0", client: "boto3 1.34.0"},
+		{userAgent: "Botocore/1.34.0 ua/2.0 os/linux#5.10", client: "botocore 1.34.0"},
+		{userAgent: "aws-sdk-go-v2/1.30.0 os/linux lang/go#1.22.0 md/GOOS#linux api/secretsmanager#1.32.0", client: "AWS SDK for Go v2 1.30.0"},
+		{userAgent: "aws-sdk-go/1.44.0 (go1.20; linux; amd64)", client: "AWS SDK for Go 1.44.0"},
+		{userAgent: "aws-sdk-java/2.25.0 Linux/5.10 OpenJDK_64-Bit_Server_VM/17.0.9", client: "AWS SDK for Java 2.25.0"},
+		{userAgent: "aws-sdk-nodejs/2.1500.0 linux/v18.19.0", client: "AWS SDK for JavaScript 2.1500.0"},
+		{userAgent: "aws-sdk-js/3.540.0 ua/2.0 os/linux#5.10 lang/js md/nodejs#20.11.0", client: "AWS SDK for JavaScript 3.540.0"},
+		{userAgent: "aws-sdk-dotnet-coreclr/3.7.300.0 aws-sdk-dotnet-core/3.7.300.0 .NET_Core/8.0.0", client: "AWS SDK for .NET 3.7.300.0"},
+		{userAgent: "aws-sdk-ruby3/3.190.0 ruby/3.2.2 x86_64-linux", client: "AWS SDK for Ruby 3.190.0"},
+		{userAgent: "AWSPowerShell.Common/4.1.500.0 .NET_Runtime/4.0", client: "AWS Tools for PowerShell 4.1.500.0"},
+		// Tools are identified rather than the SDK they are built with
+		{userAgent: "APN/1.0 HashiCorp/1.0 Terraform/1.9.0 (+https://www.terraform.io) terraform-provider-aws/5.60.0 aws-sdk-go-v2/1.30.0", client: "Terraform 1.9.0"},
+		{userAgent: "aws-sdk-go-v2/1.30.0 external-secrets/v0.9.14", client: "External Secrets Operator 0.9.14"},
+		{userAgent: "secrets-store-csi-driver-provider-aws/1.0.r2-68-gab548b3-2024.03.20.21.58", client: "Secrets Store CSI Driver 1.0.r2-68-gab548b3-2024.03.20.21.58"},
+		{userAgent: "AWS-Parameters-and-Secrets-Lambda-Extension/1.0.0 aws-sdk-go-v2/1.30.0", client: "AWS Parameters and Secrets Lambda Extension 1.0.0"},
+		{userAgent: "aws-sdk-java/1.12.600 AwsSecretCache/1.0.2", client: "AWS Secrets Manager Caching Client 1.0.2"},
+		{userAgent: "pulumi/v3.110.0 aws-sdk-go-v2/1.30.0", client: "Pulumi 3.110.0"},
+		{userAgent: "aws-sdk-js/3.540.0 aws-cdk/2.130.0", client: "AWS CDK 2.130.0"},
+		{userAgent: "console.amazonaws.com", client: "AWS Console"},
+		{userAgent: "Mozilla/5.0 (Macintosh) console.aws.amazon.com", client: "AWS Console"},
+		{userAgent: "AWS Internal", client: "AWS Internal"},
+		{userAgent: "cloudformation.amazonaws.com", client: "AWS Service cloudformation.amazonaws.com"},
+		// Unknown user agents are identified by their first product token
+		{userAgent: "curl/8.4.0", client: "curl"},
+		{userAgent: "my-app(linux)", client: "my-app"},
+		{userAgent: "/1.0", client: "Unknown"},
+	}
+
+	for _, test := range tests {
+		t.Run(test.userAgent, func(t *testing.T) {
+			if client := ParseUserAgent(test.userAgent); client != test.client {
+				t.Errorf("expected the client '%s', got '%s'", test.client, client)
+			}
+		})
+	}
+}
@@ -0,0 +1,73 @@
+package engines
+
+import (
+	"regexp"
+	"strings"
+
+	"github.com/samber/lo"
+	"github.com/torchsecurity/torch-secret-analyzer/pkg/clients"
+)
+
+// ECS names the sessions of task roles after the id of the task
+var ecsTaskIdPattern = regexp.MustCompile(`^[0-9a-f]{32}$`)
+
+// WorkloadResolver names the Lambda functions, ECS tasks and EC2 instances behind role sessions.
+type WorkloadResolver struct {
+	functionsByRole map[string][]string // by principalKey of the execution role
+	familiesByRole  map[string][]string // by principalKey of the task role
+	instanceNames   map[string]string   // by instance id
+}
+
+func NewWorkloadResolver(functions []clients.LambdaFunction, taskDefinitions []clients.ECSTaskDefinition, instances []clients.EC2Instance) *WorkloadResolver {
+	resolver := &WorkloadResolver{
+		functionsByRole: map[string][]string{},
+		familiesByRole:  map[string][]string{},
+		instanceNames:   map[string]string{},
+	}
+	for _, function := range functions {
+		roleKey := principalKey(function.RoleArn)
+		resolver.functionsByRole[roleKey] = append(resolver.functionsByRole[roleKey], function.FunctionName)
+	}
+	for _, taskDefinition := range taskDefinitions {
+		if taskDefinition.TaskRoleArn == "" {
+			continue
+		}
+		roleKey := principalKey(taskDefinition.TaskRoleArn)
+		resolver.familiesByRole[roleKey] = append(resolver.familiesByRole[roleKey], taskDefinition.Family)
+	}
+	for _, instance := range instances {
+		if instance.Name != "" {
+			resolver.instanceNames[instance.InstanceId] = instance.Name
+		}
+	}
+	return resolver
+}
+
+func (r *WorkloadResolver) ResolveConsumer(event clients.CloudtrailEvent, consumer *Consumer) {
+	sessionContext := event.UserIdentity.SessionContext
+	if sessionContext == nil || sessionContext.SessionIssuer == nil {
+		return
+	}
+	roleKey := principalKey(sessionContext.SessionIssuer.Arn)
+	sessionName := extractAssumingPrincipalId(event.UserIdentity.PrincipalId)
+
+	switch {
+	// Lambda names the sessions of execution roles after the function, so we confirm the function is using the role
+	case lo.Contains(r.functionsByRole[roleKey], sessionName):
+		consumer.Category = MachineConsumer
+		consumer.Type = "AWS Lambda Function"
+		consumer.Name = "lambda:" + sessionName
+	case strings.HasPrefix(sessionName, "i-"):
+		consumer.Category = MachineConsumer
+		consumer.Type = "AWS EC2 Instance"
+		consumer.Name = "ec2:" + lo.CoalesceOrEmpty(r.instanceNames[sessionName], sessionName)
+	case len(r.familiesByRole[roleKey]) > 0 && ecsTaskIdPattern.MatchString(sessionName):
+		// A task role shared by several task definitions can't be narrowed down to one of them, so we name all of them
+		consumer.Category = MachineConsumer
+		consumer.Type = "AWS ECS Task"
+		consumer.Name = "ecs:" + strings.Join(r.familiesByRole[roleKey], ", ")
+	default:
+		return
+	}
+	consumer.classified = true
+}
@@ -0,0 +1,80 @@
+package engines
+
+import (
+	"testing"
+	"time"
+
+	"github.com/torchsecurity/torch-secret-analyzer/pkg/clients"
+)
+
+func TestWorkloadResolver(t *testing.T) {
+	const taskId = "0123456789abcdef0123456789abcdef"
+	resolver := NewWorkloadResolver(
+		[]clients.LambdaFunction{{FunctionName: "rotate-db", RoleArn: "arn:aws:iam::111111111111:role/lambda-exec"}},
+		[]clients.ECSTaskDefinition{
+			{Family: "api", TaskRoleArn: "arn:aws:iam::111111111111:role/ecs-task"},
+			{Family: "worker", TaskRoleArn: "arn:aws:iam::111111111111:role/ecs-task"},
+			{Family: "no-role"},
+		},
+		[]clients.EC2Instance{{InstanceId: "i-0abc", Name: "bastion"}, {InstanceId: "i-0def"}},
+	)
+
+	tests := []struct {
+		name         string
+		userIdentity clients.AWSUserIdentity
+		consumerType string
+		consumerName string
+	}{
+		{
+			name:         "Lambda function of its execution role",
+			userIdentity: testRoleSession("lambda-exec", "rotate-db"),
+			consumerType: "AWS Lambda Function",
+			consumerName: "lambda:rotate-db",
+		},
+		{
+			name:         "session of an execution role not named after its function",
+			userIdentity: testRoleSession("lambda-exec", "deploy"),
+			consumerType: "Application",
+			consumerName: "deploy",
+		},
+		{
+			name:         "named EC2 instance",
+			userIdentity: testRoleSession("ec2", "i-0abc"),
+			consumerType: "AWS EC2 Instance",
+			consumerName: "ec2:bastion",
+		},
+		{
+			name:         "EC2 instance without a name",
+			userIdentity: testRoleSession("ec2", "i-0def"),
+			consumerType: "AWS EC2 Instance",
+			consumerName: "ec2:i-0def",
+		},
+		{
+			name:         "ECS task of a role shared by several task definitions",
+			userIdentity: testRoleSession("ecs-task", taskId),
+			consumerType: "AWS ECS Task",
+			consumerName: "ecs:api, worker",
+		},
+		{
+			name:         "task id session of a role without task definitions",
+			userIdentity: testRoleSession("other", taskId),
+			consumerType: "Application",
+			consumerName: taskId,
+		},
+		{
+			name:         "IAM user",
+			userIdentity: testIAMUser("alice"),
+			consumerType: "AWS IAM User",
+			consumerName: "alice",
+		},
+	}
+
+	for _, test := range tests {
+		t.Run(test.name, func(t *testing.T) {
+			consumer, _ := extractResolvedConsumer(testReadEvent(time.Date(2024, 10, 1, 10, 0, 0, 0, time.UTC), test.userIdentity, "10.0.0.1"), []ConsumerResolver{resolver})
+			if consumer.Type != test.consumerType || consumer.Name != test.consumerName {
+				t.Errorf("expected the consumer %s '%s', got %s '%s'", test.consumerType, test.consumerName, consumer.Type, consumer.Name)
+			}
+		})
+	}
+}